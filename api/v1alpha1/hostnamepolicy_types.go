@@ -0,0 +1,72 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HostnamePolicySpec defines which hostnames NetworkPolicies in the selected namespaces may use.
+type HostnamePolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to. An empty selector
+	// selects every namespace.
+	// +optional
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Allowed lists the hostname patterns NetworkPolicies may use. A pattern is a hostname,
+	// "*.<domain>" for any name below the domain, or "*" for every name. If empty, every
+	// hostname that is not denied is allowed.
+	// +optional
+	// +kubebuilder:validation:MaxItems=256
+	// +kubebuilder:validation:items:Pattern=`^(\*|(\*\.)?[a-zA-Z0-9_]([-a-zA-Z0-9_]*[a-zA-Z0-9])?(\.[a-zA-Z0-9_]([-a-zA-Z0-9_]*[a-zA-Z0-9])?)*)$`
+	Allowed []string `json:"allowed,omitempty"`
+
+	// Denied lists the hostname patterns NetworkPolicies may not use. Denied takes
+	// precedence over Allowed.
+	// +optional
+	// +kubebuilder:validation:MaxItems=256
+	// +kubebuilder:validation:items:Pattern=`^(\*|(\*\.)?[a-zA-Z0-9_]([-a-zA-Z0-9_]*[a-zA-Z0-9])?(\.[a-zA-Z0-9_]([-a-zA-Z0-9_]*[a-zA-Z0-9])?)*)$`
+	Denied []string `json:"denied,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=hnp
+// +kubebuilder:printcolumn:name="Allowed",type="string",JSONPath=".spec.allowed"
+// +kubebuilder:printcolumn:name="Denied",type="string",JSONPath=".spec.denied"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// HostnamePolicy restricts the hostnames and SRV names NetworkPolicies may resolve.
+// A name must be allowed by every HostnamePolicy selecting the NetworkPolicy's namespace.
+type HostnamePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HostnamePolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HostnamePolicyList contains a list of HostnamePolicy.
+type HostnamePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HostnamePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HostnamePolicy{}, &HostnamePolicyList{})
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HostnameQuotaSpec defines limits that apply to each selected namespace.
+type HostnameQuotaSpec struct {
+	// NamespaceSelector selects the namespaces the quota applies to. An empty selector
+	// selects every namespace.
+	// +optional
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// MaxPolicies limits the number of NetworkPolicies per namespace.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxPolicies *int32 `json:"maxPolicies,omitempty"`
+
+	// MaxHostnames limits the hostnames and SRV names referenced by the NetworkPolicies
+	// of a namespace, counted per policy.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxHostnames *int32 `json:"maxHostnames,omitempty"`
+
+	// MaxAddresses limits the addresses rendered into the NetworkPolicies of a namespace,
+	// counted per policy.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxAddresses *int32 `json:"maxAddresses,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=hnq
+// +kubebuilder:printcolumn:name="Policies",type="integer",JSONPath=".spec.maxPolicies"
+// +kubebuilder:printcolumn:name="Hostnames",type="integer",JSONPath=".spec.maxHostnames"
+// +kubebuilder:printcolumn:name="Addresses",type="integer",JSONPath=".spec.maxAddresses"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// HostnameQuota limits the NetworkPolicies, hostnames and addresses of each selected
+// namespace. If several quotas select a namespace, the lowest of each limit applies.
+type HostnameQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HostnameQuotaSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HostnameQuotaList contains a list of HostnameQuota.
+type HostnameQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HostnameQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HostnameQuota{}, &HostnameQuotaList{})
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of hostname sets an egress peer can refer to.
+const (
+	HostnameSetKind        = "HostnameSet"
+	ClusterHostnameSetKind = "ClusterHostnameSet"
+)
+
+// HostnameSetSpec lists hostnames that egress peers refer to by the name of the set.
+type HostnameSetSpec struct {
+	// Hostnames are the DNS names in the set.
+	// +listType=set
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=256
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*$`
+	Hostnames []string `json:"hostnames"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=hns
+// +kubebuilder:printcolumn:name="Hostnames",type="string",JSONPath=".spec.hostnames",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// HostnameSet is a named list of hostnames that the NetworkPolicies of its namespace
+// can reference from their egress rules.
+type HostnameSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HostnameSetSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HostnameSetList contains a list of HostnameSet.
+type HostnameSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HostnameSet `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=chns
+// +kubebuilder:printcolumn:name="Hostnames",type="string",JSONPath=".spec.hostnames",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterHostnameSet is a named list of hostnames that NetworkPolicies in any namespace
+// can reference from their egress rules.
+type ClusterHostnameSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HostnameSetSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterHostnameSetList contains a list of ClusterHostnameSet.
+type ClusterHostnameSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterHostnameSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HostnameSet{}, &HostnameSetList{}, &ClusterHostnameSet{}, &ClusterHostnameSetList{})
+}
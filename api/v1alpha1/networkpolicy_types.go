@@ -23,6 +23,36 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// ResolveNowAnnotation requests immediate re-resolution of a NetworkPolicy's hostnames.
+// Any change to its value triggers a reconcile; `kubectl anp resolve-now` sets it to the current time.
+const ResolveNowAnnotation = "networking.ayoy.se/resolve-now"
+
+// EgressHostsAnnotation requests a generated NetworkPolicy for a Deployment, StatefulSet or
+// standalone Pod. Its value is a comma-separated list of "host[:port[/protocol]]" entries,
+// e.g. "api.example.com:443,db.example.com:5432/TCP"; an entry without a port allows every port.
+// Generation must be enabled on the operator.
+const EgressHostsAnnotation = "networking.ayoy.se/egress-hosts"
+
+// GeneratedFromLabel is set on generated NetworkPolicies to the kind of the workload they were generated for.
+const GeneratedFromLabel = "networking.ayoy.se/generated-from"
+
+// EgressBaselineLabel opts a namespace into the egress baseline when set to "enabled": the
+// operator maintains a NetworkPolicy denying all egress from the namespace's pods, and one
+// allowing DNS to the cluster DNS, so that hostnames in egress rules can be resolved.
+const EgressBaselineLabel = "networking.ayoy.se/egress-baseline"
+
+// ProbeLabel is set on probe pods to the name of the NetworkPolicy whose connectivity they verify.
+const ProbeLabel = "networking.ayoy.se/probe"
+
+// ProbeExecAnnotation opts a pod in to being probed from through exec when set to "enabled".
+// Policies can only name pods with this annotation in spec.verification.podName, so that
+// creating a policy does not let a tenant run commands in pods it could not exec into itself.
+const ProbeExecAnnotation = "networking.ayoy.se/probe-exec"
+
+// ConsolidatedLabel is set on standard NetworkPolicies that merge the policies of several
+// NetworkPolicies selecting the same pods. Each of them is an owner of the merged policy.
+const ConsolidatedLabel = "networking.ayoy.se/consolidated"
+
 // NetworkPolicyPort describes a port to allow traffic on.
 type NetworkPolicyPort struct {
 	// Protocol is the protocol (TCP, UDP, or SCTP) which traffic must match.
@@ -39,15 +69,99 @@ type NetworkPolicyPort struct {
 	EndPort *int32 `json:"endPort,omitempty"`
 }
 
+// HostnameSetReference refers to a HostnameSet in the NetworkPolicy's namespace or to a ClusterHostnameSet.
+type HostnameSetReference struct {
+	// Kind is the kind of the set: HostnameSet or ClusterHostnameSet. Defaults to HostnameSet.
+	// +optional
+	// +kubebuilder:default=HostnameSet
+	// +kubebuilder:validation:Enum=HostnameSet;ClusterHostnameSet
+	Kind string `json:"kind,omitempty"`
+
+	// Name is the name of the set.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+}
+
+// ServiceReference refers to a Service in the NetworkPolicy's namespace.
+type ServiceReference struct {
+	// Name is the name of the Service. The Service must be of type ExternalName.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+}
+
 // EgressPeer describes a peer to allow traffic to.
+// Exactly one of hostname, srv, hostnameSetRef and serviceRef must be set.
+// +kubebuilder:validation:XValidation:rule="[has(self.hostname), has(self.srv), has(self.hostnameSetRef), has(self.serviceRef)].filter(x, x).size() == 1",message="exactly one of hostname, srv, hostnameSetRef or serviceRef must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.allowedCNAMESuffixes) || !has(self.srv)",message="allowedCNAMESuffixes cannot be set for srv peers"
 type EgressPeer struct {
 	// Hostname is the DNS name to resolve to IP addresses for this peer.
+	// +optional
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:validation:MaxLength=253
 	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*$`
-	Hostname string `json:"hostname"`
+	Hostname string `json:"hostname,omitempty"`
+
+	// SRV is the name of an SRV record set (e.g. "_ldap._tcp.corp.example") whose targets
+	// are resolved to IP addresses. The ports and protocol are taken from the SRV records
+	// and the name's protocol label; the rule's ports do not apply to SRV peers.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^_[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?\._(tcp|udp|sctp)(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)+$`
+	SRV string `json:"srv,omitempty"`
+
+	// HostnameSetRef refers to a set of hostnames. The peer stands for one peer per
+	// hostname in the set, each with the other settings of this peer. A set that does
+	// not exist yields no addresses.
+	// +optional
+	HostnameSetRef *HostnameSetReference `json:"hostnameSetRef,omitempty"`
+
+	// ServiceRef refers to a Service of type ExternalName whose spec.externalName is
+	// resolved as the peer's hostname. A Service that does not exist or is not of type
+	// ExternalName yields no addresses.
+	// +optional
+	ServiceRef *ServiceReference `json:"serviceRef,omitempty"`
+
+	// AllowedCNAMESuffixes restricts where the hostname may point. If set, every name in the
+	// hostname's CNAME chain must equal or be a subdomain of one of these domains; otherwise
+	// the peer yields no addresses. A hostname that is not an alias always passes.
+	// +optional
+	// +kubebuilder:validation:MaxItems=10
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*$`
+	AllowedCNAMESuffixes []string `json:"allowedCNAMESuffixes,omitempty"`
+
+	// IPFamilies restricts the peer to addresses of these families.
+	// Defaults to the rule's ipFamilies.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=2
+	// +kubebuilder:validation:items:Enum=IPv4;IPv6
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+
+	// DNSSEC controls whether the peer's addresses must be validated with DNSSEC.
+	// Validation requires the operator to run with the validating resolver.
+	// +optional
+	DNSSEC DNSSECMode `json:"dnssec,omitempty"`
 }
 
+// DNSSECMode controls how DNSSEC validation results are enforced for a peer.
+// +kubebuilder:validation:Enum=Off;Prefer;Require
+type DNSSECMode string
+
+const (
+	// DNSSECModeOff uses answers regardless of DNSSEC. This is the default.
+	DNSSECModeOff DNSSECMode = "Off"
+
+	// DNSSECModePrefer rejects answers whose signatures fail to validate but accepts unsigned answers.
+	DNSSECModePrefer DNSSECMode = "Prefer"
+
+	// DNSSECModeRequire only accepts answers the validating resolver authenticated.
+	DNSSECModeRequire DNSSECMode = "Require"
+)
+
 // EgressRule describes an egress rule allowing traffic to resolved hostnames.
 type EgressRule struct {
 	// Ports is a list of destination ports for outgoing traffic.
@@ -58,8 +172,28 @@ type EgressRule struct {
 	// +optional
 	// +kubebuilder:validation:MaxItems=10
 	To []EgressPeer `json:"to,omitempty"`
+
+	// IPFamilies restricts the rule's peers to addresses of these families.
+	// Defaults to the operator's --ip-families, which allows both families unless set.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=2
+	// +kubebuilder:validation:items:Enum=IPv4;IPv6
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
 }
 
+// PolicyMode controls whether a NetworkPolicy is enforced or only audited.
+// +kubebuilder:validation:Enum=Enforce;Audit
+type PolicyMode string
+
+const (
+	// PolicyModeEnforce creates and maintains the standard NetworkPolicy.
+	PolicyModeEnforce PolicyMode = "Enforce"
+
+	// PolicyModeAudit renders the standard NetworkPolicy into status without creating it.
+	PolicyModeAudit PolicyMode = "Audit"
+)
+
 // NetworkPolicySpec defines the desired state of NetworkPolicy.
 type NetworkPolicySpec struct {
 	// PodSelector selects the pods to which this NetworkPolicy applies.
@@ -79,6 +213,131 @@ type NetworkPolicySpec struct {
 	// +optional
 	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1m')",message="resolutionInterval must be at least 1 minute"
 	ResolutionInterval *metav1.Duration `json:"resolutionInterval,omitempty"`
+
+	// Mode controls whether the rendered standard NetworkPolicy is created (Enforce)
+	// or only written to status for review (Audit). Defaults to Enforce.
+	// +optional
+	Mode PolicyMode `json:"mode,omitempty"`
+
+	// Verification enables connectivity probes from the selected pods to the policy's
+	// destinations. Probes only run if verification is enabled on the operator.
+	// +optional
+	Verification *VerificationSpec `json:"verification,omitempty"`
+}
+
+// VerificationSpec configures connectivity probes. Each resolved hostname and SRV target is
+// probed with a TCP connection on the TCP ports of its egress rule; rules without a
+// numeric TCP port are not probed.
+type VerificationSpec struct {
+	// PodName names a running pod in the namespace, selected by the policy, to probe from.
+	// The pod must opt in with the annotation networking.ayoy.se/probe-exec: enabled and
+	// provide sh and nc. If unset, a short-lived probe pod with labels matching
+	// the policy's pod selector is created for each verification.
+	// +optional
+	PodName string `json:"podName,omitempty"`
+
+	// Container is the container of PodName to probe from. Defaults to the pod's default container.
+	// +optional
+	Container string `json:"container,omitempty"`
+
+	// Interval is how often to verify connectivity. Defaults to 1 hour. Minimum: 5 minutes.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('5m')",message="interval must be at least 5 minutes"
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// SRVTargetStatus describes a target discovered for an SRV peer.
+type SRVTargetStatus struct {
+	// Target is the hostname of the SRV target.
+	Target string `json:"target"`
+
+	// Port is the port published in the SRV record.
+	Port int32 `json:"port"`
+
+	// Addresses are the target's resolved addresses in CIDR notation that were allowed into the policy.
+	// +optional
+	Addresses []string `json:"addresses,omitempty"`
+
+	// FilteredAddresses are the target's resolved addresses that were removed by the IP filter.
+	// +optional
+	FilteredAddresses []string `json:"filteredAddresses,omitempty"`
+
+	// DNSSEC is the DNSSEC validation result of the target, if it was validated.
+	// +optional
+	DNSSEC string `json:"dnssec,omitempty"`
+
+	// Quarantine is the reason the target is quarantined for a suspected DNS rebinding.
+	// Its addresses are then frozen to the last answer before the suspicious change.
+	// +optional
+	Quarantine string `json:"quarantine,omitempty"`
+
+	// LastError is the error from resolving the target. Empty if it succeeded.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// HostnameStatus describes the resolution state of a single hostname.
+type HostnameStatus struct {
+	// Hostname is the resolved DNS name, or the SRV record name for SRV peers.
+	Hostname string `json:"hostname"`
+
+	// SRV is true if the peer is an SRV peer; its addresses are listed per target.
+	// +optional
+	SRV bool `json:"srv,omitempty"`
+
+	// Targets lists the targets discovered for an SRV peer.
+	// +optional
+	Targets []SRVTargetStatus `json:"targets,omitempty"`
+
+	// Addresses are the resolved addresses in CIDR notation that were allowed into the policy.
+	// +optional
+	Addresses []string `json:"addresses,omitempty"`
+
+	// FilteredAddresses are resolved addresses in CIDR notation that were removed by the IP filter.
+	// +optional
+	FilteredAddresses []string `json:"filteredAddresses,omitempty"`
+
+	// Resolver identifies the resolver that produced the addresses.
+	// +optional
+	Resolver string `json:"resolver,omitempty"`
+
+	// CNAMEChain lists the aliases followed from the hostname to its canonical name.
+	// +optional
+	CNAMEChain []string `json:"cnameChain,omitempty"`
+
+	// DroppedFamilies lists the IP families whose resolved addresses were dropped
+	// because the peer is restricted to other families.
+	// +optional
+	DroppedFamilies []corev1.IPFamily `json:"droppedFamilies,omitempty"`
+
+	// DNSSEC is the DNSSEC validation result (Secure, Insecure or Bogus), if the hostname was validated.
+	// +optional
+	DNSSEC string `json:"dnssec,omitempty"`
+
+	// Quarantine is the reason the hostname is quarantined for a suspected DNS rebinding
+	// (ScopeChange or Flapping). Its addresses are then frozen to the last answer before
+	// the suspicious change until the quarantine is acknowledged with a
+	// QuarantineAcknowledgement.
+	// +optional
+	Quarantine string `json:"quarantine,omitempty"`
+
+	// LastSuccessTime is when the hostname was last resolved successfully.
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// LastError is the error from the most recent resolution attempt. Empty if it succeeded.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// EgressRuleStatus describes the resolution state of a single egress rule.
+type EgressRuleStatus struct {
+	// Index is the position of the rule in spec.egress.
+	Index int32 `json:"index"`
+
+	// Hostnames holds the resolution state of each hostname in the rule.
+	// +optional
+	Hostnames []HostnameStatus `json:"hostnames,omitempty"`
 }
 
 // NetworkPolicyStatus defines the observed state of NetworkPolicy.
@@ -90,11 +349,52 @@ type NetworkPolicyStatus struct {
 	// ResolvedAddresses maps hostnames to their resolved IP addresses.
 	// +optional
 	ResolvedAddresses map[string][]string `json:"resolvedAddresses,omitempty"`
+
+	// Mode is the mode the NetworkPolicy was last reconciled in.
+	// +optional
+	Mode PolicyMode `json:"mode,omitempty"`
+
+	// RenderedPolicy is the standard NetworkPolicy spec rendered for the NetworkPolicy.
+	// It is only set when the spec is not enforced on its own: in Audit mode, or when
+	// policies are consolidated.
+	// +optional
+	RenderedPolicy *networkingv1.NetworkPolicySpec `json:"renderedPolicy,omitempty"`
+
+	// ConsolidatedInto is the name of the standard NetworkPolicy that enforces the
+	// NetworkPolicy together with the other policies selecting the same pods.
+	// +optional
+	ConsolidatedInto string `json:"consolidatedInto,omitempty"`
+
+	// Rules holds per-rule, per-hostname resolution detail, in spec.egress order.
+	// +optional
+	Rules []EgressRuleStatus `json:"rules,omitempty"`
+
+	// HostnameCount is the number of distinct hostnames referenced by the spec.
+	// +optional
+	HostnameCount int32 `json:"hostnameCount,omitempty"`
+
+	// AddressCount is the number of distinct addresses in the rendered policy.
+	// +optional
+	AddressCount int32 `json:"addressCount,omitempty"`
+
+	// LastResolvedTime is when hostnames were last resolved.
+	// +optional
+	LastResolvedTime *metav1.Time `json:"lastResolvedTime,omitempty"`
+
+	// LastVerifiedTime is when connectivity was last probed, including probes that failed to run.
+	// +optional
+	LastVerifiedTime *metav1.Time `json:"lastVerifiedTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName=anp
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Mode",type="string",JSONPath=".status.mode"
+// +kubebuilder:printcolumn:name="Hostnames",type="integer",JSONPath=".status.hostnameCount"
+// +kubebuilder:printcolumn:name="Addresses",type="integer",JSONPath=".status.addressCount"
+// +kubebuilder:printcolumn:name="Consolidated Into",type="string",JSONPath=".status.consolidatedInto",priority=1
+// +kubebuilder:printcolumn:name="Last Resolved",type="date",JSONPath=".status.lastResolvedTime"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // NetworkPolicy is the Schema for the networkpolicies API.
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuarantineAcknowledgementSpec lists the quarantined hostnames to release.
+type QuarantineAcknowledgementSpec struct {
+	// Hostnames are the quarantined hostnames and SRV targets to release, or "*" to
+	// release every quarantined hostname.
+	// +kubebuilder:validation:MinItems=1
+	Hostnames []string `json:"hostnames"`
+}
+
+// QuarantineAcknowledgementStatus records which hostnames an acknowledgement released.
+type QuarantineAcknowledgementStatus struct {
+	// ObservedGeneration is the generation whose hostnames were released. Each generation
+	// is applied once, so that hostnames quarantined later are not released by it.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Released are the hostnames that were quarantined and released.
+	// +optional
+	Released []string `json:"released,omitempty"`
+
+	// AcknowledgedTime is when the hostnames were released.
+	// +optional
+	AcknowledgedTime *metav1.Time `json:"acknowledgedTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=qack
+// +kubebuilder:printcolumn:name="Hostnames",type="string",JSONPath=".spec.hostnames"
+// +kubebuilder:printcolumn:name="Released",type="string",JSONPath=".status.released"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// QuarantineAcknowledgement releases hostnames quarantined for a suspected DNS rebinding,
+// so that the policies referencing them accept their current answers. It is cluster-scoped
+// because a quarantine applies to every policy referencing the hostname.
+type QuarantineAcknowledgement struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuarantineAcknowledgementSpec   `json:"spec,omitempty"`
+	Status QuarantineAcknowledgementStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuarantineAcknowledgementList contains a list of QuarantineAcknowledgement.
+type QuarantineAcknowledgementList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuarantineAcknowledgement `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuarantineAcknowledgement{}, &QuarantineAcknowledgementList{})
+}
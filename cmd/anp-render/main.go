@@ -0,0 +1,409 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command anp-render renders augmented NetworkPolicy manifests into the standard
+// networking.k8s.io/v1 NetworkPolicies the operator would create, without a cluster.
+//
+// Usage:
+//
+//	anp-render [flags] [file ...]
+//
+// Manifests are read from the given files, or from stdin when no file (or "-") is given.
+// HostnameSets, ClusterHostnameSets and ExternalName Services among them are expanded
+// into the peers that reference them. Other documents are ignored.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/flagutil"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+func main() {
+	var resolverName string
+	var hostsFile string
+	var namespace string
+	var timeout time.Duration
+	var ipBlacklist flagutil.StringSlice
+	var ipWhitelist flagutil.StringSlice
+	var clusterCIDRs flagutil.StringSlice
+	var blacklistSet bool
+	var dnsServers flagutil.StringSlice
+	var ipFamilies flagutil.StringSlice
+	var dnsOverTLS bool
+	var dnsTLSServerName, dnsTLSCAFile string
+
+	flag.StringVar(&resolverName, "resolver", "system",
+		"Resolver to use: \"system\" for the host's DNS resolver, \"wire\" to query DNS servers directly "+
+			"(recording CNAME chains), \"validating\" to also report DNSSEC validation by validating DNS servers "+
+			"reached on loopback or over DNS over TLS, or \"hosts\" for a static hosts file.")
+	flag.StringVar(&hostsFile, "hosts-file", "",
+		"Hosts-file formatted fixture used by --resolver=hosts for reproducible output.")
+	flag.Var(&dnsServers, "dns-servers",
+		"DNS servers (host:port) queried by --resolver=wire (comma-separated, repeatable). "+
+			"Default: the nameservers in /etc/resolv.conf")
+	flag.BoolVar(&dnsOverTLS, "dns-over-tls", false,
+		"If set, --resolver=wire and --resolver=validating query --dns-servers over DNS over TLS.")
+	flag.StringVar(&dnsTLSServerName, "dns-tls-server-name", "",
+		"Name to verify the DNS over TLS servers' certificates for. Default: the address of the server queried")
+	flag.StringVar(&dnsTLSCAFile, "dns-tls-ca-file", "",
+		"PEM file with the CA certificates to verify the DNS over TLS servers' certificates with. "+
+			"Default: the system roots")
+	flag.StringVar(&namespace, "namespace", "default",
+		"Namespace for manifests that do not specify one.")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "Overall timeout for hostname resolution.")
+	flag.Var(&ipBlacklist, "ip-blacklist",
+		"CIDRs or presets to block from resolved IPs (comma-separated, repeatable). "+
+			"Presets: "+strings.Join(dns.PresetNames(), ", ")+". "+
+			"Default: "+strings.Join(dns.DefaultBlacklist, ","))
+	flag.Var(&ipWhitelist, "ip-whitelist",
+		"CIDRs or presets to allow (comma-separated, repeatable). "+
+			"When set, only matching IPs pass (unless also blacklisted).")
+	flag.Var(&clusterCIDRs, "cluster-cidrs",
+		"Pod and Service CIDRs the cluster-cidrs preset expands to (comma-separated, repeatable).")
+	flag.Var(&ipFamilies, "ip-families",
+		"IP families (IPv4, IPv6) allowed for egress rules that do not set ipFamilies "+
+			"(comma-separated, repeatable). Default: both")
+	flag.Parse()
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ip-blacklist" {
+			blacklistSet = true
+		}
+	})
+	if !blacklistSet {
+		ipBlacklist = flagutil.StringSlice(dns.DefaultBlacklist)
+	}
+
+	var dnsTLS *tls.Config
+	if dnsOverTLS {
+		var err error
+		if dnsTLS, err = dns.NewTLSConfig(dnsTLSServerName, dnsTLSCAFile); err != nil {
+			fatal(err)
+		}
+	}
+	upstream, srv, err := newResolver(resolverName, hostsFile, []string(dnsServers), dnsTLS)
+	if err != nil {
+		fatal(err)
+	}
+	clusterCIDRsFlag := func() ([]string, error) {
+		if len(clusterCIDRs) == 0 {
+			return nil, errors.New("set --cluster-cidrs to use the cluster-cidrs preset")
+		}
+		return clusterCIDRs, nil
+	}
+	blacklist, err := dns.ExpandPresets(ipBlacklist, clusterCIDRsFlag)
+	if err != nil {
+		fatal(fmt.Errorf("invalid IP blacklist: %w", err))
+	}
+	whitelist, err := dns.ExpandPresets(ipWhitelist, clusterCIDRsFlag)
+	if err != nil {
+		fatal(fmt.Errorf("invalid IP whitelist: %w", err))
+	}
+	ipFilter, err := dns.NewIPFilter(whitelist, blacklist)
+	if err != nil {
+		fatal(fmt.Errorf("invalid IP filter configuration: %w", err))
+	}
+	resolver := &dns.FilteringResolver{
+		Inner:  upstream,
+		Filter: ipFilter,
+		Logger: logr.Discard(),
+	}
+
+	defaultFamilies, err := dns.ParseIPFamilies([]string(ipFamilies))
+	if err != nil {
+		fatal(err)
+	}
+
+	manifests, err := readManifests(flag.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out := bufio.NewWriter(os.Stdout)
+	failed := false
+	for i := range manifests.policies {
+		anp := &manifests.policies[i]
+		if anp.Namespace == "" {
+			anp.Namespace = namespace
+		}
+
+		sets, missing := manifests.hostnameSetsFor(anp, namespace)
+		for _, ref := range missing {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s/%s: %s %q not found in the input\n", anp.Namespace, anp.Name, ref.Kind, ref.Name)
+		}
+		externalNames, missingServices := manifests.externalNamesFor(anp, namespace)
+		for _, name := range missingServices {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s/%s: ExternalName Service %q not found in the input\n", anp.Namespace, anp.Name, name)
+		}
+		spec := render.ExpandServiceRefs(render.ExpandHostnameSets(&anp.Spec, sets), externalNames)
+		spec = render.WithDefaultIPFamilies(spec, defaultFamilies)
+		np, report := render.Render(spec, render.Resolve(ctx, resolver, srv, spec))
+		for _, err := range report.Errors {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s/%s: %v\n", anp.Namespace, anp.Name, err)
+		}
+		for _, idx := range report.DroppedRules {
+			fmt.Fprintf(os.Stderr, "%s/%s: egress rule %d omitted: no hostname resolved to an allowed address\n",
+				anp.Namespace, anp.Name, idx)
+		}
+
+		np.Name = anp.Name
+		np.Namespace = anp.Namespace
+		np.TypeMeta.APIVersion = networkingv1.SchemeGroupVersion.String()
+		np.TypeMeta.Kind = "NetworkPolicy"
+
+		data, err := yaml.Marshal(np)
+		if err != nil {
+			fatal(fmt.Errorf("marshaling %s/%s: %w", anp.Namespace, anp.Name, err))
+		}
+		if i > 0 {
+			_, _ = fmt.Fprintln(out, "---")
+		}
+		_, _ = out.Write(data)
+	}
+	if err := out.Flush(); err != nil {
+		fatal(err)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// newResolver returns the named resolver and, if it supports them, an SRV resolver. If
+// tlsConfig is set, the wire and validating resolvers query servers over DNS over TLS.
+func newResolver(
+	name, hostsFile string, servers []string, tlsConfig *tls.Config,
+) (dns.Resolver, dns.SRVResolver, error) {
+	if tlsConfig != nil && name != "wire" && name != "validating" {
+		return nil, nil, errors.New("--dns-over-tls requires --resolver=wire or --resolver=validating")
+	}
+	switch name {
+	case "system":
+		r := dns.NewNetResolver()
+		return r, r, nil
+	case "wire", "validating":
+		if tlsConfig != nil && len(servers) == 0 {
+			return nil, nil, errors.New("--dns-over-tls requires --dns-servers")
+		}
+		if len(servers) == 0 {
+			var err error
+			if servers, err = dns.ServersFromResolvConf("/etc/resolv.conf"); err != nil {
+				return nil, nil, err
+			}
+		}
+		if name == "wire" {
+			r := dns.NewWireResolver(servers)
+			r.TLS = tlsConfig
+			return r, r, nil
+		}
+		r, err := dns.NewValidatingResolver(servers, tlsConfig, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r, nil
+	case "hosts":
+		if hostsFile == "" {
+			return nil, nil, errors.New("--hosts-file is required with --resolver=hosts")
+		}
+		f, err := os.Open(hostsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r, err := dns.NewHostsResolver(f)
+		return r, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown resolver %q", name)
+	}
+}
+
+// manifests holds the documents read from the input that anp-render uses.
+type manifests struct {
+	policies            []networkingv1alpha1.NetworkPolicy
+	hostnameSets        []networkingv1alpha1.HostnameSet
+	clusterHostnameSets []networkingv1alpha1.ClusterHostnameSet
+	services            []corev1.Service
+}
+
+// hostnameSetsFor returns the hostnames of the sets referenced by anp, and the references
+// to sets missing from the input. Sets without a namespace are in defaultNamespace.
+func (m *manifests) hostnameSetsFor(
+	anp *networkingv1alpha1.NetworkPolicy, defaultNamespace string,
+) (map[networkingv1alpha1.HostnameSetReference][]string, []networkingv1alpha1.HostnameSetReference) {
+	sets := make(map[networkingv1alpha1.HostnameSetReference][]string)
+	var missing []networkingv1alpha1.HostnameSetReference
+	for _, ref := range render.HostnameSetRefs(&anp.Spec) {
+		found := false
+		if ref.Kind == networkingv1alpha1.ClusterHostnameSetKind {
+			for _, set := range m.clusterHostnameSets {
+				if set.Name == ref.Name {
+					sets[ref], found = set.Spec.Hostnames, true
+				}
+			}
+		} else {
+			for _, set := range m.hostnameSets {
+				setNamespace := set.Namespace
+				if setNamespace == "" {
+					setNamespace = defaultNamespace
+				}
+				if set.Name == ref.Name && setNamespace == anp.Namespace {
+					sets[ref], found = set.Spec.Hostnames, true
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, ref)
+		}
+	}
+	return sets, missing
+}
+
+// externalNamesFor returns the external names of the Services referenced by anp, and the
+// names of the referenced Services missing from the input or not of type ExternalName.
+// Services without a namespace are in defaultNamespace.
+func (m *manifests) externalNamesFor(anp *networkingv1alpha1.NetworkPolicy, defaultNamespace string) (map[string]string, []string) {
+	externalNames := make(map[string]string)
+	var missing []string
+	for _, name := range render.ServiceRefs(&anp.Spec) {
+		for _, svc := range m.services {
+			svcNamespace := svc.Namespace
+			if svcNamespace == "" {
+				svcNamespace = defaultNamespace
+			}
+			if svc.Name == name && svcNamespace == anp.Namespace && svc.Spec.Type == corev1.ServiceTypeExternalName {
+				externalNames[name] = svc.Spec.ExternalName
+			}
+		}
+		if externalNames[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	return externalNames, missing
+}
+
+// readManifests decodes every augmented NetworkPolicy, hostname set and Service document from the given files.
+func readManifests(files []string) (*manifests, error) {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	m := &manifests{}
+	for _, name := range files {
+		if err := m.readFile(name); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// readFile decodes the documents of the file name, or of stdin if name is "-".
+func (m *manifests) readFile(name string) error {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	if err := m.decode(r); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	return nil
+}
+
+func (m *manifests) decode(r io.Reader) error {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(raw, &typeMeta); err != nil {
+			return err
+		}
+		if typeMeta.APIVersion == "v1" && typeMeta.Kind == "Service" {
+			var svc corev1.Service
+			if err := json.Unmarshal(raw, &svc); err != nil {
+				return err
+			}
+			m.services = append(m.services, svc)
+			continue
+		}
+		if typeMeta.GroupVersionKind().GroupVersion() != networkingv1alpha1.GroupVersion {
+			continue
+		}
+
+		var err error
+		switch typeMeta.Kind {
+		case "NetworkPolicy":
+			var anp networkingv1alpha1.NetworkPolicy
+			if err = json.Unmarshal(raw, &anp); err == nil {
+				m.policies = append(m.policies, anp)
+			}
+		case networkingv1alpha1.HostnameSetKind:
+			var set networkingv1alpha1.HostnameSet
+			if err = json.Unmarshal(raw, &set); err == nil {
+				m.hostnameSets = append(m.hostnameSets, set)
+			}
+		case networkingv1alpha1.ClusterHostnameSetKind:
+			var set networkingv1alpha1.ClusterHostnameSet
+			if err = json.Unmarshal(raw, &set); err == nil {
+				m.clusterHostnameSets = append(m.clusterHostnameSets, set)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "anp-render: %v\n", err)
+	os.Exit(1)
+}
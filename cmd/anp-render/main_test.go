@@ -0,0 +1,195 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		wantPolicies    []string
+		wantSets        int
+		wantClusterSets int
+		wantSvcs        int
+		wantErr         bool
+	}{
+		{
+			name: "yaml documents",
+			input: `apiVersion: networking.ayoy.se/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: a
+---
+apiVersion: networking.ayoy.se/v1alpha1
+kind: HostnameSet
+metadata:
+  name: set
+---
+apiVersion: networking.ayoy.se/v1alpha1
+kind: ClusterHostnameSet
+metadata:
+  name: cluster-set
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+`,
+			wantPolicies:    []string{"a"},
+			wantSets:        1,
+			wantClusterSets: 1,
+			wantSvcs:        1,
+		},
+		{
+			name:         "json",
+			input:        `{"apiVersion": "networking.ayoy.se/v1alpha1", "kind": "NetworkPolicy", "metadata": {"name": "b"}}`,
+			wantPolicies: []string{"b"},
+		},
+		{
+			name: "other kinds are ignored",
+			input: `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: native
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`,
+		},
+		{
+			name:    "malformed document",
+			input:   "apiVersion: networking.ayoy.se/v1alpha1\nkind: NetworkPolicy\nspec: [\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid field type",
+			input:   `{"apiVersion": "networking.ayoy.se/v1alpha1", "kind": "NetworkPolicy", "spec": {"egress": "all"}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &manifests{}
+			err := m.decode(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var names []string
+			for _, p := range m.policies {
+				names = append(names, p.Name)
+			}
+			if !slices.Equal(names, tt.wantPolicies) {
+				t.Errorf("policies = %v, want %v", names, tt.wantPolicies)
+			}
+			if len(m.hostnameSets) != tt.wantSets || len(m.clusterHostnameSets) != tt.wantClusterSets ||
+				len(m.services) != tt.wantSvcs {
+				t.Errorf("got %d HostnameSets, %d ClusterHostnameSets and %d Services, want %d, %d and %d",
+					len(m.hostnameSets), len(m.clusterHostnameSets), len(m.services),
+					tt.wantSets, tt.wantClusterSets, tt.wantSvcs)
+			}
+		})
+	}
+}
+
+func TestReadManifests(t *testing.T) {
+	m, err := readManifests([]string{"testdata/policies.yaml", "testdata/references.yaml"})
+	if err != nil {
+		t.Fatalf("readManifests() error = %v", err)
+	}
+	if len(m.policies) != 2 || len(m.hostnameSets) != 2 || len(m.clusterHostnameSets) != 1 || len(m.services) != 2 {
+		t.Fatalf("readManifests() = %d policies, %d HostnameSets, %d ClusterHostnameSets, %d Services",
+			len(m.policies), len(m.hostnameSets), len(m.clusterHostnameSets), len(m.services))
+	}
+
+	if _, err := readManifests([]string{"testdata/policies.yaml", "testdata/missing.yaml"}); err == nil {
+		t.Error("readManifests() of a missing file succeeded")
+	}
+}
+
+func TestReferenceExpansion(t *testing.T) {
+	m, err := readManifests([]string{"testdata/policies.yaml", "testdata/references.yaml"})
+	if err != nil {
+		t.Fatalf("readManifests() error = %v", err)
+	}
+	setRef := func(kind, name string) networkingv1alpha1.HostnameSetReference {
+		return networkingv1alpha1.HostnameSetReference{Kind: kind, Name: name}
+	}
+
+	tests := []struct {
+		policy             string
+		wantSets           map[networkingv1alpha1.HostnameSetReference][]string
+		wantMissingSets    []networkingv1alpha1.HostnameSetReference
+		wantExternalNames  map[string]string
+		wantMissingService []string
+	}{
+		{
+			policy: "vendors",
+			wantSets: map[networkingv1alpha1.HostnameSetReference][]string{
+				setRef(networkingv1alpha1.HostnameSetKind, "payment-providers"): {"api.stripe.com", "api.adyen.com"},
+				setRef(networkingv1alpha1.ClusterHostnameSetKind, "monitoring"): {"metrics.example.com"},
+			},
+			wantMissingSets:    []networkingv1alpha1.HostnameSetReference{setRef(networkingv1alpha1.HostnameSetKind, "missing")},
+			wantExternalNames:  map[string]string{"payments-api": "payments.example.net"},
+			wantMissingService: []string{"internal", "missing"},
+		},
+		{
+			policy: "other-namespace",
+			wantSets: map[networkingv1alpha1.HostnameSetReference][]string{
+				setRef(networkingv1alpha1.HostnameSetKind, "payment-providers"): {"pay.example.com"},
+			},
+			wantExternalNames: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			i := slices.IndexFunc(m.policies, func(p networkingv1alpha1.NetworkPolicy) bool { return p.Name == tt.policy })
+			anp := &m.policies[i]
+			if anp.Namespace == "" {
+				anp.Namespace = "default"
+			}
+
+			sets, missing := m.hostnameSetsFor(anp, "default")
+			if !maps.EqualFunc(sets, tt.wantSets, slices.Equal) {
+				t.Errorf("hostnameSetsFor() sets = %v, want %v", sets, tt.wantSets)
+			}
+			if !slices.Equal(missing, tt.wantMissingSets) {
+				t.Errorf("hostnameSetsFor() missing = %v, want %v", missing, tt.wantMissingSets)
+			}
+
+			externalNames, missingServices := m.externalNamesFor(anp, "default")
+			if !maps.Equal(externalNames, tt.wantExternalNames) {
+				t.Errorf("externalNamesFor() = %v, want %v", externalNames, tt.wantExternalNames)
+			}
+			if !slices.Equal(missingServices, tt.wantMissingService) {
+				t.Errorf("externalNamesFor() missing = %v, want %v", missingServices, tt.wantMissingService)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// errDifferent is returned by runDiff when the policies differ, so the plugin can exit 1 like diff.
+var errDifferent = errors.New("policies differ")
+
+// runDiff compares the NetworkPolicy spec expected from the augmented policy's spec and
+// recorded resolutions with the generated NetworkPolicy in the cluster. Like kubectl diff,
+// it uses $KUBECTL_EXTERNAL_DIFF when set, and "diff -u" otherwise.
+func runDiff(ctx context.Context, e *env, args []string) error {
+	anp, err := e.getPolicy(ctx, args)
+	if err != nil {
+		return err
+	}
+	if err := e.expandReferences(ctx, anp); err != nil {
+		return err
+	}
+
+	expected, _ := render.Render(&anp.Spec, render.FromStatus(&anp.Status))
+
+	var generated networkingv1.NetworkPolicySpec
+	var live networkingv1.NetworkPolicy
+	err = e.client.Get(ctx, client.ObjectKeyFromObject(anp), &live)
+	switch {
+	case apierrors.IsNotFound(err):
+		_, _ = fmt.Fprintf(os.Stderr, "no generated NetworkPolicy %s/%s found (mode %s)\n",
+			anp.Namespace, anp.Name, orNone(string(anp.Status.Mode)))
+	case err != nil:
+		return err
+	default:
+		generated = live.Spec
+	}
+
+	dir, err := os.MkdirTemp("", "kubectl-anp-diff-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	generatedPath := filepath.Join(dir, "generated", anp.Name+".yaml")
+	expectedPath := filepath.Join(dir, "augmented", anp.Name+".yaml")
+	if err := writeYAML(generatedPath, generated); err != nil {
+		return err
+	}
+	if err := writeYAML(expectedPath, expected.Spec); err != nil {
+		return err
+	}
+
+	diffCmd := []string{"diff", "-u", "-N"}
+	if external := os.Getenv("KUBECTL_EXTERNAL_DIFF"); external != "" {
+		diffCmd = strings.Fields(external)
+	}
+	cmd := exec.CommandContext(ctx, diffCmd[0], append(diffCmd[1:], generatedPath, expectedPath)...)
+	cmd.Stdout = e.out
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+
+	// diff exits 1 when the inputs differ.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return errDifferent
+	}
+	return err
+}
+
+func writeYAML(path string, obj any) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
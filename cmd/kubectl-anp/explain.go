@@ -0,0 +1,173 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+func runExplain(ctx context.Context, e *env, args []string) error {
+	anp, err := e.getPolicy(ctx, args)
+	if err != nil {
+		return err
+	}
+	if err := e.expandReferences(ctx, anp); err != nil {
+		return err
+	}
+	explain(e.out, anp)
+	return nil
+}
+
+// explain describes, per egress rule, which hostnames yielded which peers and which
+// addresses were filtered or failed to resolve, based on the policy's last recorded status.
+func explain(out io.Writer, anp *networkingv1alpha1.NetworkPolicy) {
+	resolutions := render.FromStatus(&anp.Status)
+	_, report := render.Render(&anp.Spec, resolutions)
+
+	_, _ = fmt.Fprintf(out, "Policy %s/%s (mode %s)\n", anp.Namespace, anp.Name, orNone(string(anp.Status.Mode)))
+	if len(anp.Status.Rules) == 0 && len(anp.Spec.Egress) > 0 {
+		_, _ = fmt.Fprintln(out, "\nThe policy has not been reconciled yet; no resolution detail is available.")
+		return
+	}
+
+	for i, rule := range anp.Spec.Egress {
+		_, _ = fmt.Fprintf(out, "\nRule %d (ports: %s)\n", i, formatPorts(rule.Ports))
+		if len(rule.To) == 0 {
+			_, _ = fmt.Fprintln(out, "  => no peers: allows all destinations on these ports")
+			continue
+		}
+
+		peers := make(map[string]bool)
+		for _, to := range rule.To {
+			name := render.PeerName(to)
+			res, ok := resolutions[name]
+			switch {
+			case to.HostnameSetRef != nil:
+				_, _ = fmt.Fprintf(out, "  %s %s\n    error    not found\n", to.HostnameSetRef.Kind, to.HostnameSetRef.Name)
+				continue
+			case to.ServiceRef != nil:
+				_, _ = fmt.Fprintf(out, "  Service %s\n    error    not found or not of type ExternalName\n", to.ServiceRef.Name)
+				continue
+			case !ok:
+				_, _ = fmt.Fprintf(out, "  %s\n    pending  not resolved yet\n", name)
+				continue
+			case res.Err != nil:
+				_, _ = fmt.Fprintf(out, "  %s\n    error    %v\n", name, res.Err)
+				continue
+			case to.SRV != "":
+				explainSRV(out, to.SRV, res, resolutions, peers)
+				continue
+			}
+
+			_, _ = fmt.Fprintf(out, "  %s (resolver %s)\n", name, orNone(res.Resolver))
+			if res.DNSSEC != "" {
+				_, _ = fmt.Fprintf(out, "    dnssec   %s\n", res.DNSSEC)
+			}
+			explainQuarantine(out, "    ", res)
+			if len(res.CNAMEChain) > 0 {
+				_, _ = fmt.Fprintf(out, "    cname    %s\n", strings.Join(res.CNAMEChain, " -> "))
+			}
+			explainAddresses(out, "    ", res, "", peers)
+		}
+
+		if slices.Contains(report.DroppedRules, i) {
+			_, _ = fmt.Fprintln(out,
+				"  => omitted: no hostname resolved to an allowed address (an empty peer list would allow all destinations)")
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "  => %d peer(s)\n", len(peers))
+	}
+}
+
+// explainSRV describes the targets of an SRV peer, each rendered as its own port.
+func explainSRV(out io.Writer, name string, res render.Resolution, resolutions render.Resolutions, peers map[string]bool) {
+	_, _ = fmt.Fprintf(out, "  %s (SRV)\n", name)
+	if len(res.SRV) == 0 {
+		_, _ = fmt.Fprintln(out, "    empty    no SRV targets")
+	}
+	protocol := dns.SRVProtocol(name)
+	for _, target := range res.SRV {
+		port := fmt.Sprintf("%s/%d", protocol, target.Port)
+		tres, ok := resolutions[target.Target]
+		switch {
+		case !ok:
+			_, _ = fmt.Fprintf(out, "    %s:%d\n      pending  not resolved yet\n", target.Target, target.Port)
+		case tres.Err != nil:
+			_, _ = fmt.Fprintf(out, "    %s:%d\n      error    %v\n", target.Target, target.Port, tres.Err)
+		default:
+			_, _ = fmt.Fprintf(out, "    %s:%d\n", target.Target, target.Port)
+			explainQuarantine(out, "      ", tres)
+			explainAddresses(out, "      ", tres, "  on "+port, peers)
+		}
+	}
+}
+
+// explainQuarantine notes that the addresses of a quarantined resolution are frozen.
+func explainQuarantine(out io.Writer, indent string, res render.Resolution) {
+	if res.Quarantine != "" {
+		_, _ = fmt.Fprintf(out, "%squarantined (%s)  addresses frozen until acknowledged\n", indent, res.Quarantine)
+	}
+}
+
+// explainAddresses lists the allowed and filtered addresses of a resolution, recording allowed ones in peers.
+func explainAddresses(out io.Writer, indent string, res render.Resolution, suffix string, peers map[string]bool) {
+	for _, cidr := range res.Addresses {
+		peers[cidr] = true
+		_, _ = fmt.Fprintf(out, "%sallow    %s%s\n", indent, cidr, suffix)
+	}
+	for _, cidr := range res.Filtered {
+		_, _ = fmt.Fprintf(out, "%sfilter   %s  removed by the operator's IP filter\n", indent, cidr)
+	}
+	for _, family := range res.DroppedFamilies {
+		_, _ = fmt.Fprintf(out, "%sdrop     %s addresses  excluded by the peer's ipFamilies\n", indent, family)
+	}
+	if len(res.Addresses) == 0 && len(res.Filtered) == 0 && len(res.DroppedFamilies) == 0 {
+		_, _ = fmt.Fprintf(out, "%sempty    resolved to no addresses\n", indent)
+	}
+}
+
+func formatPorts(ports []networkingv1alpha1.NetworkPolicyPort) string {
+	if len(ports) == 0 {
+		return "any"
+	}
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		proto := "TCP"
+		if p.Protocol != nil {
+			proto = string(*p.Protocol)
+		}
+		port := "*"
+		if p.Port != nil {
+			port = p.Port.String()
+			if p.EndPort != nil && p.Port.Type == intstr.Int {
+				port = fmt.Sprintf("%s-%d", port, *p.EndPort)
+			}
+		}
+		parts = append(parts, proto+"/"+port)
+	}
+	return strings.Join(parts, ", ")
+}
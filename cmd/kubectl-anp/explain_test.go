@@ -0,0 +1,141 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+func TestExplain(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	port443 := intstr.FromInt32(443)
+	anp := &networkingv1alpha1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: networkingv1alpha1.NetworkPolicySpec{
+			Egress: []networkingv1alpha1.EgressRule{
+				{
+					Ports: []networkingv1alpha1.NetworkPolicyPort{{Protocol: &tcp, Port: &port443}},
+					To: []networkingv1alpha1.EgressPeer{
+						{Hostname: "api.example.com"},
+						{Hostname: "missing.example.com"},
+					},
+				},
+				{
+					To: []networkingv1alpha1.EgressPeer{
+						{Hostname: "missing.example.com"},
+						{HostnameSetRef: &networkingv1alpha1.HostnameSetReference{
+							Kind: networkingv1alpha1.HostnameSetKind, Name: "vendors",
+						}},
+					},
+				},
+			},
+		},
+		Status: networkingv1alpha1.NetworkPolicyStatus{
+			Mode: networkingv1alpha1.PolicyModeEnforce,
+			Rules: []networkingv1alpha1.EgressRuleStatus{
+				{Index: 0, Hostnames: []networkingv1alpha1.HostnameStatus{
+					{
+						Hostname:          "api.example.com",
+						Addresses:         []string{"93.184.216.34/32"},
+						FilteredAddresses: []string{"127.0.0.1/32"},
+						Resolver:          "system",
+						CNAMEChain:        []string{"api.example-cdn.net"},
+						DroppedFamilies:   []corev1.IPFamily{corev1.IPv6Protocol},
+						DNSSEC:            "Secure",
+						Quarantine:        "ScopeChange",
+					},
+					{Hostname: "missing.example.com", LastError: "no such host"},
+				}},
+				{Index: 1, Hostnames: []networkingv1alpha1.HostnameStatus{
+					{Hostname: "missing.example.com", LastError: "no such host"},
+				}},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	explain(&out, anp)
+	got := out.String()
+
+	for _, want := range []string{
+		"Rule 0 (ports: TCP/443)",
+		"api.example.com (resolver system)",
+		"allow    93.184.216.34/32",
+		"cname    api.example-cdn.net",
+		"dnssec   Secure",
+		"quarantined (ScopeChange)  addresses frozen until acknowledged",
+		"drop     IPv6 addresses  excluded by the peer's ipFamilies",
+		"filter   127.0.0.1/32  removed by the operator's IP filter",
+		"error    no such host",
+		"=> 1 peer(s)",
+		"Rule 1 (ports: any)",
+		"HostnameSet vendors\n    error    not found",
+		"=> omitted: no hostname resolved to an allowed address",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("explain() output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestExplain_SRV(t *testing.T) {
+	anp := &networkingv1alpha1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "ldap", Namespace: "default"},
+		Spec: networkingv1alpha1.NetworkPolicySpec{
+			Egress: []networkingv1alpha1.EgressRule{
+				{To: []networkingv1alpha1.EgressPeer{{SRV: "_ldap._tcp.corp.example"}}},
+			},
+		},
+		Status: networkingv1alpha1.NetworkPolicyStatus{
+			Rules: []networkingv1alpha1.EgressRuleStatus{
+				{Index: 0, Hostnames: []networkingv1alpha1.HostnameStatus{{
+					Hostname: "_ldap._tcp.corp.example",
+					SRV:      true,
+					Targets: []networkingv1alpha1.SRVTargetStatus{
+						{Target: "ldap1.corp.example", Port: 389, Addresses: []string{"10.0.0.1/32"}},
+						{Target: "ldap2.corp.example", Port: 636, LastError: "no such host"},
+					},
+				}}},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	explain(&out, anp)
+	got := out.String()
+
+	for _, want := range []string{
+		"_ldap._tcp.corp.example (SRV)",
+		"ldap1.corp.example:389",
+		"allow    10.0.0.1/32  on TCP/389",
+		"ldap2.corp.example:636",
+		"error    no such host",
+		"=> 1 peer(s)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("explain() output missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-anp is a kubectl plugin for inspecting augmented NetworkPolicies.
+//
+// Install it on the PATH and invoke it as "kubectl anp <command>":
+//
+//	status [NAME]      summarize policies, or show per-hostname detail for one policy
+//	explain NAME       show which hostnames yield which peers, and what was filtered and why
+//	resolve-now NAME   trigger an immediate re-resolution
+//	diff NAME          diff the policy expected from status against the generated NetworkPolicy
+//	simulate DEST PORT [KEY=VALUE...]
+//	                   check whether pods with the given labels may connect to DEST on PORT
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+const usage = `Usage: kubectl anp [flags] <command> [args]
+
+Commands:
+  status [NAME]      Summarize policies, or show per-hostname detail for one policy
+  explain NAME       Show which hostnames yield which peers, and what was filtered and why
+  resolve-now NAME   Trigger an immediate re-resolution of NAME's hostnames
+  diff NAME          Diff the policy expected from status against the generated NetworkPolicy
+  simulate DESTINATION PORT[/PROTOCOL] [KEY=VALUE...]
+                     Check whether pods with the given labels may connect to a hostname or IP
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(networkingv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(corev1.AddToScheme(scheme))
+}
+
+// env holds what every command needs to talk to the cluster.
+type env struct {
+	client    client.Client
+	namespace string
+	out       io.Writer
+}
+
+func main() {
+	flags := pflag.NewFlagSet("kubectl-anp", pflag.ExitOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file to use.")
+	kubeContext := flags.String("context", "", "The name of the kubeconfig context to use.")
+	namespace := flags.StringP("namespace", "n", "", "Namespace of the policy (defaults to the context's namespace).")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	e, err := newEnv(*kubeconfig, *kubeContext, *namespace)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	command, args := args[0], args[1:]
+	switch command {
+	case "status":
+		err = runStatus(ctx, e, args)
+	case "explain":
+		err = runExplain(ctx, e, args)
+	case "resolve-now":
+		err = runResolveNow(ctx, e, args)
+	case "diff":
+		err = runDiff(ctx, e, args)
+	case "simulate":
+		err = runSimulate(ctx, e, args)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if errors.Is(err, errDifferent) || errors.Is(err, errDenied) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func newEnv(kubeconfig, kubeContext, namespace string) (*env, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	cfg := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	})
+
+	restConfig, err := cfg.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	if namespace == "" {
+		namespace, _, err = cfg.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("determining namespace: %w", err)
+		}
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	return &env{client: c, namespace: namespace, out: os.Stdout}, nil
+}
+
+// getPolicy fetches the named augmented NetworkPolicy from args, which must hold exactly one name.
+func (e *env) getPolicy(ctx context.Context, args []string) (*networkingv1alpha1.NetworkPolicy, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected exactly one policy name, got %d", len(args))
+	}
+	var anp networkingv1alpha1.NetworkPolicy
+	if err := e.client.Get(ctx, client.ObjectKey{Namespace: e.namespace, Name: args[0]}, &anp); err != nil {
+		return nil, err
+	}
+	return &anp, nil
+}
+
+// expandReferences replaces the peers of anp that reference a hostname set or a Service
+// with the set's hostnames or the Service's external name. Peers referencing an object
+// that does not exist are kept.
+func (e *env) expandReferences(ctx context.Context, anp *networkingv1alpha1.NetworkPolicy) error {
+	sets := make(map[networkingv1alpha1.HostnameSetReference][]string)
+	for _, ref := range render.HostnameSetRefs(&anp.Spec) {
+		var spec networkingv1alpha1.HostnameSetSpec
+		var err error
+		if ref.Kind == networkingv1alpha1.ClusterHostnameSetKind {
+			var set networkingv1alpha1.ClusterHostnameSet
+			err = e.client.Get(ctx, client.ObjectKey{Name: ref.Name}, &set)
+			spec = set.Spec
+		} else {
+			var set networkingv1alpha1.HostnameSet
+			err = e.client.Get(ctx, client.ObjectKey{Namespace: anp.Namespace, Name: ref.Name}, &set)
+			spec = set.Spec
+		}
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return err
+		default:
+			sets[ref] = spec.Hostnames
+		}
+	}
+
+	externalNames := make(map[string]string)
+	for _, name := range render.ServiceRefs(&anp.Spec) {
+		var svc corev1.Service
+		err := e.client.Get(ctx, client.ObjectKey{Namespace: anp.Namespace, Name: name}, &svc)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return err
+		case svc.Spec.Type == corev1.ServiceTypeExternalName:
+			externalNames[name] = svc.Spec.ExternalName
+		}
+	}
+	anp.Spec = *render.ExpandServiceRefs(render.ExpandHostnameSets(&anp.Spec, sets), externalNames)
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
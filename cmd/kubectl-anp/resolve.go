@@ -0,0 +1,48 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+// runResolveNow sets the resolve-now annotation to the current time, which the
+// controller treats as a request for immediate re-resolution.
+func runResolveNow(ctx context.Context, e *env, args []string) error {
+	anp, err := e.getPolicy(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(anp.DeepCopy())
+	if anp.Annotations == nil {
+		anp.Annotations = make(map[string]string)
+	}
+	anp.Annotations[networkingv1alpha1.ResolveNowAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	if err := e.client.Patch(ctx, anp, patch); err != nil {
+		return fmt.Errorf("annotating %s/%s: %w", anp.Namespace, anp.Name, err)
+	}
+
+	_, _ = fmt.Fprintf(e.out, "networkpolicy.networking.ayoy.se/%s re-resolution requested\n", anp.Name)
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/simulate"
+)
+
+// errDenied is returned by runSimulate if the connection is not allowed, so that the
+// plugin exits with a non-zero status.
+var errDenied = errors.New("connection not allowed")
+
+// runSimulate evaluates whether pods with the given labels may connect to a destination.
+// Its arguments are DESTINATION PORT[/PROTOCOL] followed by the pod's labels as KEY=VALUE.
+func runSimulate(ctx context.Context, e *env, args []string) error {
+	req, err := parseSimulateArgs(e.namespace, args)
+	if err != nil {
+		return err
+	}
+	result, err := simulate.Simulate(ctx, e.client, req)
+	if err != nil {
+		return err
+	}
+	printSimulation(e.out, req, result)
+	if !result.Allowed {
+		return errDenied
+	}
+	return nil
+}
+
+func parseSimulateArgs(namespace string, args []string) (simulate.Request, error) {
+	req := simulate.Request{Namespace: namespace}
+	if len(args) < 2 {
+		return req, fmt.Errorf("expected DESTINATION PORT[/PROTOCOL] [KEY=VALUE...], got %d arguments", len(args))
+	}
+	req.Destination = args[0]
+	port, protocol, _ := strings.Cut(args[1], "/")
+	n, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return req, fmt.Errorf("invalid port %q", port)
+	}
+	req.Port = int32(n)
+	req.Protocol = corev1.Protocol(strings.ToUpper(protocol))
+	if len(args) > 2 {
+		podLabels, err := labels.ConvertSelectorToLabelsMap(strings.Join(args[2:], ","))
+		if err != nil {
+			return req, fmt.Errorf("invalid pod labels: %w", err)
+		}
+		req.PodLabels = podLabels
+	}
+	return req, nil
+}
+
+// printSimulation prints the verdict, followed by the outcome per address and the rules
+// that allow it.
+func printSimulation(out io.Writer, req simulate.Request, result *simulate.Result) {
+	verdict := "DENIED"
+	if result.Allowed {
+		verdict = "ALLOWED"
+	}
+	pods := "all pods"
+	if len(req.PodLabels) > 0 {
+		pods = "pods with " + labels.Set(req.PodLabels).String()
+	}
+	protocol := req.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+	_, _ = fmt.Fprintf(out, "%s  %s:%d/%s from %s in %s\n", verdict, req.Destination, req.Port, protocol, pods, req.Namespace)
+	_, _ = fmt.Fprintf(out, "  %s\n", result.Reason)
+	if len(result.Policies) > 0 {
+		_, _ = fmt.Fprintf(out, "  egress restricted by: %s\n", strings.Join(result.Policies, ", "))
+	}
+
+	for _, ar := range result.Addresses {
+		status := "denied"
+		if ar.Allowed {
+			status = "allowed"
+		}
+		_, _ = fmt.Fprintf(out, "\n  %s\n    %s\n", ar.Address, status)
+		for _, m := range ar.Matches {
+			peer := "all destinations"
+			if m.CIDR != "" {
+				peer = m.CIDR
+			}
+			_, _ = fmt.Fprintf(out, "    %s rule %d: %s", m.NetworkPolicy, m.Rule, peer)
+			if len(m.Hostnames) > 0 {
+				_, _ = fmt.Fprintf(out, " (%s)", strings.Join(m.Hostnames, ", "))
+			}
+			if len(m.Sources) > 0 {
+				_, _ = fmt.Fprintf(out, " from %s", strings.Join(m.Sources, ", "))
+			}
+			_, _ = fmt.Fprintln(out)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/simulate"
+)
+
+func TestParseSimulateArgs(t *testing.T) {
+	req, err := parseSimulateArgs("shop", []string{"api.example.com", "53/udp", "app=web", "tier=frontend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Namespace != "shop" || req.Destination != "api.example.com" || req.Port != 53 ||
+		req.Protocol != corev1.ProtocolUDP || req.PodLabels["app"] != "web" || req.PodLabels["tier"] != "frontend" {
+		t.Errorf("parseSimulateArgs() = %+v", req)
+	}
+
+	for _, args := range [][]string{
+		{"api.example.com"},
+		{"api.example.com", "https"},
+		{"api.example.com", "443", "app"},
+	} {
+		if _, err := parseSimulateArgs("shop", args); err == nil {
+			t.Errorf("parseSimulateArgs(%q) succeeded, want error", args)
+		}
+	}
+}
+
+func TestPrintSimulation(t *testing.T) {
+	req := simulate.Request{
+		Namespace: "shop", PodLabels: map[string]string{"app": "web"}, Destination: "api.example.com", Port: 443,
+	}
+	result := &simulate.Result{
+		Reason:   "1 of 2 addresses are not allowed by the NetworkPolicies selecting the pod",
+		Isolated: true,
+		Policies: []string{"api"},
+		Addresses: []simulate.AddressResult{
+			{Address: "192.0.2.10", Allowed: true, Matches: []simulate.RuleMatch{{
+				NetworkPolicy: "api", Rule: 0, CIDR: "192.0.2.10/32", Sources: []string{"api"}, Hostnames: []string{"api.example.com"},
+			}}},
+			{Address: "192.0.2.11"},
+		},
+	}
+
+	var out bytes.Buffer
+	printSimulation(&out, req, result)
+	want := `DENIED  api.example.com:443/TCP from pods with app=web in shop
+  1 of 2 addresses are not allowed by the NetworkPolicies selecting the pod
+  egress restricted by: api
+
+  192.0.2.10
+    allowed
+    api rule 0: 192.0.2.10/32 (api.example.com) from api
+
+  192.0.2.11
+    denied
+`
+	if got := out.String(); got != want {
+		t.Errorf("printSimulation() =\n%s\nwant\n%s", got, want)
+	}
+}
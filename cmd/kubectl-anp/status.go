@@ -0,0 +1,131 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+func runStatus(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		var list networkingv1alpha1.NetworkPolicyList
+		if err := e.client.List(ctx, &list, client.InNamespace(e.namespace)); err != nil {
+			return err
+		}
+		return printStatusTable(e.out, list.Items, time.Now())
+	}
+
+	anp, err := e.getPolicy(ctx, args)
+	if err != nil {
+		return err
+	}
+	return printStatusDetail(e.out, anp, time.Now())
+}
+
+// printStatusTable prints one summary line per policy.
+func printStatusTable(out io.Writer, policies []networkingv1alpha1.NetworkPolicy, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tREADY\tREASON\tMODE\tHOSTNAMES\tADDRESSES\tFAILING\tLAST RESOLVED")
+	for i := range policies {
+		anp := &policies[i]
+		ready, reason := readyCondition(anp)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			anp.Name, ready, reason, anp.Status.Mode,
+			anp.Status.HostnameCount, anp.Status.AddressCount, len(failingHostnames(anp)),
+			age(anp.Status.LastResolvedTime, now))
+	}
+	return w.Flush()
+}
+
+// printStatusDetail prints the conditions and per-hostname resolution state of a policy.
+func printStatusDetail(out io.Writer, anp *networkingv1alpha1.NetworkPolicy, now time.Time) error {
+	ready, reason := readyCondition(anp)
+	_, _ = fmt.Fprintf(out, "Policy:         %s/%s\n", anp.Namespace, anp.Name)
+	_, _ = fmt.Fprintf(out, "Mode:           %s\n", anp.Status.Mode)
+	_, _ = fmt.Fprintf(out, "Ready:          %s (%s)\n", ready, reason)
+	_, _ = fmt.Fprintf(out, "Last resolved:  %s\n", ago(anp.Status.LastResolvedTime, now))
+	for _, c := range anp.Status.Conditions {
+		if c.Message != "" {
+			_, _ = fmt.Fprintf(out, "  %s: %s\n", c.Type, c.Message)
+		}
+	}
+	_, _ = fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RULE\tHOSTNAME\tADDRESSES\tFILTERED\tRESOLVER\tLAST SUCCESS\tLAST ERROR")
+	for _, rule := range anp.Status.Rules {
+		for _, h := range rule.Hostnames {
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\n",
+				rule.Index, h.Hostname, len(h.Addresses), len(h.FilteredAddresses),
+				orNone(h.Resolver), age(h.LastSuccessTime, now), orNone(h.LastError))
+		}
+	}
+	return w.Flush()
+}
+
+func readyCondition(anp *networkingv1alpha1.NetworkPolicy) (status, reason string) {
+	c := apimeta.FindStatusCondition(anp.Status.Conditions, "Ready")
+	if c == nil {
+		return "Unknown", "NotReconciled"
+	}
+	return string(c.Status), c.Reason
+}
+
+func failingHostnames(anp *networkingv1alpha1.NetworkPolicy) []string {
+	var failing []string
+	for _, rule := range anp.Status.Rules {
+		for _, h := range rule.Hostnames {
+			if h.LastError != "" {
+				failing = append(failing, h.Hostname)
+			}
+		}
+	}
+	return failing
+}
+
+func age(t *metav1.Time, now time.Time) string {
+	if t == nil {
+		return "<never>"
+	}
+	return duration.HumanDuration(now.Sub(t.Time))
+}
+
+func ago(t *metav1.Time, now time.Time) string {
+	if t == nil {
+		return "<never>"
+	}
+	return age(t, now) + " ago"
+}
+
+func orNone(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "<none>"
+	}
+	return s
+}
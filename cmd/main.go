@@ -17,12 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-based authentication works
@@ -31,9 +34,11 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -42,6 +47,10 @@ import (
 	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
 	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/controller"
 	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/flagutil"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/probe"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/simulate"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
 )
 
 var (
@@ -55,23 +64,6 @@ func init() {
 	utilruntime.Must(networkingv1.AddToScheme(scheme))
 }
 
-// stringSliceFlag implements flag.Value for comma-separated string slices.
-type stringSliceFlag []string
-
-func (s *stringSliceFlag) String() string {
-	return strings.Join(*s, ",")
-}
-
-func (s *stringSliceFlag) Set(val string) error {
-	for _, v := range strings.Split(val, ",") {
-		v = strings.TrimSpace(v)
-		if v != "" {
-			*s = append(*s, v)
-		}
-	}
-	return nil
-}
-
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
@@ -81,9 +73,28 @@ func main() {
 	var metricsCertDir string
 	var metricsCertName string
 	var metricsCertKey string
-	var ipBlacklist stringSliceFlag
-	var ipWhitelist stringSliceFlag
+	var ipBlacklist flagutil.StringSlice
+	var ipWhitelist flagutil.StringSlice
+	var clusterCIDRs flagutil.StringSlice
 	var blacklistSet bool
+	var auditMode bool
+	var resolverName string
+	var dnsServers flagutil.StringSlice
+	var ipFamilies flagutil.StringSlice
+	var dnsOverTLS bool
+	var dnsTLSServerName, dnsTLSCAFile string
+	var limits dns.LimitOptions
+	var maxHostnameLabels int
+	var tracingOpts tracing.Options
+	var quarantineOpts dns.QuarantineOptions
+	var enableWorkloadPolicies bool
+	var clusterDNSService string
+	var consolidatePolicies bool
+	var enableSimulation bool
+	var enableVerification bool
+	var probeImage string
+	var probeTimeout time.Duration
+	var maxConcurrentProbes int
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8443", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable metrics.")
@@ -101,11 +112,88 @@ func main() {
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the TLS certificate file.")
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the TLS private key file.")
 	flag.Var(&ipBlacklist, "ip-blacklist",
-		"CIDRs to block from resolved IPs (comma-separated, repeatable). "+
-			"Default: 169.254.169.254/32,127.0.0.0/8")
+		"CIDRs or presets to block from resolved IPs (comma-separated, repeatable). "+
+			"Presets: "+strings.Join(dns.PresetNames(), ", ")+". "+
+			"Default: "+strings.Join(dns.DefaultBlacklist, ","))
 	flag.Var(&ipWhitelist, "ip-whitelist",
-		"CIDRs to allow (comma-separated, repeatable). "+
+		"CIDRs or presets to allow (comma-separated, repeatable). "+
 			"When set, only matching IPs pass (unless also blacklisted).")
+	flag.Var(&clusterCIDRs, "cluster-cidrs",
+		"Pod and Service CIDRs the cluster-cidrs preset expands to (comma-separated, repeatable). "+
+			"Default: discovered from node Pod CIDRs and ServiceCIDRs at startup")
+	flag.BoolVar(&auditMode, "audit-mode", false,
+		"If set, all policies are reconciled in Audit mode: rendered policies are written to status "+
+			"and no standard NetworkPolicies are created, updated or deleted, regardless of spec.mode. "+
+			"The egress baseline is not applied either.")
+	flag.StringVar(&resolverName, "resolver", "system",
+		"Upstream resolver: \"system\" uses the host's resolver; \"wire\" queries DNS servers directly "+
+			"and records every alias of a CNAME chain; \"validating\" additionally reports whether the DNS servers, "+
+			"which must be validating recursive resolvers reached on loopback or over DNS over TLS, "+
+			"authenticated answers with DNSSEC for peers that ask for it.")
+	flag.Var(&dnsServers, "dns-servers",
+		"DNS servers (host:port) queried by --resolver=wire (comma-separated, repeatable). "+
+			"Default: the nameservers in /etc/resolv.conf")
+	flag.BoolVar(&dnsOverTLS, "dns-over-tls", false,
+		"If set, --resolver=wire and --resolver=validating query --dns-servers over DNS over TLS.")
+	flag.StringVar(&dnsTLSServerName, "dns-tls-server-name", "",
+		"Name to verify the DNS over TLS servers' certificates for. Default: the address of the server queried")
+	flag.StringVar(&dnsTLSCAFile, "dns-tls-ca-file", "",
+		"PEM file with the CA certificates to verify the DNS over TLS servers' certificates with. "+
+			"Default: the system roots")
+	flag.IntVar(&maxHostnameLabels, "metrics-max-hostnames", dns.DefaultMaxHostnameLabels,
+		"Maximum number of distinct hostname label values in metrics; further hostnames are reported as \""+
+			dns.OverflowLabel+"\". 0 disables the limit.")
+	flag.StringVar(&tracingOpts.Endpoint, "tracing-endpoint", "",
+		"OTLP gRPC endpoint (host:port) to export traces to. Tracing is disabled if empty.")
+	flag.BoolVar(&tracingOpts.Insecure, "tracing-insecure", false,
+		"If set, traces are exported without TLS.")
+	flag.Float64Var(&tracingOpts.SampleRatio, "tracing-sample-ratio", 0.1,
+		"Fraction of reconciles that are traced, between 0 and 1.")
+	flag.Float64Var(&limits.QPS, "dns-qps", 20,
+		"Maximum rate of DNS queries per second, including retries. With --resolver=system, each lookup "+
+			"(hostname resolution or SRV lookup) counts as one query. 0 disables the limit.")
+	flag.IntVar(&limits.Burst, "dns-burst", 0,
+		"Number of DNS queries that may exceed --dns-qps momentarily. Default: --dns-qps rounded up")
+	flag.IntVar(&limits.MaxConcurrent, "dns-max-concurrent", 10,
+		"Maximum number of DNS queries in flight. 0 disables the limit.")
+	flag.DurationVar(&limits.Timeout, "dns-timeout", 5*time.Second,
+		"Timeout for each DNS query attempt. 0 disables the timeout.")
+	flag.IntVar(&limits.Retries, "dns-retries", 2,
+		"Number of times a failed DNS query is retried. Queries for names that do not exist are not retried.")
+	flag.DurationVar(&limits.Backoff, "dns-retry-backoff", 200*time.Millisecond,
+		"Base delay before retrying a DNS query; doubled for every further retry and jittered.")
+	flag.BoolVar(&quarantineOpts.ScopeChanges, "quarantine-scope-changes", false,
+		"Quarantine hostnames whose answer gains an address scope (public, private, loopback, link-local) "+
+			"it did not have before, e.g. a public name that starts resolving to private addresses.")
+	flag.IntVar(&quarantineOpts.MaxChanges, "quarantine-max-changes", 0,
+		"Quarantine hostnames whose answer changes more than this many times within --quarantine-window. "+
+			"0 disables the limit.")
+	flag.DurationVar(&quarantineOpts.Window, "quarantine-window", time.Hour,
+		"The period over which --quarantine-max-changes counts answer changes.")
+	flag.BoolVar(&enableWorkloadPolicies, "enable-workload-policies", false,
+		"If set, NetworkPolicies are generated for Deployments, StatefulSets and standalone Pods annotated with "+
+			networkingv1alpha1.EgressHostsAnnotation+".")
+	flag.BoolVar(&consolidatePolicies, "consolidate-policies", false,
+		"If set, the standard NetworkPolicies of NetworkPolicies with identical pod selectors in a namespace are "+
+			"merged into one.")
+	flag.BoolVar(&enableSimulation, "enable-simulation", false,
+		"If set, the metrics server serves /simulate, which evaluates whether a pod may connect to a hostname "+
+			"or address. It requires --metrics-secure, and callers also need list on augmented NetworkPolicies "+
+			"in the namespace they simulate.")
+	flag.BoolVar(&enableVerification, "enable-verification", false,
+		"If set, the connectivity of NetworkPolicies with spec.verification is probed from a pod they select.")
+	flag.StringVar(&probeImage, "probe-image", probe.DefaultImage,
+		"The image of probe pods created to verify connectivity. It must provide sh and nc.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", probe.DefaultTimeout,
+		"How long a connectivity probe may take, including starting a probe pod.")
+	flag.IntVar(&maxConcurrentProbes, "max-concurrent-probes", controller.DefaultMaxConcurrentProbes,
+		"How many NetworkPolicies are probed at the same time, so that slow probes do not delay the others.")
+	flag.StringVar(&clusterDNSService, "cluster-dns-service", "kube-system/kube-dns",
+		"The namespace/name of the cluster DNS Service that namespaces labelled with "+
+			networkingv1alpha1.EgressBaselineLabel+" are allowed to reach.")
+	flag.Var(&ipFamilies, "ip-families",
+		"IP families (IPv4, IPv6) allowed for egress rules that do not set ipFamilies "+
+			"(comma-separated, repeatable). Default: both")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -121,7 +209,7 @@ func main() {
 
 	// Apply default blacklist if not explicitly provided
 	if !blacklistSet {
-		ipBlacklist = stringSliceFlag{"169.254.169.254/32", "127.0.0.0/8"}
+		ipBlacklist = flagutil.StringSlice(dns.DefaultBlacklist)
 	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
@@ -170,21 +258,95 @@ func main() {
 	}
 
 	// Set up IP filter
-	ipFilter, err := dns.NewIPFilter([]string(ipWhitelist), []string(ipBlacklist))
+	discoverClusterCIDRs := func() ([]string, error) {
+		if len(clusterCIDRs) > 0 {
+			return clusterCIDRs, nil
+		}
+		c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		cidrs, err := controller.DiscoverClusterCIDRs(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("%w; set --cluster-cidrs explicitly", err)
+		}
+		setupLog.Info("discovered cluster CIDRs", "cidrs", cidrs)
+		return cidrs, nil
+	}
+	blacklist, err := dns.ExpandPresets(ipBlacklist, discoverClusterCIDRs)
+	if err != nil {
+		setupLog.Error(err, "invalid IP blacklist")
+		os.Exit(1)
+	}
+	whitelist, err := dns.ExpandPresets(ipWhitelist, discoverClusterCIDRs)
+	if err != nil {
+		setupLog.Error(err, "invalid IP whitelist")
+		os.Exit(1)
+	}
+	ipFilter, err := dns.NewIPFilter(whitelist, blacklist)
 	if err != nil {
 		setupLog.Error(err, "invalid IP filter configuration")
 		os.Exit(1)
 	}
 
-	var resolver dns.Resolver = &dns.FilteringResolver{
-		Inner:  dns.NewNetResolver(),
-		Filter: ipFilter,
-		Logger: ctrl.Log.WithName("ip-filter"),
+	defaultFamilies, err := dns.ParseIPFamilies([]string(ipFamilies))
+	if err != nil {
+		setupLog.Error(err, "invalid IP family configuration")
+		os.Exit(1)
+	}
+
+	var dnsTLS *tls.Config
+	if dnsOverTLS {
+		if dnsTLS, err = dns.NewTLSConfig(dnsTLSServerName, dnsTLSCAFile); err != nil {
+			setupLog.Error(err, "invalid DNS over TLS configuration")
+			os.Exit(1)
+		}
+	}
+	upstream, err := newUpstream(resolverName, []string(dnsServers), dnsTLS, dns.NewLimiter(limits))
+	if err != nil {
+		setupLog.Error(err, "invalid resolver configuration")
+		os.Exit(1)
+	}
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "invalid tracing configuration")
+		os.Exit(1)
+	}
+
+	dns.SetMaxHostnameLabels(maxHostnameLabels)
+	upstream = dns.NewInstrumentedResolver(upstream, resolverName)
+	if resolverName == "system" {
+		// The system resolver does not expose the queries it sends, so its lookups are limited instead.
+		upstream = dns.NewLimitingResolver(upstream, limits)
+	}
+	var quarantine *dns.Quarantine
+	if quarantineOpts.ScopeChanges || quarantineOpts.MaxChanges > 0 {
+		quarantine = dns.NewQuarantine(quarantineOpts)
+		setupLog.Info("DNS rebinding quarantine enabled",
+			"scopeChanges", quarantineOpts.ScopeChanges,
+			"maxChanges", quarantineOpts.MaxChanges,
+			"window", quarantineOpts.Window,
+		)
+	}
+	filteringResolver := &dns.FilteringResolver{
+		Inner:      upstream,
+		Filter:     ipFilter,
+		Logger:     ctrl.Log.WithName("ip-filter"),
+		Quarantine: quarantine,
 	}
 
 	setupLog.Info("IP filter configured",
-		"blacklist", fmt.Sprintf("%v", []string(ipBlacklist)),
-		"whitelist", fmt.Sprintf("%v", []string(ipWhitelist)),
+		"blacklist", fmt.Sprintf("%v", blacklist),
+		"whitelist", fmt.Sprintf("%v", whitelist),
+	)
+	setupLog.Info("DNS query limits configured",
+		"qps", limits.QPS,
+		"maxConcurrent", limits.MaxConcurrent,
+		"timeout", limits.Timeout,
+		"retries", limits.Retries,
 	)
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -207,14 +369,99 @@ func main() {
 		}
 	}
 
+	resolverState := &controller.ResolverStateSync{Client: mgr.GetClient(), Resolver: filteringResolver}
+	if err := mgr.Add(resolverState); err != nil {
+		setupLog.Error(err, "unable to add resolver state sync to manager")
+		os.Exit(1)
+	}
+
 	if err = (&controller.NetworkPolicyReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Resolver: resolver,
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Resolver:            filteringResolver,
+		SRVResolver:         upstream,
+		AuditMode:           auditMode,
+		DefaultIPFamilies:   defaultFamilies,
+		ConsolidatePolicies: consolidatePolicies,
+		Recorder:            mgr.GetEventRecorder("augmented-networkpolicy-operator"),
+		ResolverState:       resolverState,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NetworkPolicy")
 		os.Exit(1)
 	}
+	if err = (&controller.QuarantineAcknowledgementReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Quarantine:    quarantine,
+		ResolverState: resolverState,
+		Recorder:      mgr.GetEventRecorder("augmented-networkpolicy-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "QuarantineAcknowledgement")
+		os.Exit(1)
+	}
+	dnsNamespace, dnsName, ok := strings.Cut(clusterDNSService, "/")
+	if !ok || dnsNamespace == "" || dnsName == "" {
+		setupLog.Error(nil, "invalid --cluster-dns-service, expected namespace/name", "value", clusterDNSService)
+		os.Exit(1)
+	}
+	if err = (&controller.BaselineReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		ClusterDNSService: client.ObjectKey{Namespace: dnsNamespace, Name: dnsName},
+		AuditMode:         auditMode,
+		Recorder:          mgr.GetEventRecorder("augmented-networkpolicy-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EgressBaseline")
+		os.Exit(1)
+	}
+	if enableWorkloadPolicies {
+		if err = (&controller.WorkloadPolicyReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorder("augmented-networkpolicy-operator"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "WorkloadPolicy")
+			os.Exit(1)
+		}
+	}
+
+	if enableVerification {
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create clientset for probes")
+			os.Exit(1)
+		}
+		if err = (&controller.VerificationReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			Prober: &probe.PodProber{
+				Clientset:  clientset,
+				RESTConfig: mgr.GetConfig(),
+				Scheme:     mgr.GetScheme(),
+				Image:      probeImage,
+				Timeout:    probeTimeout,
+			},
+			MaxConcurrentProbes: maxConcurrentProbes,
+			Recorder:            mgr.GetEventRecorder("augmented-networkpolicy-operator"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Verification")
+			os.Exit(1)
+		}
+	}
+
+	if enableSimulation {
+		// Simulations reveal what a namespace's policies allow, so they are only served to
+		// authenticated callers allowed to list the namespace's policies.
+		if !secureMetrics {
+			setupLog.Error(nil, "--enable-simulation requires --metrics-secure")
+			os.Exit(1)
+		}
+		handler := simulate.Handler(mgr.GetClient(), &simulate.ReviewAuthorizer{Client: mgr.GetClient()})
+		if err := mgr.AddMetricsServerExtraHandler("/simulate", handler); err != nil {
+			setupLog.Error(err, "unable to add simulation endpoint")
+			os.Exit(1)
+		}
+	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -226,8 +473,47 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
+}
+
+// upstreamResolver resolves hostnames and looks up SRV records.
+type upstreamResolver interface {
+	dns.Resolver
+	dns.SRVResolver
+}
+
+// newUpstream returns the named upstream resolver. The wire and validating resolvers send
+// their queries within limits, and over DNS over TLS if tlsConfig is set.
+func newUpstream(name string, servers []string, tlsConfig *tls.Config, limits *dns.Limiter) (upstreamResolver, error) {
+	if name == "system" {
+		if tlsConfig != nil {
+			return nil, errors.New("--dns-over-tls requires --resolver=wire or --resolver=validating")
+		}
+		return dns.NewNetResolver(), nil
+	}
+	if name != "wire" && name != "validating" {
+		return nil, fmt.Errorf("unknown resolver %q", name)
+	}
+
+	if tlsConfig != nil && len(servers) == 0 {
+		return nil, errors.New("--dns-over-tls requires --dns-servers")
+	}
+	if len(servers) == 0 {
+		var err error
+		if servers, err = dns.ServersFromResolvConf("/etc/resolv.conf"); err != nil {
+			return nil, err
+		}
+	}
+	if name == "wire" {
+		r := dns.NewWireResolver(servers)
+		r.TLS, r.Limits = tlsConfig, limits
+		return r, nil
+	}
+	return dns.NewValidatingResolver(servers, tlsConfig, limits)
 }
@@ -0,0 +1,309 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+// Names of the standard NetworkPolicies maintained in namespaces with the egress baseline.
+const (
+	DefaultDenyEgressPolicyName = "augmented-default-deny-egress"
+	AllowDNSPolicyName          = "augmented-allow-dns"
+)
+
+// clusterDNSRetryInterval is how long to wait before retrying a namespace whose baseline
+// could not be applied because the cluster DNS Service was not found.
+const clusterDNSRetryInterval = time.Minute
+
+// errClusterDNSNotFound is returned by DiscoverClusterDNS if the cluster DNS Service does not exist.
+var errClusterDNSNotFound = errors.New("cluster DNS Service not found")
+
+// errNotBaseline is returned when a NetworkPolicy with a baseline name exists but is not
+// maintained by the operator.
+var errNotBaseline = errors.New("not maintained for the egress baseline")
+
+// ClusterDNS describes the cluster DNS Service that pods send their queries to.
+type ClusterDNS struct {
+	// Namespace is the namespace of the Service and its pods.
+	Namespace string
+	// Selector is the Service's pod selector.
+	Selector map[string]string
+	// ClusterIPs are the Service's cluster IPs.
+	ClusterIPs []string
+	// Ports are the Service's ports.
+	Ports []corev1.ServicePort
+}
+
+// DiscoverClusterDNS returns the cluster DNS Service named by key.
+func DiscoverClusterDNS(ctx context.Context, c client.Reader, key client.ObjectKey) (*ClusterDNS, error) {
+	var svc corev1.Service
+	if err := c.Get(ctx, key, &svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", errClusterDNSNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to get cluster DNS Service: %w", err)
+	}
+	if len(svc.Spec.Selector) == 0 || len(svc.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("cluster DNS Service %s has no selector or no ports", key)
+	}
+	dns := &ClusterDNS{Namespace: svc.Namespace, Selector: svc.Spec.Selector, Ports: svc.Spec.Ports}
+	for _, ip := range svc.Spec.ClusterIPs {
+		if _, err := netip.ParseAddr(ip); err == nil {
+			dns.ClusterIPs = append(dns.ClusterIPs, ip)
+		}
+	}
+	return dns, nil
+}
+
+// BaselineReconciler maintains a default-deny egress NetworkPolicy and a NetworkPolicy
+// allowing DNS to the cluster DNS in every namespace labelled with
+// networkingv1alpha1.EgressBaselineLabel, so that pods selected by augmented policies can
+// still resolve hostnames. Both policies are owned by the namespace and removed with the label.
+type BaselineReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// ClusterDNSService is the namespace and name of the cluster DNS Service.
+	ClusterDNSService client.ObjectKey
+
+	// AuditMode stops the reconciler from creating, updating or deleting baseline policies.
+	// Labelled namespaces get an event instead, and existing baseline policies stay as they are.
+	AuditMode bool
+
+	// Recorder emits events about the namespaces. No events are emitted if it is nil.
+	Recorder events.EventRecorder
+}
+
+// +kubebuilder:rbac:groups="",resources=namespaces;services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;delete
+
+// Reconcile applies or removes the egress baseline of a namespace.
+func (r *BaselineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, req.NamespacedName, &ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if r.AuditMode {
+		// Even the DNS allowance alone isolates every pod for egress, so nothing is applied.
+		if baselineEnabled(&ns) && ns.DeletionTimestamp.IsZero() {
+			logger.Info("not applying egress baseline in audit mode")
+			r.event(&ns, corev1.EventTypeNormal, "BaselineAudited", "ApplyBaseline",
+				"Egress baseline not applied: the operator runs in audit mode and leaves NetworkPolicies %s and %s unchanged",
+				DefaultDenyEgressPolicyName, AllowDNSPolicyName)
+		}
+		return ctrl.Result{}, nil
+	}
+	if !baselineEnabled(&ns) || !ns.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.removeBaseline(ctx, &ns)
+	}
+
+	// Without an allowance for DNS, the default deny would break name resolution.
+	dns, err := DiscoverClusterDNS(ctx, r, r.ClusterDNSService)
+	if errors.Is(err, errClusterDNSNotFound) {
+		logger.Info("not applying egress baseline until the cluster DNS Service exists", "service", r.ClusterDNSService)
+		r.event(&ns, corev1.EventTypeWarning, "ClusterDNSNotFound", "ApplyBaseline",
+			"Egress baseline not applied: %v", err)
+		return ctrl.Result{RequeueAfter: clusterDNSRetryInterval}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The DNS allowance is applied first, and egress is not denied if it cannot be.
+	for _, desired := range []*networkingv1.NetworkPolicy{allowDNSPolicy(ns.Name, dns), defaultDenyEgressPolicy(ns.Name)} {
+		if err := r.applyBaselinePolicy(ctx, &ns, desired); errors.Is(err, errNotBaseline) {
+			r.event(&ns, corev1.EventTypeWarning, "PolicyConflict", "ApplyBaseline",
+				"NetworkPolicy %s exists and is not maintained for the egress baseline", desired.Name)
+			return ctrl.Result{}, nil
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// applyBaselinePolicy creates desired or updates its spec, unless a NetworkPolicy of the
+// same name that is not owned by ns exists.
+func (r *BaselineReconciler) applyBaselinePolicy(
+	ctx context.Context, ns *corev1.Namespace, desired *networkingv1.NetworkPolicy,
+) error {
+	np := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, np, func() error {
+		if !np.CreationTimestamp.IsZero() && !metav1.IsControlledBy(np, ns) {
+			return errNotBaseline
+		}
+		np.Spec = desired.Spec
+		return controllerutil.SetControllerReference(ns, np, r.Scheme)
+	})
+	if err != nil {
+		if errors.Is(err, errNotBaseline) {
+			return err
+		}
+		return fmt.Errorf("failed to apply NetworkPolicy %s: %w", desired.Name, err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("applied egress baseline NetworkPolicy", "name", desired.Name, "operation", op)
+	}
+	return nil
+}
+
+// removeBaseline deletes the baseline NetworkPolicies owned by ns.
+func (r *BaselineReconciler) removeBaseline(ctx context.Context, ns *corev1.Namespace) error {
+	for _, name := range []string{DefaultDenyEgressPolicyName, AllowDNSPolicyName} {
+		var np networkingv1.NetworkPolicy
+		if err := r.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: name}, &np); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get NetworkPolicy %s: %w", name, err)
+		}
+		if !metav1.IsControlledBy(&np, ns) {
+			continue
+		}
+		log.FromContext(ctx).Info("removing egress baseline NetworkPolicy", "name", name)
+		if err := client.IgnoreNotFound(r.Delete(ctx, &np)); err != nil {
+			return fmt.Errorf("failed to delete NetworkPolicy %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (r *BaselineReconciler) event(obj runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, nil, eventtype, reason, action, note, args...)
+	}
+}
+
+// defaultDenyEgressPolicy selects every pod in namespace and allows no egress.
+func defaultDenyEgressPolicy(namespace string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultDenyEgressPolicyName, Namespace: namespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+}
+
+// allowDNSPolicy allows every pod in namespace to reach the cluster DNS pods on their
+// target ports, and the cluster DNS Service's IPs on its ports for network plugins that
+// enforce policies before the Service address is translated.
+func allowDNSPolicy(namespace string, dns *ClusterDNS) *networkingv1.NetworkPolicy {
+	var podPorts, servicePorts []networkingv1.NetworkPolicyPort
+	for _, p := range dns.Ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolUDP
+		}
+		target := p.TargetPort
+		if target.Type == intstr.Int && target.IntVal == 0 {
+			target = intstr.FromInt32(p.Port)
+		}
+		port := intstr.FromInt32(p.Port)
+		podPorts = append(podPorts, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &target})
+		servicePorts = append(servicePorts, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+
+	egress := []networkingv1.NetworkPolicyEgressRule{{
+		Ports: podPorts,
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{corev1.LabelMetadataName: dns.Namespace},
+			},
+			PodSelector: &metav1.LabelSelector{MatchLabels: dns.Selector},
+		}},
+	}}
+	if len(dns.ClusterIPs) > 0 {
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, ip := range dns.ClusterIPs {
+			peers = append(peers, ipBlockPeer(ip))
+		}
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{Ports: servicePorts, To: peers})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: AllowDNSPolicyName, Namespace: namespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			Egress:      egress,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+}
+
+// ipBlockPeer returns a peer for the single address ip, which must be valid.
+func ipBlockPeer(ip string) networkingv1.NetworkPolicyPeer {
+	addr := netip.MustParseAddr(ip)
+	cidr := netip.PrefixFrom(addr, addr.BitLen()).String()
+	return networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}
+}
+
+func baselineEnabled(ns *corev1.Namespace) bool {
+	return ns.Labels[networkingv1alpha1.EgressBaselineLabel] == "enabled"
+}
+
+// namespacesWithBaseline enqueues every namespace with the egress baseline when the
+// cluster DNS Service changes.
+func (r *BaselineReconciler) namespacesWithBaseline(ctx context.Context, obj client.Object) []reconcile.Request {
+	if client.ObjectKeyFromObject(obj) != r.ClusterDNSService {
+		return nil
+	}
+	var list corev1.NamespaceList
+	if err := r.List(ctx, &list, client.MatchingLabels{networkingv1alpha1.EgressBaselineLabel: "enabled"}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list namespaces")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, ns := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ns)})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager. Namespaces are reconciled when
+// their labels change, and changes to the baseline policies are reverted.
+func (r *BaselineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("egressbaseline").
+		For(&corev1.Namespace{}, builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.namespacesWithBaseline)).
+		Complete(r)
+}
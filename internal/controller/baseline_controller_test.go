@@ -0,0 +1,205 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+var _ = Describe("BaselineReconciler", func() {
+	newNamespace := func(prefix string, labels map[string]string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: prefix, Labels: labels}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		return ns
+	}
+	enabled := map[string]string{networkingv1alpha1.EgressBaselineLabel: "enabled"}
+
+	It("should maintain a default deny and a DNS allowance in labelled namespaces", func() {
+		dnsNamespace := newNamespace("cluster-dns-", nil)
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-dns", Namespace: dnsNamespace.Name},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"k8s-app": "kube-dns"},
+				Ports: []corev1.ServicePort{
+					{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+					{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromString("dns-tcp")},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+
+		ns := newNamespace("baseline-", enabled)
+		reconciler := &BaselineReconciler{
+			Client:            k8sClient,
+			Scheme:            scheme.Scheme,
+			ClusterDNSService: client.ObjectKeyFromObject(svc),
+		}
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ns)}
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var deny networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: DefaultDenyEgressPolicyName}, &deny)).
+			To(Succeed())
+		Expect(metav1.IsControlledBy(&deny, ns)).To(BeTrue())
+		Expect(deny.Spec.PodSelector.Size()).To(BeZero())
+		Expect(deny.Spec.Egress).To(BeEmpty())
+		Expect(deny.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeEgress))
+
+		var allow networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: AllowDNSPolicyName}, &allow)).
+			To(Succeed())
+		Expect(allow.Spec.Egress).To(HaveLen(2))
+		pods := allow.Spec.Egress[0]
+		Expect(pods.To).To(HaveLen(1))
+		Expect(pods.To[0].NamespaceSelector.MatchLabels).
+			To(Equal(map[string]string{corev1.LabelMetadataName: dnsNamespace.Name}))
+		Expect(pods.To[0].PodSelector.MatchLabels).To(Equal(svc.Spec.Selector))
+		Expect(pods.Ports).To(HaveLen(2))
+		Expect(pods.Ports[0].Port.String()).To(Equal("53"))
+		Expect(pods.Ports[1].Port.String()).To(Equal("dns-tcp"))
+		Expect(*pods.Ports[1].Protocol).To(Equal(corev1.ProtocolTCP))
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(svc), svc)).To(Succeed())
+		service := allow.Spec.Egress[1]
+		Expect(service.To).To(HaveLen(1))
+		Expect(service.To[0].IPBlock.CIDR).To(Equal(svc.Spec.ClusterIP + "/32"))
+		Expect(service.Ports[1].Port.String()).To(Equal("53"))
+
+		By("removing the policies when the label is removed")
+		Expect(k8sClient.Get(ctx, req.NamespacedName, ns)).To(Succeed())
+		delete(ns.Labels, networkingv1alpha1.EgressBaselineLabel)
+		Expect(k8sClient.Update(ctx, ns)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{DefaultDenyEgressPolicyName, AllowDNSPolicyName} {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: name}, &networkingv1.NetworkPolicy{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("should not apply or remove the baseline in audit mode", func() {
+		dnsNamespace := newNamespace("cluster-dns-", nil)
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-dns", Namespace: dnsNamespace.Name},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"k8s-app": "kube-dns"},
+				Ports:    []corev1.ServicePort{{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+
+		ns := newNamespace("baseline-audit-", enabled)
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &BaselineReconciler{
+			Client:            k8sClient,
+			Scheme:            scheme.Scheme,
+			ClusterDNSService: client.ObjectKeyFromObject(svc),
+			AuditMode:         true,
+			Recorder:          recorder,
+		}
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ns)}
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal BaselineAudited")))
+
+		var list networkingv1.NetworkPolicyList
+		Expect(k8sClient.List(ctx, &list, client.InNamespace(ns.Name))).To(Succeed())
+		Expect(list.Items).To(BeEmpty())
+
+		By("leaving a baseline applied before audit mode in place")
+		reconciler.AuditMode = false
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		reconciler.AuditMode = true
+		Expect(k8sClient.Get(ctx, req.NamespacedName, ns)).To(Succeed())
+		delete(ns.Labels, networkingv1alpha1.EgressBaselineLabel)
+		Expect(k8sClient.Update(ctx, ns)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.List(ctx, &list, client.InNamespace(ns.Name))).To(Succeed())
+		Expect(list.Items).To(HaveLen(2))
+	})
+
+	It("should not deny egress until the cluster DNS Service exists", func() {
+		ns := newNamespace("baseline-nodns-", enabled)
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &BaselineReconciler{
+			Client:            k8sClient,
+			Scheme:            scheme.Scheme,
+			ClusterDNSService: client.ObjectKey{Namespace: "kube-system", Name: "missing-dns"},
+			Recorder:          recorder,
+		}
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ns)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(clusterDNSRetryInterval))
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning ClusterDNSNotFound")))
+
+		var list networkingv1.NetworkPolicyList
+		Expect(k8sClient.List(ctx, &list, client.InNamespace(ns.Name))).To(Succeed())
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("should not deny egress if the DNS allowance is taken by another NetworkPolicy", func() {
+		dnsNamespace := newNamespace("cluster-dns-", nil)
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-dns", Namespace: dnsNamespace.Name},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"k8s-app": "kube-dns"},
+				Ports:    []corev1.ServicePort{{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+
+		ns := newNamespace("baseline-conflict-", enabled)
+		existing := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: AllowDNSPolicyName, Namespace: ns.Name},
+			Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+		}
+		Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &BaselineReconciler{
+			Client:            k8sClient,
+			Scheme:            scheme.Scheme,
+			ClusterDNSService: client.ObjectKeyFromObject(svc),
+			Recorder:          recorder,
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ns)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning PolicyConflict")))
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(existing), existing)).To(Succeed())
+		Expect(existing.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress))
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: DefaultDenyEgressPolicyName},
+			&networkingv1.NetworkPolicy{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
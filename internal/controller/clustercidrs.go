@@ -0,0 +1,68 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=list
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=servicecidrs,verbs=list
+
+// DiscoverClusterCIDRs returns the Pod CIDRs assigned to nodes and the Service CIDRs of
+// the cluster. Service CIDRs are only discoverable on clusters serving the ServiceCIDR API.
+func DiscoverClusterCIDRs(ctx context.Context, c client.Reader) ([]string, error) {
+	var cidrs []string
+
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		cidrs = append(cidrs, node.Spec.PodCIDRs...)
+		if node.Spec.PodCIDR != "" {
+			cidrs = append(cidrs, node.Spec.PodCIDR)
+		}
+	}
+
+	var serviceCIDRs networkingv1.ServiceCIDRList
+	err := c.List(ctx, &serviceCIDRs)
+	switch {
+	case err == nil:
+		for _, sc := range serviceCIDRs.Items {
+			cidrs = append(cidrs, sc.Spec.CIDRs...)
+		}
+	case meta.IsNoMatchError(err) || apierrors.IsNotFound(err):
+	default:
+		return nil, fmt.Errorf("failed to list ServiceCIDRs: %w", err)
+	}
+
+	if len(cidrs) == 0 {
+		return nil, errors.New("no Pod or Service CIDRs found on nodes or ServiceCIDRs")
+	}
+	slices.Sort(cidrs)
+	return slices.Compact(cidrs), nil
+}
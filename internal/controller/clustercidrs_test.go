@@ -0,0 +1,47 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DiscoverClusterCIDRs", func() {
+	It("should return the Pod CIDRs of nodes", func() {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "cidr-node"},
+			Spec: corev1.NodeSpec{
+				PodCIDR:  "10.244.1.0/24",
+				PodCIDRs: []string{"10.244.1.0/24", "fd00:10:244:1::/64"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, node)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, node)).To(Succeed()) })
+
+		cidrs, err := DiscoverClusterCIDRs(ctx, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cidrs).To(ContainElements("10.244.1.0/24", "fd00:10:244:1::/64"))
+		// PodCIDR repeats the first PodCIDRs entry and is reported once
+		Expect(cidrs).To(HaveExactElements(slices.Compact(slices.Clone(cidrs))))
+	})
+})
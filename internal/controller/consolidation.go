@@ -0,0 +1,244 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// consolidatedPolicyPrefix prefixes the names of consolidated standard NetworkPolicies.
+const consolidatedPolicyPrefix = "consolidated-"
+
+// ConsolidatedPolicyName returns the name of the standard NetworkPolicy that merges the
+// NetworkPolicies selecting pods with selector. Equal selectors yield the same name.
+func ConsolidatedPolicyName(selector metav1.LabelSelector) string {
+	// A LabelSelector always marshals, with its map keys sorted.
+	data, _ := json.Marshal(selector)
+	sum := sha256.Sum256(data)
+	return consolidatedPolicyPrefix + hex.EncodeToString(sum[:])[:10]
+}
+
+// consolidationMember reports whether p takes part in consolidation: it is enforced and
+// its rendered spec is recorded in its status.
+func consolidationMember(p *networkingv1alpha1.NetworkPolicy) bool {
+	return p.DeletionTimestamp.IsZero() &&
+		p.Status.Mode == networkingv1alpha1.PolicyModeEnforce &&
+		p.Status.RenderedPolicy != nil
+}
+
+// consolidate updates the consolidated standard NetworkPolicies affected by the
+// NetworkPolicy name: the one for its pod selector if it is a member, and any that it
+// was merged into before. self is the reconciled NetworkPolicy, with the status it is
+// about to be updated with, or nil if it was deleted.
+//
+// A selector shared by several members is enforced by one consolidated policy owned by
+// all of them, and their own standard NetworkPolicies are deleted. A member whose
+// selector is not shared again gets its own standard NetworkPolicy back.
+//
+// It returns the name of the consolidated policy self was merged into, if any.
+func (r *NetworkPolicyReconciler) consolidate(
+	ctx context.Context, namespace, name string, self *networkingv1alpha1.NetworkPolicy,
+) (string, error) {
+	var consolidated networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &consolidated, client.InNamespace(namespace),
+		client.HasLabels{networkingv1alpha1.ConsolidatedLabel}); err != nil {
+		return "", fmt.Errorf("failed to list consolidated NetworkPolicies: %w", err)
+	}
+	var groups []string
+	for _, np := range consolidated.Items {
+		if slices.ContainsFunc(np.OwnerReferences, func(ref metav1.OwnerReference) bool {
+			return isPolicyOwnerRef(ref) && ref.Name == name
+		}) {
+			groups = append(groups, np.Name)
+		}
+	}
+	selfMember := self != nil && consolidationMember(self)
+	var selfGroup string
+	if selfMember {
+		selfGroup = ConsolidatedPolicyName(self.Spec.PodSelector)
+		if !slices.Contains(groups, selfGroup) {
+			groups = append(groups, selfGroup)
+		}
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+
+	var policies networkingv1alpha1.NetworkPolicyList
+	if err := r.List(ctx, &policies, client.InNamespace(namespace)); err != nil {
+		return "", fmt.Errorf("failed to list NetworkPolicies: %w", err)
+	}
+	members := make(map[string][]*networkingv1alpha1.NetworkPolicy)
+	for i := range policies.Items {
+		p := &policies.Items[i]
+		if p.Name == name {
+			if !selfMember {
+				continue
+			}
+			p = self
+		}
+		if consolidationMember(p) {
+			group := ConsolidatedPolicyName(p.Spec.PodSelector)
+			members[group] = append(members[group], p)
+		}
+	}
+
+	consolidatedInto := ""
+	for _, group := range groups {
+		if err := r.syncConsolidatedPolicy(ctx, namespace, group, members[group]); err != nil {
+			return "", err
+		}
+		if group == selfGroup && len(members[group]) > 1 {
+			consolidatedInto = group
+		}
+	}
+	return consolidatedInto, nil
+}
+
+// syncConsolidatedPolicy enforces the rendered specs of members, which select the same
+// pods, through the consolidated policy group if there are several of them, or else
+// through the member's own standard NetworkPolicy.
+func (r *NetworkPolicyReconciler) syncConsolidatedPolicy(
+	ctx context.Context, namespace, group string, members []*networkingv1alpha1.NetworkPolicy,
+) error {
+	slices.SortFunc(members, func(a, b *networkingv1alpha1.NetworkPolicy) int { return strings.Compare(a.Name, b.Name) })
+	if len(members) < 2 {
+		// Split: the remaining member is enforced on its own before the merged policy goes.
+		for _, member := range members {
+			own := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: member.Name, Namespace: member.Namespace},
+				Spec:       *member.Status.RenderedPolicy.DeepCopy(),
+			}
+			if err := controllerutil.SetControllerReference(member, own, r.Scheme); err != nil {
+				return fmt.Errorf("failed to set owner reference: %w", err)
+			}
+			if err := r.applyNetworkPolicy(ctx, own); err != nil {
+				return err
+			}
+		}
+		return r.deleteConsolidatedPolicy(ctx, namespace, group)
+	}
+
+	specs := make([]networkingv1.NetworkPolicySpec, 0, len(members))
+	desired := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      group,
+			Namespace: namespace,
+			Labels:    map[string]string{networkingv1alpha1.ConsolidatedLabel: "true"},
+		},
+	}
+	for _, member := range members {
+		specs = append(specs, *member.Status.RenderedPolicy)
+		if err := controllerutil.SetOwnerReference(member, desired, r.Scheme); err != nil {
+			return fmt.Errorf("failed to set owner reference: %w", err)
+		}
+	}
+	desired.Spec = render.Merge(specs)
+	if err := r.applyConsolidatedPolicy(ctx, desired); err != nil {
+		return err
+	}
+
+	// Merge before removing the members' own policies, so that no traffic is denied in between.
+	for _, member := range members {
+		if err := r.removeEnforcedPolicy(ctx, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConsolidatedPolicy creates desired or updates the existing consolidated policy if
+// its spec or owners differ.
+func (r *NetworkPolicyReconciler) applyConsolidatedPolicy(ctx context.Context, desired *networkingv1.NetworkPolicy) error {
+	existing := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("creating consolidated NetworkPolicy", "name", desired.Name,
+			"owners", len(desired.OwnerReferences))
+		if err := r.traceWrite(ctx, "create", desired, func(ctx context.Context) error {
+			return r.Create(ctx, desired)
+		}); err != nil {
+			return fmt.Errorf("failed to create consolidated NetworkPolicy: %w", err)
+		}
+		networkPolicyCreations.Inc()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get consolidated NetworkPolicy: %w", err)
+	}
+	if _, ok := existing.Labels[networkingv1alpha1.ConsolidatedLabel]; !ok {
+		return fmt.Errorf("NetworkPolicy %s exists and is not a consolidated policy", desired.Name)
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec, desired.Spec) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	existing.OwnerReferences = desired.OwnerReferences
+	log.FromContext(ctx).Info("updating consolidated NetworkPolicy", "name", desired.Name,
+		"owners", len(desired.OwnerReferences))
+	if err := r.traceWrite(ctx, "update", existing, func(ctx context.Context) error {
+		return r.Update(ctx, existing)
+	}); err != nil {
+		return fmt.Errorf("failed to update consolidated NetworkPolicy: %w", err)
+	}
+	return nil
+}
+
+// deleteConsolidatedPolicy deletes the consolidated policy name, if it exists.
+func (r *NetworkPolicyReconciler) deleteConsolidatedPolicy(ctx context.Context, namespace, name string) error {
+	existing := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get consolidated NetworkPolicy: %w", err)
+	}
+	if _, ok := existing.Labels[networkingv1alpha1.ConsolidatedLabel]; !ok {
+		return nil
+	}
+	log.FromContext(ctx).Info("deleting consolidated NetworkPolicy", "name", name)
+	if err := r.traceWrite(ctx, "delete", existing, func(ctx context.Context) error {
+		return client.IgnoreNotFound(r.Delete(ctx, existing))
+	}); err != nil {
+		return fmt.Errorf("failed to delete consolidated NetworkPolicy: %w", err)
+	}
+	return nil
+}
+
+// isPolicyOwnerRef reports whether ref refers to an augmented NetworkPolicy.
+func isPolicyOwnerRef(ref metav1.OwnerReference) bool {
+	return ref.Kind == "NetworkPolicy" && ref.APIVersion == networkingv1alpha1.GroupVersion.String()
+}
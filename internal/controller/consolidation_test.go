@@ -0,0 +1,134 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("Policy consolidation", func() {
+	It("should merge policies with identical pod selectors and split them when they diverge", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "consolidation-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		reconciler := &NetworkPolicyReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+			Resolver: &dnstest.MockResolver{Results: map[string][]string{
+				"a.example.com": {"192.0.2.1/32"},
+				"b.example.com": {"192.0.2.2/32"},
+			}},
+			ConsolidatePolicies: true,
+		}
+		web := metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+		policy := func(name, hostname string) reconcile.Request {
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: web,
+					Egress: []networkingv1alpha1.EgressRule{{
+						To: []networkingv1alpha1.EgressPeer{{Hostname: hostname}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+			return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(anp)}
+		}
+		reconcileAll := func(reqs ...reconcile.Request) {
+			for _, req := range reqs {
+				_, err := reconciler.Reconcile(ctx, req)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+		exists := func(name string) bool {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: name}, &networkingv1.NetworkPolicy{})
+			if apierrors.IsNotFound(err) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return true
+		}
+		consolidatedName := ConsolidatedPolicyName(web)
+		Expect(consolidatedName).To(Equal(ConsolidatedPolicyName(*web.DeepCopy())))
+
+		a := policy("a-policy", "a.example.com")
+		reconcileAll(a)
+		Expect(exists(a.Name)).To(BeTrue(), "a policy with a unique selector keeps its own NetworkPolicy")
+		Expect(exists(consolidatedName)).To(BeFalse())
+
+		b := policy("b-policy", "b.example.com")
+		reconcileAll(b, a)
+		var merged networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: consolidatedName}, &merged)).To(Succeed())
+		Expect(merged.Labels).To(HaveKey(networkingv1alpha1.ConsolidatedLabel))
+		Expect(merged.Spec.PodSelector).To(Equal(web))
+		var owners, cidrs []string
+		for _, ref := range merged.OwnerReferences {
+			owners = append(owners, ref.Name)
+		}
+		for _, rule := range merged.Spec.Egress {
+			for _, peer := range rule.To {
+				cidrs = append(cidrs, peer.IPBlock.CIDR)
+			}
+		}
+		Expect(owners).To(Equal([]string{"a-policy", "b-policy"}))
+		Expect(cidrs).To(Equal([]string{"192.0.2.1/32", "192.0.2.2/32"}))
+		Expect(exists(a.Name)).To(BeFalse())
+		Expect(exists(b.Name)).To(BeFalse())
+
+		var anp networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, a.NamespacedName, &anp)).To(Succeed())
+		Expect(anp.Status.ConsolidatedInto).To(Equal(consolidatedName))
+		Expect(anp.Status.RenderedPolicy).NotTo(BeNil())
+
+		By("splitting when a selector diverges")
+		Expect(k8sClient.Get(ctx, b.NamespacedName, &anp)).To(Succeed())
+		anp.Spec.PodSelector = metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}}
+		Expect(k8sClient.Update(ctx, &anp)).To(Succeed())
+		reconcileAll(b)
+		Expect(exists(consolidatedName)).To(BeFalse())
+		Expect(exists(a.Name)).To(BeTrue())
+		Expect(exists(b.Name)).To(BeTrue())
+		Expect(k8sClient.Get(ctx, b.NamespacedName, &anp)).To(Succeed())
+		Expect(anp.Status.ConsolidatedInto).To(BeEmpty())
+
+		By("splitting when a merged policy is deleted")
+		Expect(k8sClient.Get(ctx, b.NamespacedName, &anp)).To(Succeed())
+		anp.Spec.PodSelector = web
+		Expect(k8sClient.Update(ctx, &anp)).To(Succeed())
+		reconcileAll(b)
+		Expect(exists(consolidatedName)).To(BeTrue())
+		Expect(k8sClient.Get(ctx, a.NamespacedName, &anp)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, &anp)).To(Succeed())
+		reconcileAll(a)
+		Expect(exists(consolidatedName)).To(BeFalse())
+		Expect(exists(b.Name)).To(BeTrue())
+	})
+})
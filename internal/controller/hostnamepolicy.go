@@ -0,0 +1,185 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// HostnameDeniedError is returned for a name that a HostnamePolicy does not allow.
+type HostnameDeniedError struct {
+	Hostname string
+	Policy   string
+	// Denied is true if the name matched a denied pattern, and false if it matched no allowed one.
+	Denied bool
+}
+
+func (e *HostnameDeniedError) Error() string {
+	if e.Denied {
+		return fmt.Sprintf("hostname %q is denied by HostnamePolicy %q", e.Hostname, e.Policy)
+	}
+	return fmt.Sprintf("hostname %q is not allowed by HostnamePolicy %q", e.Hostname, e.Policy)
+}
+
+// CheckHostname returns a *HostnameDeniedError if hostname is not allowed by every one of policies.
+func CheckHostname(policies []networkingv1alpha1.HostnamePolicy, hostname string) error {
+	for _, p := range policies {
+		if matchesAnyPattern(p.Spec.Denied, hostname) {
+			return &HostnameDeniedError{Hostname: hostname, Policy: p.Name, Denied: true}
+		}
+		if len(p.Spec.Allowed) > 0 && !matchesAnyPattern(p.Spec.Allowed, hostname) {
+			return &HostnameDeniedError{Hostname: hostname, Policy: p.Name}
+		}
+	}
+	return nil
+}
+
+// MatchHostnamePattern reports whether hostname matches pattern: the same name, any name
+// below the domain for "*.<domain>", or any name for "*". Matching is case-insensitive.
+func MatchHostnamePattern(pattern, hostname string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if pattern == "*" {
+		return true
+	}
+	if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(hostname, "."+domain)
+	}
+	return hostname == pattern
+}
+
+func matchesAnyPattern(patterns []string, hostname string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool { return MatchHostnamePattern(p, hostname) })
+}
+
+// hostnamePoliciesFor returns the HostnamePolicies that select namespace.
+func (r *NetworkPolicyReconciler) hostnamePoliciesFor(
+	ctx context.Context, namespace string,
+) ([]networkingv1alpha1.HostnamePolicy, error) {
+	var list networkingv1alpha1.HostnamePolicyList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list HostnamePolicies: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+	var selected []networkingv1alpha1.HostnamePolicy
+	for _, p := range list.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&p.Spec.NamespaceSelector)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "ignoring HostnamePolicy with invalid namespace selector", "hostnamePolicy", p.Name)
+			continue
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			selected = append(selected, p)
+		}
+	}
+	return selected, nil
+}
+
+// deniedHostnames returns the names in resolutions that a HostnamePolicy rejected, sorted.
+func deniedHostnames(resolutions render.Resolutions) []string {
+	var denied []string
+	for name, res := range resolutions {
+		var deniedErr *HostnameDeniedError
+		if errors.As(res.Err, &deniedErr) {
+			denied = append(denied, name)
+		}
+	}
+	slices.Sort(denied)
+	return denied
+}
+
+// hostnameGuard rejects names that are not allowed by policies before they are resolved,
+// so that a denied name is never looked up.
+type hostnameGuard struct {
+	resolver dns.Resolver
+	srv      dns.SRVResolver
+	policies []networkingv1alpha1.HostnamePolicy
+}
+
+func (g *hostnameGuard) Resolve(ctx context.Context, hostname string) (*dns.Answer, error) {
+	if err := CheckHostname(g.policies, hostname); err != nil {
+		return nil, err
+	}
+	return g.resolver.Resolve(ctx, hostname)
+}
+
+func (g *hostnameGuard) LookupSRV(ctx context.Context, name string) ([]dns.SRVTarget, error) {
+	if err := CheckHostname(g.policies, name); err != nil {
+		return nil, err
+	}
+	return g.srv.LookupSRV(ctx, name)
+}
+
+// guardResolvers returns resolver and srv wrapped to enforce policies. srv stays nil if it is nil.
+func guardResolvers(
+	resolver dns.Resolver, srv dns.SRVResolver, policies []networkingv1alpha1.HostnamePolicy,
+) (dns.Resolver, dns.SRVResolver) {
+	if len(policies) == 0 {
+		return resolver, srv
+	}
+	g := &hostnameGuard{resolver: resolver, srv: srv, policies: policies}
+	if srv == nil {
+		return g, nil
+	}
+	return g, g
+}
+
+// allPolicies enqueues every NetworkPolicy for a changed HostnamePolicy or HostnameQuota,
+// since a changed namespace selector can affect namespaces it selected before.
+func (r *NetworkPolicyReconciler) allPolicies(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.policyRequests(ctx)
+}
+
+// policiesInNamespace enqueues the NetworkPolicies in a namespace whose labels changed.
+func (r *NetworkPolicyReconciler) policiesInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.policyRequests(ctx, client.InNamespace(obj.GetName()))
+}
+
+func (r *NetworkPolicyReconciler) policyRequests(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	var list networkingv1alpha1.NetworkPolicyList
+	if err := r.List(ctx, &list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list NetworkPolicies")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, anp := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&anp)})
+	}
+	return requests
+}
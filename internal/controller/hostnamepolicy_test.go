@@ -0,0 +1,111 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("HostnamePolicy", func() {
+	DescribeTable("MatchHostnamePattern",
+		func(pattern, hostname string, want bool) {
+			Expect(MatchHostnamePattern(pattern, hostname)).To(Equal(want))
+		},
+		Entry("exact name", "api.example.com", "api.example.com", true),
+		Entry("exact name is case-insensitive", "API.example.com", "api.example.com.", true),
+		Entry("other name", "api.example.com", "www.example.com", false),
+		Entry("wildcard matches a subdomain", "*.ngrok.io", "abc.ngrok.io", true),
+		Entry("wildcard matches nested subdomains", "*.ngrok.io", "a.b.ngrok.io", true),
+		Entry("wildcard does not match the domain itself", "*.ngrok.io", "ngrok.io", false),
+		Entry("wildcard does not match a suffix of a label", "*.ngrok.io", "evilngrok.io", false),
+		Entry("wildcard matches SRV names", "*.corp.example", "_ldap._tcp.corp.example", true),
+		Entry("star matches everything", "*", "anything.example", true),
+	)
+
+	It("should reject hostnames a HostnamePolicy does not allow", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "restricted-ns-",
+			Labels:       map[string]string{"hostname-policy-test": "restricted"},
+		}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		hnp := &networkingv1alpha1.HostnamePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "no-tunnels"},
+			Spec: networkingv1alpha1.HostnamePolicySpec{
+				NamespaceSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"hostname-policy-test": "restricted"},
+				},
+				Allowed: []string{"*.example.com", "*.ngrok.io"},
+				Denied:  []string{"*.ngrok.io"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, hnp)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, hnp)).To(Succeed()) })
+
+		mock := &dnstest.MockResolver{Results: map[string][]string{
+			"api.example.com": {"93.184.216.34/32"},
+			"tunnel.ngrok.io": {"3.3.3.3/32"},
+			"other.test":      {"4.4.4.4/32"},
+		}}
+		reconciler := &NetworkPolicyReconciler{Client: k8sClient, Scheme: scheme.Scheme, Resolver: mock}
+
+		anp := &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "tunnel-policy", Namespace: ns.Name},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Egress: []networkingv1alpha1.EgressRule{{To: []networkingv1alpha1.EgressPeer{
+					{Hostname: "api.example.com"},
+					{Hostname: "tunnel.ngrok.io"},
+					{Hostname: "other.test"},
+				}}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}}
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var updated networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &updated)).To(Succeed())
+		hostnames := updated.Status.Rules[0].Hostnames
+		Expect(hostnames[0].LastError).To(BeEmpty())
+		Expect(hostnames[1].LastError).To(ContainSubstring(`is denied by HostnamePolicy "no-tunnels"`))
+		Expect(hostnames[2].LastError).To(ContainSubstring(`is not allowed by HostnamePolicy "no-tunnels"`))
+		Expect(updated.Status.Conditions[0].Reason).To(Equal("HostnameDenied"))
+		Expect(updated.Status.Conditions[0].Message).To(ContainSubstring("other.test, tunnel.ngrok.io"))
+
+		var enforced networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress[0].To).To(HaveLen(1))
+		Expect(enforced.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("93.184.216.34/32"))
+
+		By("checking the requests enqueued for the namespace")
+		Expect(reconciler.policiesInNamespace(ctx, ns)).To(ConsistOf(req))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// hostnameSetIndex indexes NetworkPolicies by the hostname sets they reference,
+// as "<kind>/<name>" (see hostnameSetKey).
+const hostnameSetIndex = "spec.egress.to.hostnameSetRef"
+
+func hostnameSetKey(ref networkingv1alpha1.HostnameSetReference) string {
+	return ref.Kind + "/" + ref.Name
+}
+
+// indexHostnameSets returns the index values of hostnameSetIndex for a NetworkPolicy.
+func indexHostnameSets(obj client.Object) []string {
+	anp, ok := obj.(*networkingv1alpha1.NetworkPolicy)
+	if !ok {
+		return nil
+	}
+	refs := render.HostnameSetRefs(&anp.Spec)
+	keys := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		keys = append(keys, hostnameSetKey(ref))
+	}
+	return keys
+}
+
+// hostnameSetsFor returns the hostnames of the sets referenced by anp, and the keys of
+// the referenced sets that do not exist.
+func (r *NetworkPolicyReconciler) hostnameSetsFor(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy,
+) (map[networkingv1alpha1.HostnameSetReference][]string, []string, error) {
+	refs := render.HostnameSetRefs(&anp.Spec)
+	if len(refs) == 0 {
+		return nil, nil, nil
+	}
+
+	sets := make(map[networkingv1alpha1.HostnameSetReference][]string, len(refs))
+	var missing []string
+	for _, ref := range refs {
+		var spec networkingv1alpha1.HostnameSetSpec
+		var err error
+		if ref.Kind == networkingv1alpha1.ClusterHostnameSetKind {
+			var set networkingv1alpha1.ClusterHostnameSet
+			err = r.Get(ctx, client.ObjectKey{Name: ref.Name}, &set)
+			spec = set.Spec
+		} else {
+			var set networkingv1alpha1.HostnameSet
+			err = r.Get(ctx, client.ObjectKey{Namespace: anp.Namespace, Name: ref.Name}, &set)
+			spec = set.Spec
+		}
+		switch {
+		case apierrors.IsNotFound(err):
+			missing = append(missing, hostnameSetKey(ref))
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to get %s %q: %w", ref.Kind, ref.Name, err)
+		default:
+			sets[ref] = spec.Hostnames
+		}
+	}
+	return sets, missing, nil
+}
+
+// policiesForHostnameSet enqueues the NetworkPolicies that reference a changed HostnameSet.
+func (r *NetworkPolicyReconciler) policiesForHostnameSet(ctx context.Context, obj client.Object) []reconcile.Request {
+	key := hostnameSetKey(networkingv1alpha1.HostnameSetReference{
+		Kind: networkingv1alpha1.HostnameSetKind, Name: obj.GetName(),
+	})
+	return r.policyRequests(ctx, client.InNamespace(obj.GetNamespace()), client.MatchingFields{hostnameSetIndex: key})
+}
+
+// policiesForClusterHostnameSet enqueues the NetworkPolicies that reference a changed ClusterHostnameSet.
+func (r *NetworkPolicyReconciler) policiesForClusterHostnameSet(ctx context.Context, obj client.Object) []reconcile.Request {
+	key := hostnameSetKey(networkingv1alpha1.HostnameSetReference{
+		Kind: networkingv1alpha1.ClusterHostnameSetKind, Name: obj.GetName(),
+	})
+	return r.policyRequests(ctx, client.MatchingFields{hostnameSetIndex: key})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("HostnameSet", func() {
+	setPolicy := func(name, namespace string, refs ...networkingv1alpha1.HostnameSetReference) *networkingv1alpha1.NetworkPolicy {
+		var peers []networkingv1alpha1.EgressPeer
+		for _, ref := range refs {
+			peers = append(peers, networkingv1alpha1.EgressPeer{HostnameSetRef: &ref})
+		}
+		return &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Egress:      []networkingv1alpha1.EgressRule{{To: peers}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+	}
+	vendors := networkingv1alpha1.HostnameSetReference{Kind: networkingv1alpha1.HostnameSetKind, Name: "vendors"}
+	shared := networkingv1alpha1.HostnameSetReference{Kind: networkingv1alpha1.ClusterHostnameSetKind, Name: "shared"}
+
+	It("should render the hostnames of referenced sets", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "set-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		set := &networkingv1alpha1.HostnameSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "vendors", Namespace: ns.Name},
+			Spec:       networkingv1alpha1.HostnameSetSpec{Hostnames: []string{"a.vendor.com", "b.vendor.com"}},
+		}
+		Expect(k8sClient.Create(ctx, set)).To(Succeed())
+
+		anp := setPolicy("set-policy", ns.Name, vendors, shared)
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+		reconciler := &NetworkPolicyReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+			Resolver: &dnstest.MockResolver{Results: map[string][]string{
+				"a.vendor.com":       {"192.0.2.1/32"},
+				"b.vendor.com":       {"192.0.2.2/32"},
+				"shared.example.com": {"192.0.2.3/32"},
+			}},
+		}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}}
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var updated networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &updated)).To(Succeed())
+		ready := apimeta.FindStatusCondition(updated.Status.Conditions, conditionTypeReady)
+		Expect(ready.Reason).To(Equal("HostnameSetNotFound"))
+		Expect(ready.Message).To(ContainSubstring("ClusterHostnameSet/shared"))
+		Expect(updated.Status.HostnameCount).To(Equal(int32(2)))
+		Expect(updated.Status.Rules[0].Hostnames).To(HaveLen(2))
+
+		var enforced networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress[0].To).To(HaveLen(2))
+
+		By("rendering the cluster set once it exists")
+		clusterSet := &networkingv1alpha1.ClusterHostnameSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Spec:       networkingv1alpha1.HostnameSetSpec{Hostnames: []string{"shared.example.com"}},
+		}
+		Expect(k8sClient.Create(ctx, clusterSet)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, clusterSet)).To(Succeed()) })
+
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &updated)).To(Succeed())
+		Expect(apimeta.IsStatusConditionTrue(updated.Status.Conditions, conditionTypeReady)).To(BeTrue())
+		Expect(updated.Status.HostnameCount).To(Equal(int32(3)))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress[0].To).To(HaveLen(3))
+	})
+
+	It("should enqueue the policies referencing a changed set", func() {
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithIndex(&networkingv1alpha1.NetworkPolicy{}, hostnameSetIndex, indexHostnameSets).
+			WithObjects(
+				setPolicy("uses-vendors", "team-a", vendors),
+				setPolicy("uses-both", "team-b", vendors, shared),
+				setPolicy("uses-nothing", "team-a"),
+			).
+			Build()
+		reconciler := &NetworkPolicyReconciler{Client: c, Scheme: scheme.Scheme}
+
+		teamA := reconcile.Request{NamespacedName: types.NamespacedName{Name: "uses-vendors", Namespace: "team-a"}}
+		teamB := reconcile.Request{NamespacedName: types.NamespacedName{Name: "uses-both", Namespace: "team-b"}}
+		Expect(reconciler.policiesForHostnameSet(ctx, &networkingv1alpha1.HostnameSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "vendors", Namespace: "team-a"},
+		})).To(ConsistOf(teamA))
+		Expect(reconciler.policiesForClusterHostnameSet(ctx, &networkingv1alpha1.ClusterHostnameSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+		})).To(ConsistOf(teamB))
+		Expect(reconciler.policiesForClusterHostnameSet(ctx, &networkingv1alpha1.ClusterHostnameSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "vendors"},
+		})).To(BeEmpty())
+	})
+})
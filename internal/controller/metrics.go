@@ -1,8 +1,14 @@
 package controller
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
 )
 
 var (
@@ -20,6 +26,42 @@ var (
 		Name: "augmented_networkpolicy_dns_changes_total",
 		Help: "Total number of standard NetworkPolicy spec updates due to DNS changes",
 	})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "augmented_networkpolicy_reconcile_duration_seconds",
+		Help:    "Duration of NetworkPolicy reconciles, including DNS resolution",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"result"})
+
+	policyAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_policy_addresses",
+		Help: "Number of distinct addresses in the rendered policy",
+	}, []string{"namespace", "name"})
+
+	policyFailedHostnames = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_policy_failed_hostnames",
+		Help: "Number of hostnames in the policy that failed to resolve or were rejected in the last reconcile",
+	}, []string{"namespace", "name"})
+
+	policyStaleHostnames = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_policy_stale_hostnames",
+		Help: "Number of hostnames in the policy that resolved before but failed to resolve in the last reconcile",
+	}, []string{"namespace", "name"})
+
+	policiesNotReady = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_policies_not_ready",
+		Help: "Number of NetworkPolicies whose Ready condition is not True",
+	})
+
+	quotaUsageGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_namespace_quota_usage",
+		Help: "Policies, hostnames or addresses counted against the HostnameQuota of a namespace",
+	}, []string{"namespace", "resource"})
+
+	quotaLimitGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_namespace_quota_limit",
+		Help: "Limit on policies, hostnames or addresses set by the HostnameQuotas of a namespace",
+	}, []string{"namespace", "resource"})
 )
 
 func init() {
@@ -27,5 +69,66 @@ func init() {
 		networkPolicyCreations,
 		networkPolicyDeletions,
 		dnsNameChanges,
+		reconcileDuration,
+		policyAddresses,
+		policyFailedHostnames,
+		policyStaleHostnames,
+		policiesNotReady,
+		quotaUsageGauge,
+		quotaLimitGauge,
 	)
 }
+
+var (
+	notReadyMu       sync.Mutex
+	notReadyPolicies = make(map[types.NamespacedName]struct{})
+)
+
+// recordPolicyMetrics updates the per-policy gauges and the not-ready count from the
+// status written in the reconcile at now.
+func recordPolicyMetrics(anp *networkingv1alpha1.NetworkPolicy, addresses int, now metav1.Time) {
+	var failed, stale int
+	seen := make(map[string]bool)
+	for _, rule := range anp.Status.Rules {
+		for _, h := range rule.Hostnames {
+			if seen[h.Hostname] || h.LastError == "" {
+				continue
+			}
+			seen[h.Hostname] = true
+			failed++
+			if h.LastSuccessTime != nil && h.LastSuccessTime.Before(&now) {
+				stale++
+			}
+		}
+	}
+	policyAddresses.WithLabelValues(anp.Namespace, anp.Name).Set(float64(addresses))
+	policyFailedHostnames.WithLabelValues(anp.Namespace, anp.Name).Set(float64(failed))
+	policyStaleHostnames.WithLabelValues(anp.Namespace, anp.Name).Set(float64(stale))
+
+	ready := false
+	for _, c := range anp.Status.Conditions {
+		if c.Type == conditionTypeReady {
+			ready = c.Status == metav1.ConditionTrue
+		}
+	}
+	setNotReady(types.NamespacedName{Namespace: anp.Namespace, Name: anp.Name}, !ready)
+}
+
+// forgetPolicyMetrics removes the metrics of a deleted policy.
+func forgetPolicyMetrics(key types.NamespacedName) {
+	policyAddresses.DeleteLabelValues(key.Namespace, key.Name)
+	policyFailedHostnames.DeleteLabelValues(key.Namespace, key.Name)
+	policyStaleHostnames.DeleteLabelValues(key.Namespace, key.Name)
+	setNotReady(key, false)
+}
+
+func setNotReady(key types.NamespacedName, notReady bool) {
+	notReadyMu.Lock()
+	defer notReadyMu.Unlock()
+	if notReady {
+		notReadyPolicies[key] = struct{}{}
+	} else {
+		delete(notReadyPolicies, key)
+	}
+	policiesNotReady.Set(float64(len(notReadyPolicies)))
+}
@@ -19,20 +19,31 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
 	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
 )
 
 const (
@@ -46,111 +57,133 @@ type NetworkPolicyReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Resolver dns.Resolver
+
+	// SRVResolver looks up the SRV records of SRV peers. Their targets are resolved with Resolver.
+	// SRV peers fail to resolve if it is nil.
+	SRVResolver dns.SRVResolver
+
+	// AuditMode forces every NetworkPolicy into Audit mode, regardless of spec.mode. Unlike
+	// spec.mode, it leaves existing standard NetworkPolicies in place and only stops writing them.
+	AuditMode bool
+
+	// DefaultIPFamilies restricts egress rules that do not set ipFamilies. Empty allows every family.
+	DefaultIPFamilies []dns.IPFamily
+
+	// Recorder emits events about the NetworkPolicy. No events are emitted if it is nil.
+	Recorder events.EventRecorder
+
+	// ConsolidatePolicies merges the standard NetworkPolicies of enforced NetworkPolicies
+	// with identical pod selectors into one policy per selector, owned by all of them.
+	ConsolidatePolicies bool
+
+	// ResolverState, if set, is seeded before the first hostname is resolved so that
+	// changes are detected across restarts and leader changes.
+	ResolverState *ResolverStateSync
 }
 
 // +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies/finalizers,verbs=update
-// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=hostnamepolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=hostnamequotas,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=hostnamesets;clusterhostnamesets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile handles reconciliation of NetworkPolicy custom resources.
-func (r *NetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *NetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("networkpolicy.name", req.Name),
+	))
+	start := time.Now()
+	defer func() {
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		reconcileDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}()
+
 	// Fetch the custom NetworkPolicy
 	var anp networkingv1alpha1.NetworkPolicy
 	if err := r.Get(ctx, req.NamespacedName, &anp); err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("NetworkPolicy resource not found, likely deleted")
 			networkPolicyDeletions.Inc()
+			forgetPolicyMetrics(req.NamespacedName)
+			if r.AuditMode {
+				return ctrl.Result{}, nil
+			}
+			if _, err := r.consolidate(ctx, req.Namespace, req.Name, nil); err != nil {
+				return ctrl.Result{}, err
+			}
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, fmt.Errorf("failed to get NetworkPolicy: %w", err)
 	}
 
-	// Resolve hostnames and build the standard NetworkPolicy
-	resolvedAddresses := make(map[string][]string)
-	var egressRules []networkingv1.NetworkPolicyEgressRule
-	var resolutionErrors []string
-
-	for _, rule := range anp.Spec.Egress {
-		var peers []networkingv1.NetworkPolicyPeer
-		for _, to := range rule.To {
-			cidrs, err := r.Resolver.Resolve(ctx, to.Hostname)
-			if err != nil {
-				logger.Error(err, "failed to resolve hostname", "hostname", to.Hostname)
-				resolutionErrors = append(resolutionErrors, fmt.Sprintf("failed to resolve %q: %v", to.Hostname, err))
-				continue
-			}
-			resolvedAddresses[to.Hostname] = cidrs
-			for _, cidr := range cidrs {
-				peers = append(peers, networkingv1.NetworkPolicyPeer{
-					IPBlock: &networkingv1.IPBlock{
-						CIDR: cidr,
-					},
-				})
-			}
+	if r.ResolverState != nil {
+		if err := r.ResolverState.Seed(ctx); err != nil {
+			return ctrl.Result{}, err
 		}
+	}
+	previousQuarantine := statusQuarantined(&anp.Status)
 
-		// Convert ports
-		var ports []networkingv1.NetworkPolicyPort
-		for _, p := range rule.Ports {
-			port := networkingv1.NetworkPolicyPort{
-				Protocol: p.Protocol,
-				Port:     p.Port,
-				EndPort:  p.EndPort,
-			}
-			ports = append(ports, port)
-		}
+	hostnamePolicies, err := r.hostnamePoliciesFor(ctx, anp.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	resolver, srvResolver := guardResolvers(r.Resolver, r.SRVResolver, hostnamePolicies)
 
-		egressRules = append(egressRules, networkingv1.NetworkPolicyEgressRule{
-			Ports: ports,
-			To:    peers,
-		})
+	sets, missingSets, err := r.hostnameSetsFor(ctx, &anp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	externalNames, invalidServices, err := r.externalNamesFor(ctx, &anp)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
+	expanded := render.ExpandServiceRefs(render.ExpandHostnameSets(&anp.Spec, sets), externalNames)
 
-	// Build the desired standard NetworkPolicy
-	desired := &networkingv1.NetworkPolicy{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      anp.Name,
-			Namespace: anp.Namespace,
-		},
-		Spec: networkingv1.NetworkPolicySpec{
-			PodSelector: anp.Spec.PodSelector,
-			Egress:      egressRules,
-			PolicyTypes: anp.Spec.PolicyTypes,
-		},
+	// Policies over their namespace's quota are rejected before their hostnames are resolved
+	quota, err := r.quotaFor(ctx, &anp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	usage := quotaUsage{policies: 1, hostnames: len(render.Hostnames(expanded))}
+	if exceeded := quota.exceeded(usage); exceeded != "" {
+		return r.rejectOverQuota(ctx, &anp, expanded, quota, usage, exceeded)
 	}
 
-	// Set owner reference for automatic garbage collection
-	if err := controllerutil.SetControllerReference(&anp, desired, r.Scheme); err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to set owner reference: %w", err)
+	// Resolve hostnames and build the standard NetworkPolicy
+	spec := render.WithDefaultIPFamilies(expanded, r.DefaultIPFamilies)
+	resolutions := render.Resolve(ctx, resolver, srvResolver, spec)
+	desired, report := render.Render(spec, resolutions)
+
+	resolutionErrors := make([]string, 0, len(report.Errors))
+	for _, err := range report.Errors {
+		logger.Error(err, "failed to resolve hostname")
+		resolutionErrors = append(resolutionErrors, err.Error())
+	}
+	if len(report.DroppedRules) > 0 {
+		logger.Info("omitting egress rules without resolved peers", "rules", report.DroppedRules)
+	}
+	resolvedAddresses := resolutions.Addresses()
+	usage.addresses = report.AddressCount
+	if exceeded := quota.exceeded(usage); exceeded != "" {
+		return r.rejectOverQuota(ctx, &anp, spec, quota, usage, exceeded)
 	}
 
-	// Create or update the standard NetworkPolicy
-	existing := &networkingv1.NetworkPolicy{}
-	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			logger.Info("creating standard NetworkPolicy", "name", desired.Name)
-			if err := r.Create(ctx, desired); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to create NetworkPolicy: %w", err)
-			}
-			networkPolicyCreations.Inc()
-		} else {
-			return ctrl.Result{}, fmt.Errorf("failed to get existing NetworkPolicy: %w", err)
-		}
-	} else {
-		// Update if spec changed
-		if !equality.Semantic.DeepEqual(existing.Spec, desired.Spec) {
-			existing.Spec = desired.Spec
-			logger.Info("updating standard NetworkPolicy", "name", desired.Name)
-			if err := r.Update(ctx, existing); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to update NetworkPolicy: %w", err)
-			}
-			dnsNameChanges.Inc()
-		}
+	mode := r.effectiveMode(&anp)
+	if err := r.enforce(ctx, &anp, desired); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	// Update status
@@ -160,41 +193,247 @@ func (r *NetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		LastTransitionTime: metav1.Now(),
 	}
 
-	if len(resolutionErrors) > 0 {
+	if len(missingSets) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "HostnameSetNotFound"
+		condition.Message = fmt.Sprintf("referenced hostname sets not found: %s", strings.Join(missingSets, ", "))
+	} else if len(invalidServices) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "InvalidServiceRef"
+		condition.Message = strings.Join(invalidServices, "; ")
+	} else if denied := deniedHostnames(resolutions); len(denied) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "HostnameDenied"
+		condition.Message = fmt.Sprintf("hostnames not allowed by a HostnamePolicy: %s", strings.Join(denied, ", "))
+	} else if len(resolutionErrors) > 0 {
 		condition.Status = metav1.ConditionFalse
 		condition.Reason = "ResolutionFailed"
 		condition.Message = fmt.Sprintf("failed to resolve some hostnames: %v", resolutionErrors)
+	} else if r.AuditMode {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Audited"
+		condition.Message = "All hostnames resolved successfully; rendered policy written to status, " +
+			"the operator runs in audit mode and leaves standard NetworkPolicies unchanged"
+	} else if mode == networkingv1alpha1.PolicyModeAudit {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Audited"
+		condition.Message = "All hostnames resolved successfully; rendered policy written to status and not enforced"
 	} else {
 		condition.Status = metav1.ConditionTrue
 		condition.Reason = "Reconciled"
 		condition.Message = "All hostnames resolved successfully"
 	}
 
+	now := metav1.Now()
 	anp.Status.ResolvedAddresses = resolvedAddresses
+	anp.Status.Rules = buildRuleStatuses(spec, resolutions, anp.Status.Rules, now)
+	anp.Status.HostnameCount = int32(len(render.Hostnames(expanded)))
+	anp.Status.AddressCount = int32(report.AddressCount)
+	anp.Status.LastResolvedTime = &now
 	setCondition(&anp.Status.Conditions, condition)
+	r.setQuarantineCondition(&anp, previousQuarantine, resolutions)
+	setQuotaCondition(&anp)
+	quota.record(anp.Namespace, usage)
+	recordPolicyMetrics(&anp, report.AddressCount, now)
 
-	if err := r.Status().Update(ctx, &anp); err != nil {
+	if err := r.traceWrite(ctx, "status.update", &anp, func(ctx context.Context) error {
+		return r.Status().Update(ctx, &anp)
+	}); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
 	}
 
 	// Requeue for DNS re-resolution
+	return ctrl.Result{RequeueAfter: r.resolutionInterval(ctx, &anp)}, nil
+}
+
+// enforce enforces the rendered standard NetworkPolicy desired for anp according to its
+// effective mode, and records in the status of anp how it is enforced.
+func (r *NetworkPolicyReconciler) enforce(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy, desired *networkingv1.NetworkPolicy,
+) error {
+	desired.Name = anp.Name
+	desired.Namespace = anp.Namespace
+	// Set owner reference for automatic garbage collection
+	if err := controllerutil.SetControllerReference(anp, desired, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set owner reference: %w", err)
+	}
+
+	mode := r.effectiveMode(anp)
+	switch {
+	case r.AuditMode:
+		// The operator-wide dry run does not touch standard NetworkPolicies: those already
+		// enforced stay as they are, and no new ones are created.
+		anp.Status.RenderedPolicy = desired.Spec.DeepCopy()
+	case mode == networkingv1alpha1.PolicyModeAudit:
+		if err := r.removeEnforcedPolicy(ctx, anp); err != nil {
+			return err
+		}
+		anp.Status.RenderedPolicy = desired.Spec.DeepCopy()
+	case r.ConsolidatePolicies:
+		// Enforced by consolidate, alone or merged with the policies selecting the same pods
+		anp.Status.RenderedPolicy = desired.Spec.DeepCopy()
+	default:
+		if err := r.applyNetworkPolicy(ctx, desired); err != nil {
+			return err
+		}
+		anp.Status.RenderedPolicy = nil
+	}
+	anp.Status.Mode = mode
+	if !r.AuditMode {
+		consolidatedInto, err := r.consolidate(ctx, anp.Namespace, anp.Name, anp)
+		if err != nil {
+			return err
+		}
+		anp.Status.ConsolidatedInto = consolidatedInto
+	}
+	return nil
+}
+
+// resolutionInterval returns how long to wait before anp is resolved again.
+func (r *NetworkPolicyReconciler) resolutionInterval(ctx context.Context, anp *networkingv1alpha1.NetworkPolicy) time.Duration {
 	interval := defaultResolutionInterval
 	if anp.Spec.ResolutionInterval != nil {
 		interval = anp.Spec.ResolutionInterval.Duration
 	}
 	if interval < minResolutionInterval {
-		logger.Info("resolutionInterval too low, using minimum", "requested", interval, "minimum", minResolutionInterval)
+		log.FromContext(ctx).Info("resolutionInterval too low, using minimum",
+			"requested", interval, "minimum", minResolutionInterval)
 		interval = minResolutionInterval
 	}
+	return interval
+}
 
-	return ctrl.Result{RequeueAfter: interval}, nil
+// effectiveMode returns the mode a NetworkPolicy should be reconciled in.
+// The operator-wide audit mode takes precedence over the per-object mode.
+func (r *NetworkPolicyReconciler) effectiveMode(anp *networkingv1alpha1.NetworkPolicy) networkingv1alpha1.PolicyMode {
+	if r.AuditMode || anp.Spec.Mode == networkingv1alpha1.PolicyModeAudit {
+		return networkingv1alpha1.PolicyModeAudit
+	}
+	return networkingv1alpha1.PolicyModeEnforce
+}
+
+// applyNetworkPolicy creates the desired standard NetworkPolicy or updates the existing one if its spec differs.
+func (r *NetworkPolicyReconciler) applyNetworkPolicy(ctx context.Context, desired *networkingv1.NetworkPolicy) error {
+	logger := log.FromContext(ctx)
+
+	existing := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get existing NetworkPolicy: %w", err)
+		}
+		logger.Info("creating standard NetworkPolicy", "name", desired.Name)
+		if err := r.traceWrite(ctx, "create", desired, func(ctx context.Context) error {
+			return r.Create(ctx, desired)
+		}); err != nil {
+			return fmt.Errorf("failed to create NetworkPolicy: %w", err)
+		}
+		networkPolicyCreations.Inc()
+		return nil
+	}
+
+	// Update if spec changed
+	if !equality.Semantic.DeepEqual(existing.Spec, desired.Spec) {
+		existing.Spec = desired.Spec
+		logger.Info("updating standard NetworkPolicy", "name", desired.Name)
+		if err := r.traceWrite(ctx, "update", existing, func(ctx context.Context) error {
+			return r.Update(ctx, existing)
+		}); err != nil {
+			return fmt.Errorf("failed to update NetworkPolicy: %w", err)
+		}
+		dnsNameChanges.Inc()
+	}
+	return nil
+}
+
+// removeEnforcedPolicy deletes the standard NetworkPolicy owned by anp, if any.
+// It is used when a NetworkPolicy is switched from Enforce to Audit mode through spec.mode.
+func (r *NetworkPolicyReconciler) removeEnforcedPolicy(ctx context.Context, anp *networkingv1alpha1.NetworkPolicy) error {
+	existing := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(anp), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get existing NetworkPolicy: %w", err)
+	}
+	if !metav1.IsControlledBy(existing, anp) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("deleting standard NetworkPolicy for audited policy", "name", existing.Name)
+	err := r.traceWrite(ctx, "delete", existing, func(ctx context.Context) error {
+		return client.IgnoreNotFound(r.Delete(ctx, existing))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete NetworkPolicy: %w", err)
+	}
+	return nil
+}
+
+// traceWrite runs an API write in a span named after the verb, with the object's kind and name.
+func (r *NetworkPolicyReconciler) traceWrite(
+	ctx context.Context, verb string, obj client.Object, write func(context.Context) error,
+) error {
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		kind = gvk.Kind
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "k8s."+verb, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("k8s.kind", kind),
+		attribute.String("k8s.namespace.name", obj.GetNamespace()),
+		attribute.String("k8s.name", obj.GetName()),
+	))
+	err := write(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// event emits an event about obj if a Recorder is configured.
+func (r *NetworkPolicyReconciler) event(obj runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, nil, eventtype, reason, action, note, args...)
+	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Status-only updates do not trigger reconciliation; the status carries resolution
+// timestamps that change on every reconcile. Annotation changes do, so that setting
+// networkingv1alpha1.ResolveNowAnnotation forces an immediate re-resolution.
+// HostnamePolicy and HostnameQuota changes and namespace label changes re-check the affected policies,
+// and hostname set and Service changes re-resolve the policies referencing them.
+// Changes to a consolidated standard NetworkPolicy reconcile every policy merged into it,
+// and QuarantineAcknowledgements re-resolve the policies reporting the released hostnames.
+// Deleting a policy, or changing what it counts against its namespace's quota, re-checks
+// the policies in the namespace that exceed the quota.
 func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(),
+		&networkingv1alpha1.NetworkPolicy{}, hostnameSetIndex, indexHostnameSets)
+	if err != nil {
+		return fmt.Errorf("failed to index NetworkPolicies by hostname set: %w", err)
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(),
+		&networkingv1alpha1.NetworkPolicy{}, serviceRefIndex, indexServiceRefs)
+	if err != nil {
+		return fmt.Errorf("failed to index NetworkPolicies by Service: %w", err)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1alpha1.NetworkPolicy{}).
-		Owns(&networkingv1.NetworkPolicy{}).
+		For(&networkingv1alpha1.NetworkPolicy{}, builder.WithPredicates(predicate.Or[client.Object](
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))).
+		Owns(&networkingv1.NetworkPolicy{}, builder.MatchEveryOwner).
+		Watches(&networkingv1alpha1.HostnamePolicy{}, handler.EnqueueRequestsFromMapFunc(r.allPolicies)).
+		Watches(&networkingv1alpha1.HostnameQuota{}, handler.EnqueueRequestsFromMapFunc(r.allPolicies)).
+		Watches(&networkingv1alpha1.NetworkPolicy{}, handler.EnqueueRequestsFromMapFunc(r.policiesOverQuota),
+			builder.WithPredicates(quotaUsageChanged())).
+		Watches(&networkingv1alpha1.HostnameSet{}, handler.EnqueueRequestsFromMapFunc(r.policiesForHostnameSet)).
+		Watches(&networkingv1alpha1.ClusterHostnameSet{}, handler.EnqueueRequestsFromMapFunc(r.policiesForClusterHostnameSet)).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.policiesForService)).
+		Watches(&networkingv1alpha1.QuarantineAcknowledgement{},
+			handler.EnqueueRequestsFromMapFunc(r.policiesForQuarantineAcknowledgement)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.policiesInNamespace),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
 		Complete(r)
 }
 
@@ -17,23 +17,32 @@ limitations under the License.
 package controller
 
 import (
+	"fmt"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
 	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
 )
 
@@ -146,8 +155,22 @@ var _ = Describe("NetworkPolicy Controller", func() {
 			Expect(updatedANP.Status.Conditions[0].Type).To(Equal(conditionTypeReady))
 			Expect(updatedANP.Status.Conditions[0].Status).To(Equal(metav1.ConditionTrue))
 
-			// Verify creation metric incremented
+			// Verify per-rule resolution detail and summary fields
+			Expect(updatedANP.Status.HostnameCount).To(Equal(int32(1)))
+			Expect(updatedANP.Status.AddressCount).To(Equal(int32(1)))
+			Expect(updatedANP.Status.LastResolvedTime).NotTo(BeNil())
+			Expect(updatedANP.Status.Rules).To(HaveLen(1))
+			Expect(updatedANP.Status.Rules[0].Hostnames).To(HaveLen(1))
+			hostnameStatus := updatedANP.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.Hostname).To(Equal("example.com"))
+			Expect(hostnameStatus.Addresses).To(ConsistOf("93.184.216.34/32"))
+			Expect(hostnameStatus.Resolver).To(Equal("mock"))
+			Expect(hostnameStatus.LastSuccessTime).NotTo(BeNil())
+			Expect(hostnameStatus.LastError).To(BeEmpty())
+
+			// Verify creation metric incremented and the address gauge set
 			Expect(testutil.ToFloat64(networkPolicyCreations)).To(Equal(creationsBefore + 1))
+			Expect(testutil.ToFloat64(policyAddresses.WithLabelValues(updatedANP.Namespace, updatedANP.Name))).To(Equal(1.0))
 		})
 
 		It("should handle multiple peers in a single egress rule", func() {
@@ -256,6 +279,327 @@ var _ = Describe("NetworkPolicy Controller", func() {
 		})
 	})
 
+	Context("when a hostname stops resolving", func() {
+		It("should record the error and keep the last success time", func() {
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "failing-policy",
+					Namespace: ns.Name,
+				},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{
+							To: []networkingv1alpha1.EgressPeer{
+								{Hostname: "example.com"},
+							},
+						},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var resolved networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &resolved)).To(Succeed())
+			lastSuccess := resolved.Status.Rules[0].Hostnames[0].LastSuccessTime
+			Expect(lastSuccess).NotTo(BeNil())
+
+			reconciler.Resolver = &dnstest.MockResolver{Err: fmt.Errorf("SERVFAIL")}
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var failed networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &failed)).To(Succeed())
+			hostnameStatus := failed.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.LastError).To(ContainSubstring("SERVFAIL"))
+			Expect(hostnameStatus.Addresses).To(BeEmpty())
+			Expect(hostnameStatus.LastSuccessTime).To(Equal(lastSuccess))
+			Expect(failed.Status.AddressCount).To(BeZero())
+			Expect(failed.Status.Conditions[0].Status).To(Equal(metav1.ConditionFalse))
+
+			// The hostname resolved before, so it is counted as stale as well as failed
+			Expect(testutil.ToFloat64(policyFailedHostnames.WithLabelValues(anp.Namespace, anp.Name))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(policyStaleHostnames.WithLabelValues(anp.Namespace, anp.Name))).To(Equal(1.0))
+			notReady := testutil.ToFloat64(policiesNotReady)
+			Expect(notReady).To(BeNumerically(">=", 1))
+
+			Expect(k8sClient.Delete(ctx, anp)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(policiesNotReady)).To(Equal(notReady - 1))
+		})
+	})
+
+	Context("when a hostname's CNAME chain leaves the allowed domains", func() {
+		It("should exclude its addresses and record the chain", func() {
+			reconciler.Resolver = &dnstest.MockResolver{
+				Results: map[string][]string{"api.vendor.com": {"198.51.100.7/32"}},
+				CNAMEs:  map[string][]string{"api.vendor.com": {"edge.tracker.example"}},
+			}
+
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cname-policy",
+					Namespace: ns.Name,
+				},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{
+							To: []networkingv1alpha1.EgressPeer{
+								{Hostname: "api.vendor.com", AllowedCNAMESuffixes: []string{"vendor.com"}},
+							},
+						},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+			Expect(stdNP.Spec.Egress).To(BeEmpty())
+
+			var updatedANP networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &updatedANP)).To(Succeed())
+			hostnameStatus := updatedANP.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.CNAMEChain).To(Equal([]string{"edge.tracker.example"}))
+			Expect(hostnameStatus.Addresses).To(BeEmpty())
+			Expect(hostnameStatus.LastError).To(ContainSubstring("leaves the allowed domains"))
+			Expect(updatedANP.Status.Conditions[0].Status).To(Equal(metav1.ConditionFalse))
+		})
+	})
+
+	Context("when a rule restricts IP families", func() {
+		It("should only allow addresses of those families and record the dropped ones", func() {
+			reconciler.Resolver = &dns.FilteringResolver{
+				Inner: &dnstest.MockResolver{
+					Results: map[string][]string{"dual.example.com": {"192.0.2.1/32", "2001:db8::1/128"}},
+				},
+				Filter: &dns.IPFilter{},
+				Logger: logr.Discard(),
+			}
+
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ipv4-policy",
+					Namespace: ns.Name,
+				},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{
+							IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol},
+							To: []networkingv1alpha1.EgressPeer{
+								{Hostname: "dual.example.com"},
+							},
+						},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+			Expect(stdNP.Spec.Egress).To(HaveLen(1))
+			Expect(stdNP.Spec.Egress[0].To).To(HaveLen(1))
+			Expect(stdNP.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("192.0.2.1/32"))
+
+			var updatedANP networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &updatedANP)).To(Succeed())
+			hostnameStatus := updatedANP.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.Addresses).To(ConsistOf("192.0.2.1/32"))
+			Expect(hostnameStatus.DroppedFamilies).To(ConsistOf(corev1.IPv6Protocol))
+		})
+	})
+
+	Context("when a rule has an SRV peer", func() {
+		It("should allow each SRV target on its discovered port", func() {
+			srv := &dnstest.MockResolver{
+				Results: map[string][]string{
+					"ldap1.corp.example": {"10.0.0.1/32"},
+					"ldap2.corp.example": {"10.0.0.2/32"},
+				},
+				SRV: map[string][]dns.SRVTarget{
+					"_ldap._tcp.corp.example": {
+						{Target: "ldap1.corp.example", Port: 389},
+						{Target: "ldap2.corp.example", Port: 636},
+					},
+				},
+			}
+			reconciler.Resolver = srv
+			reconciler.SRVResolver = srv
+
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "srv-policy",
+					Namespace: ns.Name,
+				},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{
+							To: []networkingv1alpha1.EgressPeer{
+								{SRV: "_ldap._tcp.corp.example"},
+							},
+						},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+			Expect(stdNP.Spec.Egress).To(HaveLen(2))
+			Expect(stdNP.Spec.Egress[0].Ports[0].Port.IntValue()).To(Equal(389))
+			Expect(*stdNP.Spec.Egress[0].Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
+			Expect(stdNP.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("10.0.0.1/32"))
+			Expect(stdNP.Spec.Egress[1].Ports[0].Port.IntValue()).To(Equal(636))
+			Expect(stdNP.Spec.Egress[1].To[0].IPBlock.CIDR).To(Equal("10.0.0.2/32"))
+
+			var updatedANP networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &updatedANP)).To(Succeed())
+			Expect(updatedANP.Status.HostnameCount).To(Equal(int32(1)))
+			hostnameStatus := updatedANP.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.SRV).To(BeTrue())
+			Expect(hostnameStatus.Targets).To(HaveLen(2))
+			Expect(hostnameStatus.Targets[1].Port).To(Equal(int32(636)))
+			Expect(hostnameStatus.Targets[1].Addresses).To(ConsistOf("10.0.0.2/32"))
+		})
+	})
+
+	Context("when a NetworkPolicy is in Audit mode", func() {
+		newAuditPolicy := func(name string, mode networkingv1alpha1.PolicyMode) *networkingv1alpha1.NetworkPolicy {
+			return &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ns.Name,
+				},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "web"},
+					},
+					Egress: []networkingv1alpha1.EgressRule{
+						{
+							To: []networkingv1alpha1.EgressPeer{
+								{Hostname: "example.com"},
+							},
+						},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Mode:        mode,
+				},
+			}
+		}
+
+		It("should write the rendered policy to status without creating it", func() {
+			anp := newAuditPolicy("audit-policy", networkingv1alpha1.PolicyModeAudit)
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}, &stdNP)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			var updatedANP networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}, &updatedANP)).To(Succeed())
+			Expect(updatedANP.Status.Mode).To(Equal(networkingv1alpha1.PolicyModeAudit))
+			Expect(updatedANP.Status.RenderedPolicy).NotTo(BeNil())
+			Expect(updatedANP.Status.RenderedPolicy.Egress).To(HaveLen(1))
+			Expect(updatedANP.Status.RenderedPolicy.Egress[0].To[0].IPBlock.CIDR).To(Equal("93.184.216.34/32"))
+			Expect(updatedANP.Status.Conditions[0].Reason).To(Equal("Audited"))
+		})
+
+		It("should delete the enforced policy when switched to Audit", func() {
+			anp := newAuditPolicy("switch-policy", networkingv1alpha1.PolicyModeEnforce)
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+			anp.Spec.Mode = networkingv1alpha1.PolicyModeAudit
+			Expect(k8sClient.Update(ctx, anp)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, req.NamespacedName, &stdNP)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should leave enforced policies in place in operator-wide audit mode", func() {
+			anp := newAuditPolicy("global-audit-policy", networkingv1alpha1.PolicyModeEnforce)
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var stdNP networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+
+			By("not deleting the existing policy")
+			reconciler.AuditMode = true
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &stdNP)).To(Succeed())
+			Expect(stdNP.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("93.184.216.34/32"))
+
+			var updatedANP networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &updatedANP)).To(Succeed())
+			Expect(updatedANP.Status.Mode).To(Equal(networkingv1alpha1.PolicyModeAudit))
+			Expect(updatedANP.Status.RenderedPolicy).NotTo(BeNil())
+
+			By("not creating policies for new NetworkPolicies")
+			other := newAuditPolicy("global-audit-new-policy", networkingv1alpha1.PolicyModeEnforce)
+			Expect(k8sClient.Create(ctx, other)).To(Succeed())
+			otherReq := reconcile.Request{NamespacedName: types.NamespacedName{Name: other.Name, Namespace: other.Namespace}}
+			_, err = reconciler.Reconcile(ctx, otherReq)
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, otherReq.NamespacedName, &stdNP)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
 	Context("when a NetworkPolicy is deleted", func() {
 		It("should return without error for non-existent resources", func() {
 			deletionsBefore := testutil.ToFloat64(networkPolicyDeletions)
@@ -274,6 +618,139 @@ var _ = Describe("NetworkPolicy Controller", func() {
 		})
 	})
 
+	Context("when a hostname's answer changes scope", func() {
+		It("should quarantine it until acknowledged", func() {
+			mock := &dnstest.MockResolver{Results: map[string][]string{"rebind.example.com": {"93.184.216.34/32"}}}
+			quarantine := dns.NewQuarantine(dns.QuarantineOptions{ScopeChanges: true})
+			recorder := events.NewFakeRecorder(10)
+			reconciler.Resolver = &dns.FilteringResolver{
+				Inner:      mock,
+				Filter:     &dns.IPFilter{},
+				Logger:     logr.Discard(),
+				Quarantine: quarantine,
+			}
+			reconciler.Recorder = recorder
+
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "rebind-policy", Namespace: ns.Name},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{To: []networkingv1alpha1.EgressPeer{{Hostname: "rebind.example.com"}}},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("resolving to a private address")
+			mock.Results["rebind.example.com"] = []string{"10.0.0.1/32"}
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var quarantined networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &quarantined)).To(Succeed())
+			hostnameStatus := quarantined.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.Quarantine).To(Equal(dns.QuarantineReasonScopeChange))
+			Expect(hostnameStatus.Addresses).To(Equal([]string{"93.184.216.34/32"}))
+			condition := apimeta.FindStatusCondition(quarantined.Status.Conditions, conditionTypeQuarantined)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring("rebind.example.com (ScopeChange)"))
+			Expect(recorder.Events).To(Receive(ContainSubstring("Warning HostnameQuarantined")))
+
+			var enforced networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &enforced)).To(Succeed())
+			Expect(enforced.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("93.184.216.34/32"))
+
+			By("acknowledging the quarantine")
+			ack := &networkingv1alpha1.QuarantineAcknowledgement{
+				ObjectMeta: metav1.ObjectMeta{Name: "rebind-ack"},
+				Spec:       networkingv1alpha1.QuarantineAcknowledgementSpec{Hostnames: []string{"*"}},
+			}
+			Expect(k8sClient.Create(ctx, ack)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, ack)).To(Succeed()) })
+			ackReconciler := &QuarantineAcknowledgementReconciler{
+				Client:     k8sClient,
+				Scheme:     k8sClient.Scheme(),
+				Quarantine: quarantine,
+				Recorder:   recorder,
+			}
+			ackReq := reconcile.Request{NamespacedName: types.NamespacedName{Name: ack.Name}}
+			_, err = ackReconciler.Reconcile(ctx, ackReq)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring("Normal QuarantineAcknowledged")))
+			Expect(k8sClient.Get(ctx, ackReq.NamespacedName, ack)).To(Succeed())
+			Expect(ack.Status.Released).To(Equal([]string{"rebind.example.com"}))
+			Expect(ack.Status.ObservedGeneration).To(Equal(ack.Generation))
+			Expect(reconciler.policiesForQuarantineAcknowledgement(ctx, ack)).To(ContainElement(req))
+
+			By("not releasing again for the same generation")
+			_, err = ackReconciler.Reconcile(ctx, ackReq)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).NotTo(Receive())
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var released networkingv1alpha1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, req.NamespacedName, &released)).To(Succeed())
+			hostnameStatus = released.Status.Rules[0].Hostnames[0]
+			Expect(hostnameStatus.Quarantine).To(BeEmpty())
+			Expect(hostnameStatus.Addresses).To(Equal([]string{"10.0.0.1/32"}))
+			condition = apimeta.FindStatusCondition(released.Status.Conditions, conditionTypeQuarantined)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		})
+	})
+
+	Context("when tracing is enabled", func() {
+		It("should record spans for the reconcile, DNS lookups and API writes", func() {
+			exporter := tracetest.NewInMemoryExporter()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+			DeferCleanup(func() { otel.SetTracerProvider(previous) })
+
+			reconciler.Resolver = &dns.FilteringResolver{
+				Inner:  dns.NewInstrumentedResolver(reconciler.Resolver, "mock"),
+				Filter: &dns.IPFilter{},
+				Logger: logr.Discard(),
+			}
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "traced-policy", Namespace: ns.Name},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress: []networkingv1alpha1.EgressRule{
+						{To: []networkingv1alpha1.EgressPeer{{Hostname: "example.com"}}},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			spans := exporter.GetSpans()
+			names := make(map[string]tracetest.SpanStub)
+			for _, s := range spans {
+				names[s.Name] = s
+			}
+			Expect(names).To(HaveKey("Reconcile"))
+			root := names["Reconcile"].SpanContext.SpanID()
+			for _, name := range []string{"render.Resolve", "k8s.create", "k8s.status.update"} {
+				Expect(names).To(HaveKey(name))
+				Expect(names[name].Parent.SpanID()).To(Equal(root), name)
+			}
+			Expect(names["dns.filter"].Parent.SpanID()).To(Equal(names["render.Resolve"].SpanContext.SpanID()))
+			Expect(names["dns.upstream"].Parent.SpanID()).To(Equal(names["dns.filter"].SpanContext.SpanID()))
+		})
+	})
+
 	Context("when custom resolution interval is set", func() {
 		It("should requeue with the specified interval", func() {
 			customInterval := metav1.Duration{Duration: 10 * time.Minute}
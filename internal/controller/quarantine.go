@@ -0,0 +1,217 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+const conditionTypeQuarantined = "Quarantined"
+
+// QuarantineAcknowledgementReconciler releases the hostnames listed in
+// QuarantineAcknowledgements from the quarantine, once per generation.
+type QuarantineAcknowledgementReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Quarantine is the quarantine of the Resolver. Nothing is released if it is nil.
+	Quarantine *dns.Quarantine
+
+	// ResolverState, if set, is seeded before anything is released, so that quarantines
+	// restored from policy status can be acknowledged.
+	ResolverState *ResolverStateSync
+
+	// Recorder emits events about the QuarantineAcknowledgements. No events are emitted if it is nil.
+	Recorder events.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=quarantineacknowledgements,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=quarantineacknowledgements/status,verbs=get;update;patch
+
+// Reconcile releases the hostnames of a QuarantineAcknowledgement whose current generation
+// has not been applied yet, and records them in its status.
+func (r *QuarantineAcknowledgementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var ack networkingv1alpha1.QuarantineAcknowledgement
+	if err := r.Get(ctx, req.NamespacedName, &ack); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ack.Status.ObservedGeneration == ack.Generation {
+		return ctrl.Result{}, nil
+	}
+	if r.ResolverState != nil {
+		if err := r.ResolverState.Seed(ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	var released []string
+	if r.Quarantine != nil {
+		quarantined := r.Quarantine.Quarantined()
+		for _, hostname := range ack.Spec.Hostnames {
+			hostname = strings.TrimSpace(hostname)
+			for _, name := range quarantined {
+				if (hostname == "*" || hostname == name) && r.Quarantine.Acknowledge(name) {
+					released = append(released, name)
+				}
+			}
+		}
+	}
+	slices.Sort(released)
+
+	if len(released) > 0 {
+		log.FromContext(ctx).Info("released quarantined hostnames", "hostnames", released)
+		r.event(&ack, corev1.EventTypeNormal, "QuarantineAcknowledged", "Acknowledge",
+			"Released quarantined hostnames: %s", strings.Join(released, ", "))
+	} else {
+		r.event(&ack, corev1.EventTypeNormal, "NothingReleased", "Acknowledge",
+			"None of the hostnames is quarantined")
+	}
+
+	now := metav1.Now()
+	ack.Status = networkingv1alpha1.QuarantineAcknowledgementStatus{
+		ObservedGeneration: ack.Generation,
+		Released:           released,
+		AcknowledgedTime:   &now,
+	}
+	if err := r.Status().Update(ctx, &ack); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update QuarantineAcknowledgement status: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// event emits an event about obj if a Recorder is configured.
+func (r *QuarantineAcknowledgementReconciler) event(obj runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, nil, eventtype, reason, action, note, args...)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager. Status updates do not
+// trigger reconciliation.
+func (r *QuarantineAcknowledgementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("quarantineacknowledgement").
+		For(&networkingv1alpha1.QuarantineAcknowledgement{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// policiesForQuarantineAcknowledgement returns the policies reporting a hostname that the
+// acknowledgement released as quarantined, so that they re-resolve it.
+func (r *NetworkPolicyReconciler) policiesForQuarantineAcknowledgement(
+	ctx context.Context, obj client.Object,
+) []reconcile.Request {
+	ack, ok := obj.(*networkingv1alpha1.QuarantineAcknowledgement)
+	if !ok || len(ack.Status.Released) == 0 {
+		return nil
+	}
+	var list networkingv1alpha1.NetworkPolicyList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list NetworkPolicies for a QuarantineAcknowledgement")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		quarantined := statusQuarantined(&list.Items[i].Status)
+		for _, hostname := range ack.Status.Released {
+			if _, ok := quarantined[hostname]; ok {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// setQuarantineCondition sets the Quarantined condition of anp from resolutions and
+// emits an event for every hostname that was not quarantined at the previous reconcile.
+// The condition is only added once a hostname has been quarantined.
+func (r *NetworkPolicyReconciler) setQuarantineCondition(
+	anp *networkingv1alpha1.NetworkPolicy, previous map[string]string, resolutions render.Resolutions,
+) {
+	var entries []string
+	for name, res := range resolutions {
+		if res.Err != nil || res.Quarantine == "" {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s (%s)", name, res.Quarantine))
+		if _, ok := previous[name]; !ok {
+			r.event(anp, corev1.EventTypeWarning, "HostnameQuarantined", "Quarantine",
+				"Hostname %s quarantined (%s); its addresses are frozen until acknowledged with a QuarantineAcknowledgement",
+				name, res.Quarantine)
+		}
+	}
+	slices.Sort(entries)
+
+	condition := metav1.Condition{
+		Type:               conditionTypeQuarantined,
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: metav1.Now(),
+	}
+	switch {
+	case len(entries) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RebindingSuspected"
+		condition.Message = fmt.Sprintf("addresses frozen to the last answer before a suspicious change: %s",
+			strings.Join(entries, ", "))
+	case meta.FindStatusCondition(anp.Status.Conditions, conditionTypeQuarantined) != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NoneQuarantined"
+		condition.Message = "No hostnames are quarantined"
+	default:
+		return
+	}
+	setCondition(&anp.Status.Conditions, condition)
+}
+
+// statusQuarantined returns the quarantined hostnames and SRV targets recorded in
+// status, with the reason they were quarantined.
+func statusQuarantined(status *networkingv1alpha1.NetworkPolicyStatus) map[string]string {
+	quarantined := make(map[string]string)
+	for _, rule := range status.Rules {
+		for _, h := range rule.Hostnames {
+			if h.Quarantine != "" {
+				quarantined[h.Hostname] = h.Quarantine
+			}
+			for _, t := range h.Targets {
+				if t.Quarantine != "" {
+					quarantined[t.Target] = t.Quarantine
+				}
+			}
+		}
+	}
+	return quarantined
+}
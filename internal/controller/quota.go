@@ -0,0 +1,291 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+const conditionTypeQuotaExceeded = "QuotaExceeded"
+
+// Values of the resource label of the quota metrics.
+const (
+	quotaResourcePolicies  = "policies"
+	quotaResourceHostnames = "hostnames"
+	quotaResourceAddresses = "addresses"
+)
+
+// quotaUsage is what one or more NetworkPolicies count against a quota.
+type quotaUsage struct {
+	policies, hostnames, addresses int
+}
+
+func (u quotaUsage) add(o quotaUsage) quotaUsage {
+	return quotaUsage{u.policies + o.policies, u.hostnames + o.hostnames, u.addresses + o.addresses}
+}
+
+// namespaceQuota holds the lowest limits of the HostnameQuotas selecting a namespace and
+// the usage of the namespace's other NetworkPolicies that are within the quota.
+type namespaceQuota struct {
+	limits networkingv1alpha1.HostnameQuotaSpec
+	// earlier is the usage of the policies created before the reconciled one, which take
+	// precedence over it; later is the usage of those created after it.
+	earlier, later quotaUsage
+}
+
+// quotaFor returns the quota that applies to the namespace of anp, or nil if there is none.
+func (r *NetworkPolicyReconciler) quotaFor(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy,
+) (*namespaceQuota, error) {
+	var quotas networkingv1alpha1.HostnameQuotaList
+	if err := r.List(ctx, &quotas); err != nil {
+		return nil, fmt.Errorf("failed to list HostnameQuotas: %w", err)
+	}
+	if len(quotas.Items) == 0 {
+		return nil, nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: anp.Namespace}, &ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	var quota *namespaceQuota
+	for _, q := range quotas.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&q.Spec.NamespaceSelector)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "ignoring HostnameQuota with invalid namespace selector", "hostnameQuota", q.Name)
+			continue
+		}
+		if !selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		if quota == nil {
+			quota = &namespaceQuota{}
+		}
+		quota.limits.MaxPolicies = minLimit(quota.limits.MaxPolicies, q.Spec.MaxPolicies)
+		quota.limits.MaxHostnames = minLimit(quota.limits.MaxHostnames, q.Spec.MaxHostnames)
+		quota.limits.MaxAddresses = minLimit(quota.limits.MaxAddresses, q.Spec.MaxAddresses)
+	}
+	if quota == nil {
+		return nil, nil
+	}
+
+	var policies networkingv1alpha1.NetworkPolicyList
+	if err := r.List(ctx, &policies, client.InNamespace(anp.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list NetworkPolicies: %w", err)
+	}
+	for _, p := range policies.Items {
+		if p.Name == anp.Name || meta.IsStatusConditionTrue(p.Status.Conditions, conditionTypeQuotaExceeded) {
+			continue
+		}
+		// Hostnames from hostname sets are only counted in the status of a reconciled policy.
+		hostnames := max(len(render.Hostnames(&p.Spec)), int(p.Status.HostnameCount))
+		usage := quotaUsage{1, hostnames, int(p.Status.AddressCount)}
+		if createdBefore(&p, anp) {
+			quota.earlier = quota.earlier.add(usage)
+		} else {
+			quota.later = quota.later.add(usage)
+		}
+	}
+	return quota, nil
+}
+
+// exceeded describes the limits that usage exceeds on top of the policies created
+// before it, or returns an empty string if it is within the quota.
+func (q *namespaceQuota) exceeded(usage quotaUsage) string {
+	if q == nil {
+		return ""
+	}
+	total := q.earlier.add(usage)
+	var over []string
+	check := func(resource string, limit *int32, used int) {
+		if limit != nil && used > int(*limit) {
+			over = append(over, fmt.Sprintf("%s %d/%d", resource, used, *limit))
+		}
+	}
+	check(quotaResourcePolicies, q.limits.MaxPolicies, total.policies)
+	check(quotaResourceHostnames, q.limits.MaxHostnames, total.hostnames)
+	check(quotaResourceAddresses, q.limits.MaxAddresses, total.addresses)
+	return strings.Join(over, ", ")
+}
+
+// record sets the quota metrics of namespace, given the usage of the reconciled policy.
+func (q *namespaceQuota) record(namespace string, usage quotaUsage) {
+	quotaUsageGauge.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	quotaLimitGauge.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	if q == nil {
+		return
+	}
+	total := q.earlier.add(usage).add(q.later)
+	set := func(resource string, limit *int32, used int) {
+		if limit != nil {
+			quotaUsageGauge.WithLabelValues(namespace, resource).Set(float64(used))
+			quotaLimitGauge.WithLabelValues(namespace, resource).Set(float64(*limit))
+		}
+	}
+	set(quotaResourcePolicies, q.limits.MaxPolicies, total.policies)
+	set(quotaResourceHostnames, q.limits.MaxHostnames, total.hostnames)
+	set(quotaResourceAddresses, q.limits.MaxAddresses, total.addresses)
+}
+
+// rejectOverQuota records in the status of anp that it exceeds its namespace's quota.
+// Its hostnames are not resolved, and it is enforced as if none of them had resolved, so
+// that the addresses it was last rendered with are not left in place: egress rules with
+// hostname peers are omitted, and the selected pods stay isolated for egress.
+func (r *NetworkPolicyReconciler) rejectOverQuota(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy, spec *networkingv1alpha1.NetworkPolicySpec,
+	quota *namespaceQuota, usage quotaUsage, message string,
+) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("NetworkPolicy exceeds the namespace quota", "exceeded", message)
+	if !meta.IsStatusConditionTrue(anp.Status.Conditions, conditionTypeQuotaExceeded) {
+		r.event(anp, corev1.EventTypeWarning, "QuotaExceeded", "Reconcile",
+			"NetworkPolicy exceeds the HostnameQuota of its namespace: %s", message)
+	}
+
+	desired, _ := render.Render(spec, nil)
+	if len(desired.Spec.PolicyTypes) == 0 && len(spec.Egress) > 0 {
+		// Without its egress rules, the API server would no longer default the policy to
+		// isolate the selected pods for egress.
+		desired.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+	}
+	if err := r.enforce(ctx, anp, desired); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	setCondition(&anp.Status.Conditions, metav1.Condition{
+		Type:               conditionTypeReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "QuotaExceeded",
+		Message:            fmt.Sprintf("namespace quota exceeded (%s); hostnames are not resolved or allowed", message),
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: now,
+	})
+	setCondition(&anp.Status.Conditions, metav1.Condition{
+		Type:               conditionTypeQuotaExceeded,
+		Status:             metav1.ConditionTrue,
+		Reason:             "LimitExceeded",
+		Message:            message,
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: now,
+	})
+	anp.Status.ResolvedAddresses = nil
+	anp.Status.Rules = nil
+	anp.Status.HostnameCount = int32(usage.hostnames)
+	anp.Status.AddressCount = 0
+	quota.record(anp.Namespace, quotaUsage{})
+	recordPolicyMetrics(anp, 0, now)
+
+	if err := r.traceWrite(ctx, "status.update", anp, func(ctx context.Context) error {
+		return r.Status().Update(ctx, anp)
+	}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+	return ctrl.Result{RequeueAfter: r.resolutionInterval(ctx, anp)}, nil
+}
+
+// quotaUsageChanged passes events of NetworkPolicies that may leave room in the quota for
+// the policies created after them: deletions, and updates that change their spec, the
+// hostnames or addresses they count, or whether they are over quota themselves.
+func quotaUsageChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		DeleteFunc: func(event.DeleteEvent) bool { return true },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldANP, ok := e.ObjectOld.(*networkingv1alpha1.NetworkPolicy)
+			if !ok {
+				return false
+			}
+			newANP, ok := e.ObjectNew.(*networkingv1alpha1.NetworkPolicy)
+			if !ok {
+				return false
+			}
+			return oldANP.Generation != newANP.Generation ||
+				oldANP.Status.HostnameCount != newANP.Status.HostnameCount ||
+				oldANP.Status.AddressCount != newANP.Status.AddressCount ||
+				meta.IsStatusConditionTrue(oldANP.Status.Conditions, conditionTypeQuotaExceeded) !=
+					meta.IsStatusConditionTrue(newANP.Status.Conditions, conditionTypeQuotaExceeded)
+		},
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// policiesOverQuota enqueues the other NetworkPolicies in the namespace of a deleted or
+// changed NetworkPolicy that exceed its quota, since they may fit in it now.
+func (r *NetworkPolicyReconciler) policiesOverQuota(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list networkingv1alpha1.NetworkPolicyList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list NetworkPolicies")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, anp := range list.Items {
+		if anp.Name != obj.GetName() && meta.IsStatusConditionTrue(anp.Status.Conditions, conditionTypeQuotaExceeded) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&anp)})
+		}
+	}
+	return requests
+}
+
+// setQuotaCondition clears the QuotaExceeded condition of a policy within its quota.
+// The condition is only added once the policy has exceeded its quota.
+func setQuotaCondition(anp *networkingv1alpha1.NetworkPolicy) {
+	if meta.FindStatusCondition(anp.Status.Conditions, conditionTypeQuotaExceeded) == nil {
+		return
+	}
+	setCondition(&anp.Status.Conditions, metav1.Condition{
+		Type:               conditionTypeQuotaExceeded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "WithinQuota",
+		Message:            "The NetworkPolicy is within the quota of its namespace",
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// createdBefore orders policies by creation time, then name.
+func createdBefore(a, b *networkingv1alpha1.NetworkPolicy) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+func minLimit(a, b *int32) *int32 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("HostnameQuota", func() {
+	It("should reject policies beyond the namespace quota", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "quota-ns-",
+			Labels:       map[string]string{"hostname-quota-test": "limited"},
+		}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		quota := &networkingv1alpha1.HostnameQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "limited"},
+			Spec: networkingv1alpha1.HostnameQuotaSpec{
+				NamespaceSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"hostname-quota-test": "limited"},
+				},
+				MaxHostnames: ptr.To[int32](3),
+				MaxAddresses: ptr.To[int32](10),
+			},
+		}
+		Expect(k8sClient.Create(ctx, quota)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, quota)).To(Succeed()) })
+
+		reconciler := &NetworkPolicyReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+			Resolver: &dnstest.MockResolver{Results: map[string][]string{
+				"a.example.com": {"192.0.2.1/32"},
+				"b.example.com": {"192.0.2.2/32"},
+				"c.example.com": {"192.0.2.3/32"},
+			}},
+		}
+		policy := func(name string, hostnames ...string) reconcile.Request {
+			var peers []networkingv1alpha1.EgressPeer
+			for _, h := range hostnames {
+				peers = append(peers, networkingv1alpha1.EgressPeer{Hostname: h})
+			}
+			anp := &networkingv1alpha1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name},
+				Spec: networkingv1alpha1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Egress:      []networkingv1alpha1.EgressRule{{To: peers}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+			return reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: ns.Name}}
+		}
+		first := policy("a-policy", "a.example.com", "b.example.com")
+		second := policy("b-policy", "b.example.com", "c.example.com")
+
+		_, err := reconciler.Reconcile(ctx, first)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconciler.Reconcile(ctx, second)
+		Expect(err).NotTo(HaveOccurred())
+
+		var admitted, rejected networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, first.NamespacedName, &admitted)).To(Succeed())
+		Expect(apimeta.IsStatusConditionTrue(admitted.Status.Conditions, conditionTypeReady)).To(BeTrue())
+		Expect(apimeta.FindStatusCondition(admitted.Status.Conditions, conditionTypeQuotaExceeded)).To(BeNil())
+
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &rejected)).To(Succeed())
+		Expect(apimeta.IsStatusConditionTrue(rejected.Status.Conditions, conditionTypeQuotaExceeded)).To(BeTrue())
+		ready := apimeta.FindStatusCondition(rejected.Status.Conditions, conditionTypeReady)
+		Expect(ready.Reason).To(Equal("QuotaExceeded"))
+		Expect(ready.Message).To(ContainSubstring("hostnames 4/3"))
+		Expect(rejected.Status.Rules).To(BeEmpty())
+		var enforced networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress).To(BeEmpty())
+		Expect(enforced.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeEgress))
+
+		Expect(testutil.ToFloat64(quotaUsageGauge.WithLabelValues(ns.Name, quotaResourceHostnames))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(quotaLimitGauge.WithLabelValues(ns.Name, quotaResourceHostnames))).To(Equal(3.0))
+
+		By("admitting the policy once the quota is raised")
+		quota.Spec.MaxHostnames = ptr.To[int32](4)
+		Expect(k8sClient.Update(ctx, quota)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &rejected)).To(Succeed())
+		quotaCondition := apimeta.FindStatusCondition(rejected.Status.Conditions, conditionTypeQuotaExceeded)
+		Expect(quotaCondition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(apimeta.IsStatusConditionTrue(rejected.Status.Conditions, conditionTypeReady)).To(BeTrue())
+		Expect(testutil.ToFloat64(quotaUsageGauge.WithLabelValues(ns.Name, quotaResourceHostnames))).To(Equal(4.0))
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress).To(HaveLen(1))
+
+		By("withdrawing the addresses of an admitted policy once it exceeds the quota")
+		quota.Spec.MaxHostnames = ptr.To[int32](3)
+		Expect(k8sClient.Update(ctx, quota)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &rejected)).To(Succeed())
+		Expect(apimeta.IsStatusConditionTrue(rejected.Status.Conditions, conditionTypeQuotaExceeded)).To(BeTrue())
+		Expect(rejected.Status.ResolvedAddresses).To(BeEmpty())
+		Expect(k8sClient.Get(ctx, second.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress).To(BeEmpty())
+
+		By("enqueueing the rejected policy when an earlier policy is deleted")
+		Expect(k8sClient.Get(ctx, first.NamespacedName, &admitted)).To(Succeed())
+		Expect(reconciler.policiesOverQuota(ctx, &admitted)).To(ConsistOf(second))
+		Expect(quotaUsageChanged().Delete(event.DeleteEvent{Object: &admitted})).To(BeTrue())
+		shrunk := admitted.DeepCopy()
+		shrunk.Status.HostnameCount = 1
+		Expect(quotaUsageChanged().Update(event.UpdateEvent{ObjectOld: &admitted, ObjectNew: shrunk})).To(BeTrue())
+		Expect(quotaUsageChanged().Update(event.UpdateEvent{ObjectOld: &admitted, ObjectNew: admitted.DeepCopy()})).
+			To(BeFalse())
+		Expect(reconciler.policiesOverQuota(ctx, &rejected)).To(BeEmpty())
+	})
+})
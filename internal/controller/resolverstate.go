@@ -0,0 +1,182 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+const defaultEvictionInterval = 10 * time.Minute
+
+// ResolverStateSync keeps the change detection state of a dns.FilteringResolver in
+// line with the NetworkPolicies. It seeds the last answer of every hostname from the
+// addresses recorded in their status, so that a new leader detects changes made while
+// it was not running, restores the quarantines recorded in their status, and
+// periodically evicts hostnames no policy references.
+type ResolverStateSync struct {
+	Client   client.Reader
+	Resolver *dns.FilteringResolver
+
+	// EvictionInterval is how often unreferenced hostnames are evicted. Defaults to 10 minutes.
+	EvictionInterval time.Duration
+
+	mu     sync.Mutex
+	seeded bool
+}
+
+// Seed seeds the resolver and its quarantine from the status of every NetworkPolicy.
+// Only the first successful call has an effect.
+func (s *ResolverStateSync) Seed(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seeded {
+		return nil
+	}
+
+	var list networkingv1alpha1.NetworkPolicyList
+	if err := s.Client.List(ctx, &list); err != nil {
+		return fmt.Errorf("failed to list NetworkPolicies: %w", err)
+	}
+	answers := make(map[string][]string)
+	for _, anp := range list.Items {
+		for hostname, addresses := range anp.Status.ResolvedAddresses {
+			// Policies restricted to different IP families record different subsets.
+			for _, address := range addresses {
+				if !slices.Contains(answers[hostname], address) {
+					answers[hostname] = append(answers[hostname], address)
+				}
+			}
+		}
+	}
+	s.Resolver.Seed(answers)
+	restored := 0
+	if s.Resolver.Quarantine != nil {
+		reasons, frozen := quarantinedInStatus(list.Items)
+		for hostname, reason := range reasons {
+			s.Resolver.Quarantine.Restore(hostname, reason, frozen[hostname])
+		}
+		restored = len(reasons)
+	}
+	s.seeded = true
+	log.FromContext(ctx).Info("seeded DNS change detection from NetworkPolicy status",
+		"hostnames", len(answers), "quarantined", restored)
+	return nil
+}
+
+// quarantinedInStatus returns the reason of every hostname and SRV target the policies
+// report as quarantined, and the union of the frozen addresses they report for it.
+func quarantinedInStatus(policies []networkingv1alpha1.NetworkPolicy) (map[string]string, map[string][]string) {
+	reasons := make(map[string]string)
+	frozen := make(map[string][]string)
+	add := func(name, reason string, addresses []string) {
+		reasons[name] = reason
+		for _, address := range addresses {
+			if !slices.Contains(frozen[name], address) {
+				frozen[name] = append(frozen[name], address)
+			}
+		}
+	}
+	for _, anp := range policies {
+		for _, rule := range anp.Status.Rules {
+			for _, h := range rule.Hostnames {
+				if h.Quarantine != "" {
+					add(h.Hostname, h.Quarantine, h.Addresses)
+				}
+				for _, t := range h.Targets {
+					if t.Quarantine != "" {
+						add(t.Target, t.Quarantine, t.Addresses)
+					}
+				}
+			}
+		}
+	}
+	return reasons, frozen
+}
+
+// Evict stops tracking hostnames that are not referenced by any NetworkPolicy.
+func (s *ResolverStateSync) Evict(ctx context.Context) error {
+	var list networkingv1alpha1.NetworkPolicyList
+	if err := s.Client.List(ctx, &list); err != nil {
+		return fmt.Errorf("failed to list NetworkPolicies: %w", err)
+	}
+	referenced := make(map[string]bool)
+	for _, anp := range list.Items {
+		for _, name := range render.Hostnames(&anp.Spec) {
+			referenced[name] = true
+		}
+		for hostname := range anp.Status.ResolvedAddresses {
+			referenced[hostname] = true
+		}
+		for _, rule := range anp.Status.Rules {
+			for _, h := range rule.Hostnames {
+				for _, t := range h.Targets {
+					referenced[t.Target] = true
+				}
+			}
+		}
+	}
+	if evicted := s.Resolver.Retain(func(hostname string) bool { return referenced[hostname] }); evicted > 0 {
+		log.FromContext(ctx).Info("evicted unreferenced hostnames from DNS change detection", "hostnames", evicted)
+	}
+	return nil
+}
+
+// Start seeds the resolver and evicts unreferenced hostnames until ctx is done.
+func (s *ResolverStateSync) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("resolver-state")
+	ctx = log.IntoContext(ctx, logger)
+	if err := s.Seed(ctx); err != nil {
+		logger.Error(err, "failed to seed DNS change detection")
+	}
+
+	interval := s.EvictionInterval
+	if interval <= 0 {
+		interval = defaultEvictionInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Seed(ctx); err != nil {
+				logger.Error(err, "failed to seed DNS change detection")
+				continue
+			}
+			if err := s.Evict(ctx); err != nil {
+				logger.Error(err, "failed to evict unreferenced hostnames")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes only the leader, which resolves hostnames, track them.
+func (s *ResolverStateSync) NeedLeaderElection() bool {
+	return true
+}
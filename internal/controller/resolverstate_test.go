@@ -0,0 +1,126 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("ResolverStateSync", func() {
+	It("should seed from status and evict unreferenced hostnames", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "state-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		anp := &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "stateful-policy", Namespace: ns.Name},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Egress: []networkingv1alpha1.EgressRule{
+					{To: []networkingv1alpha1.EgressPeer{{Hostname: "state.example.com"}}},
+				},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+		anp.Status.ResolvedAddresses = map[string][]string{"state.example.com": {"93.184.216.34/32"}}
+		Expect(k8sClient.Status().Update(ctx, anp)).To(Succeed())
+
+		mock := &dnstest.MockResolver{Results: map[string][]string{
+			"state.example.com": {"10.0.0.1/32"},
+			"gone.example.com":  {"93.184.216.35/32"},
+		}}
+		resolver := &dns.FilteringResolver{
+			Inner:      mock,
+			Filter:     &dns.IPFilter{},
+			Logger:     logr.Discard(),
+			Quarantine: dns.NewQuarantine(dns.QuarantineOptions{ScopeChanges: true}),
+		}
+		sync := &ResolverStateSync{Client: k8sClient, Resolver: resolver}
+		Expect(sync.Seed(ctx)).To(Succeed())
+
+		By("detecting a change made before the operator started")
+		answer, err := resolver.Resolve(ctx, "state.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(answer.Quarantine).To(Equal(dns.QuarantineReasonScopeChange))
+		Expect(answer.Addresses).To(Equal([]string{"93.184.216.34/32"}))
+
+		By("evicting hostnames no policy references")
+		_, err = resolver.Resolve(ctx, "gone.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sync.Evict(ctx)).To(Succeed())
+		// The quarantine of a referenced hostname is kept.
+		answer, err = resolver.Resolve(ctx, "state.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(answer.Quarantine).To(Equal(dns.QuarantineReasonScopeChange))
+		Expect(resolver.Retain(func(hostname string) bool { return hostname != "gone.example.com" })).To(BeZero())
+	})
+
+	It("should restore quarantines recorded in status", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "state-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		anp := &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "quarantined-policy", Namespace: ns.Name},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Egress: []networkingv1alpha1.EgressRule{
+					{To: []networkingv1alpha1.EgressPeer{{Hostname: "flapping.example.com"}}},
+				},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+		anp.Status.ResolvedAddresses = map[string][]string{"flapping.example.com": {"93.184.216.34/32"}}
+		anp.Status.Rules = []networkingv1alpha1.EgressRuleStatus{{
+			Hostnames: []networkingv1alpha1.HostnameStatus{{
+				Hostname:   "flapping.example.com",
+				Addresses:  []string{"93.184.216.34/32"},
+				Quarantine: dns.QuarantineReasonFlapping,
+			}},
+		}}
+		Expect(k8sClient.Status().Update(ctx, anp)).To(Succeed())
+
+		// The new answer alone would not quarantine the hostname.
+		mock := &dnstest.MockResolver{Results: map[string][]string{"flapping.example.com": {"93.184.216.35/32"}}}
+		resolver := &dns.FilteringResolver{
+			Inner:      mock,
+			Filter:     &dns.IPFilter{},
+			Logger:     logr.Discard(),
+			Quarantine: dns.NewQuarantine(dns.QuarantineOptions{MaxChanges: 5, Window: time.Hour}),
+		}
+		sync := &ResolverStateSync{Client: k8sClient, Resolver: resolver}
+		Expect(sync.Seed(ctx)).To(Succeed())
+		Expect(resolver.Quarantine.Quarantined()).To(ContainElement("flapping.example.com"))
+
+		answer, err := resolver.Resolve(ctx, "flapping.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(answer.Quarantine).To(Equal(dns.QuarantineReasonFlapping))
+		Expect(answer.Addresses).To(Equal([]string{"93.184.216.34/32"}))
+	})
+})
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// serviceRefIndex indexes NetworkPolicies by the names of the Services they reference.
+const serviceRefIndex = "spec.egress.to.serviceRef"
+
+// indexServiceRefs returns the index values of serviceRefIndex for a NetworkPolicy.
+func indexServiceRefs(obj client.Object) []string {
+	anp, ok := obj.(*networkingv1alpha1.NetworkPolicy)
+	if !ok {
+		return nil
+	}
+	return render.ServiceRefs(&anp.Spec)
+}
+
+// externalNamesFor returns the external names of the Services referenced by anp, and why
+// the referenced Services that cannot be used are not.
+func (r *NetworkPolicyReconciler) externalNamesFor(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy,
+) (map[string]string, []string, error) {
+	names := render.ServiceRefs(&anp.Spec)
+	if len(names) == 0 {
+		return nil, nil, nil
+	}
+
+	externalNames := make(map[string]string, len(names))
+	var invalid []string
+	for _, name := range names {
+		var svc corev1.Service
+		err := r.Get(ctx, client.ObjectKey{Namespace: anp.Namespace, Name: name}, &svc)
+		switch {
+		case apierrors.IsNotFound(err):
+			invalid = append(invalid, fmt.Sprintf("Service %q not found", name))
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to get Service %q: %w", name, err)
+		case svc.Spec.Type != corev1.ServiceTypeExternalName || svc.Spec.ExternalName == "":
+			invalid = append(invalid, fmt.Sprintf("Service %q is not of type ExternalName", name))
+		default:
+			externalNames[name] = svc.Spec.ExternalName
+		}
+	}
+	return externalNames, invalid, nil
+}
+
+// policiesForService enqueues the NetworkPolicies that reference a changed Service.
+func (r *NetworkPolicyReconciler) policiesForService(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.policyRequests(ctx, client.InNamespace(obj.GetNamespace()), client.MatchingFields{serviceRefIndex: obj.GetName()})
+}
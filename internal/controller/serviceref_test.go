@@ -0,0 +1,110 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var _ = Describe("ServiceRef", func() {
+	servicePolicy := func(name, namespace string, services ...string) *networkingv1alpha1.NetworkPolicy {
+		var peers []networkingv1alpha1.EgressPeer
+		for _, svc := range services {
+			peers = append(peers, networkingv1alpha1.EgressPeer{ServiceRef: &networkingv1alpha1.ServiceReference{Name: svc}})
+		}
+		return &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Egress:      []networkingv1alpha1.EgressRule{{To: peers}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+	}
+
+	It("should resolve the external name of referenced Services", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "service-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		external := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "billing-api", Namespace: ns.Name},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "api.billing.example"},
+		}
+		Expect(k8sClient.Create(ctx, external)).To(Succeed())
+		internal := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns.Name},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		}
+		Expect(k8sClient.Create(ctx, internal)).To(Succeed())
+
+		anp := servicePolicy("service-policy", ns.Name, "billing-api", "web")
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+
+		reconciler := &NetworkPolicyReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+			Resolver: &dnstest.MockResolver{Results: map[string][]string{
+				"api.billing.example": {"192.0.2.10/32"},
+			}},
+		}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}}
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var updated networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &updated)).To(Succeed())
+		ready := apimeta.FindStatusCondition(updated.Status.Conditions, conditionTypeReady)
+		Expect(ready.Reason).To(Equal("InvalidServiceRef"))
+		Expect(ready.Message).To(Equal(`Service "web" is not of type ExternalName`))
+		Expect(updated.Status.ResolvedAddresses).To(HaveKeyWithValue("api.billing.example", []string{"192.0.2.10/32"}))
+
+		var enforced networkingv1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, req.NamespacedName, &enforced)).To(Succeed())
+		Expect(enforced.Spec.Egress[0].To).To(HaveLen(1))
+		Expect(enforced.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("192.0.2.10/32"))
+	})
+
+	It("should enqueue the policies referencing a changed Service", func() {
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithIndex(&networkingv1alpha1.NetworkPolicy{}, serviceRefIndex, indexServiceRefs).
+			WithObjects(
+				servicePolicy("uses-billing", "team-a", "billing-api"),
+				servicePolicy("other-namespace", "team-b", "billing-api"),
+				servicePolicy("uses-nothing", "team-a"),
+			).
+			Build()
+		reconciler := &NetworkPolicyReconciler{Client: c, Scheme: scheme.Scheme}
+
+		Expect(reconciler.policiesForService(ctx, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "billing-api", Namespace: "team-a"},
+		})).To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Name: "uses-billing", Namespace: "team-a"}}))
+	})
+})
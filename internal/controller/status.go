@@ -0,0 +1,137 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// buildRuleStatuses returns the per-rule, per-hostname resolution detail for spec.
+// LastSuccessTime is carried over from previous for hostnames that failed to resolve now.
+// Hostnames whose CNAME chain or DNSSEC result is not allowed by the peer report the
+// violation as LastError. Reference peers that were not expanded are omitted.
+func buildRuleStatuses(
+	spec *networkingv1alpha1.NetworkPolicySpec,
+	resolutions render.Resolutions,
+	previous []networkingv1alpha1.EgressRuleStatus,
+	now metav1.Time,
+) []networkingv1alpha1.EgressRuleStatus {
+	lastSuccess := make(map[string]*metav1.Time)
+	for _, rule := range previous {
+		for _, h := range rule.Hostnames {
+			if h.LastSuccessTime != nil {
+				lastSuccess[h.Hostname] = h.LastSuccessTime
+			}
+		}
+	}
+
+	rules := make([]networkingv1alpha1.EgressRuleStatus, 0, len(spec.Egress))
+	for i, rule := range spec.Egress {
+		ruleStatus := networkingv1alpha1.EgressRuleStatus{Index: int32(i)}
+		for _, to := range rule.To {
+			if render.IsReference(to) {
+				// The set or Service was not found; the Ready condition reports it.
+				continue
+			}
+			name := render.PeerName(to)
+			res, ok := resolutions[name]
+			hs := networkingv1alpha1.HostnameStatus{Hostname: name, SRV: to.SRV != ""}
+			switch {
+			case !ok:
+				hs.LastError = "hostname was not resolved"
+				hs.LastSuccessTime = lastSuccess[name]
+			case res.Err != nil:
+				hs.LastError = res.Err.Error()
+				hs.LastSuccessTime = lastSuccess[name]
+			case hs.SRV:
+				hs.Targets, hs.DroppedFamilies = srvTargetStatuses(to, res.SRV, resolutions, render.PeerIPFamilies(rule, to))
+				hs.LastSuccessTime = now.DeepCopy()
+				if len(hs.Targets) > 0 {
+					hs.Resolver = resolutions[res.SRV[0].Target].Resolver
+				}
+			default:
+				hs.Resolver = res.Resolver
+				hs.CNAMEChain = res.CNAMEChain
+				hs.DNSSEC = string(res.DNSSEC)
+				hs.Quarantine = res.Quarantine
+				hs.LastSuccessTime = now.DeepCopy()
+				if err := render.CheckPeer(to, res.Answer); err != nil {
+					hs.LastError = err.Error()
+					break
+				}
+				answer := render.PeerAnswer(res.Answer, render.PeerIPFamilies(rule, to))
+				hs.Addresses = answer.Addresses
+				hs.FilteredAddresses = answer.Filtered
+				hs.DroppedFamilies = toCoreIPFamilies(answer.DroppedFamilies)
+			}
+			ruleStatus.Hostnames = append(ruleStatus.Hostnames, hs)
+		}
+		rules = append(rules, ruleStatus)
+	}
+	return rules
+}
+
+// srvTargetStatuses returns the status of each target of an SRV peer and its resolved
+// addresses of the given families, and the families dropped from any target.
+func srvTargetStatuses(
+	peer networkingv1alpha1.EgressPeer, targets []dns.SRVTarget, resolutions render.Resolutions, families []dns.IPFamily,
+) ([]networkingv1alpha1.SRVTargetStatus, []corev1.IPFamily) {
+	statuses := make([]networkingv1alpha1.SRVTargetStatus, 0, len(targets))
+	var dropped []dns.IPFamily
+	for _, t := range targets {
+		ts := networkingv1alpha1.SRVTargetStatus{Target: t.Target, Port: int32(t.Port)}
+		res, ok := resolutions[t.Target]
+		switch {
+		case !ok:
+			ts.LastError = "hostname was not resolved"
+		case res.Err != nil:
+			ts.LastError = res.Err.Error()
+		default:
+			ts.DNSSEC = string(res.DNSSEC)
+			ts.Quarantine = res.Quarantine
+			if err := render.CheckDNSSEC(peer, t.Target, res.Answer); err != nil {
+				ts.LastError = err.Error()
+				break
+			}
+			answer := render.PeerAnswer(res.Answer, families)
+			ts.Addresses = answer.Addresses
+			ts.FilteredAddresses = answer.Filtered
+			for _, family := range answer.DroppedFamilies {
+				if !slices.Contains(dropped, family) {
+					dropped = append(dropped, family)
+				}
+			}
+		}
+		statuses = append(statuses, ts)
+	}
+	return statuses, toCoreIPFamilies(dns.SortIPFamilies(dropped))
+}
+
+func toCoreIPFamilies(families []dns.IPFamily) []corev1.IPFamily {
+	var out []corev1.IPFamily
+	for _, family := range families {
+		out = append(out, corev1.IPFamily(family))
+	}
+	return out
+}
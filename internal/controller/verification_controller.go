@@ -0,0 +1,311 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/probe"
+)
+
+const conditionTypeVerified = "Verified"
+
+const (
+	defaultVerificationInterval = time.Hour
+	// verificationRetryInterval is how long to wait before checking again a policy that
+	// could not be verified yet, e.g. because its hostnames have not been resolved.
+	verificationRetryInterval = time.Minute
+	// DefaultMaxConcurrentProbes is the default number of NetworkPolicies probed at the same time.
+	DefaultMaxConcurrentProbes = 4
+)
+
+// VerificationReconciler probes the connectivity of NetworkPolicies with spec.verification
+// set, from a pod selected by the policy to each resolved destination, and records the
+// outcome in the Verified condition.
+type VerificationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Prober runs the probes.
+	Prober probe.Prober
+
+	// MaxConcurrentProbes is how many policies are probed at the same time. A probe can take
+	// up to the probe timeout, during which a worker is busy. Defaults to DefaultMaxConcurrentProbes.
+	MaxConcurrentProbes int
+
+	// Recorder emits events about the NetworkPolicies. No events are emitted if it is nil.
+	Recorder events.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods/exec,verbs=create
+
+// Reconcile verifies the connectivity of a NetworkPolicy when it is due.
+func (r *VerificationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var anp networkingv1alpha1.NetworkPolicy
+	if err := r.Get(ctx, req.NamespacedName, &anp); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !anp.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	if anp.Spec.Verification == nil {
+		return ctrl.Result{}, r.clearVerification(ctx, &anp)
+	}
+
+	interval := defaultVerificationInterval
+	if anp.Spec.Verification.Interval != nil {
+		interval = anp.Spec.Verification.Interval.Duration
+	}
+	if wait := verificationDue(&anp, interval, time.Now()); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if anp.Status.Mode == networkingv1alpha1.PolicyModeAudit {
+		return r.setUnverified(ctx, &anp, "NotEnforced", "The NetworkPolicy is not enforced in Audit mode")
+	}
+	targets := verificationTargets(&anp)
+	if len(targets) == 0 {
+		return r.setUnverified(ctx, &anp, "NoTargets",
+			"No resolved destinations with a numeric TCP port to probe")
+	}
+
+	source := probe.Source{
+		Namespace: anp.Namespace,
+		Selector:  &anp.Spec.PodSelector,
+		PodName:   anp.Spec.Verification.PodName,
+		Container: anp.Spec.Verification.Container,
+		Owner:     &anp,
+	}
+	results, err := r.Prober.Probe(ctx, source, targets)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to probe connectivity")
+		r.event(&anp, corev1.EventTypeWarning, "ProbeFailed", "Verify", "Connectivity could not be probed: %v", err)
+		// A failed probe is only retried after interval, so that a probe pod that cannot
+		// start is not recreated every minute.
+		attempted := metav1.Now()
+		if err := r.updateVerification(ctx, &anp, &metav1.Condition{
+			Type:               conditionTypeVerified,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "ProbeFailed",
+			Message:            err.Error(),
+			ObservedGeneration: anp.Generation,
+			LastTransitionTime: attempted,
+		}, &attempted); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	var unreachable []string
+	for _, res := range results {
+		if !res.Reachable {
+			unreachable = append(unreachable, res.Target.String())
+		}
+	}
+	condition := metav1.Condition{
+		Type:               conditionTypeVerified,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reachable",
+		Message:            fmt.Sprintf("All %d destinations are reachable", len(results)),
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: metav1.Now(),
+	}
+	if len(unreachable) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unreachable"
+		condition.Message = fmt.Sprintf("%d of %d destinations are unreachable: %s",
+			len(unreachable), len(results), strings.Join(unreachable, ", "))
+		r.event(&anp, corev1.EventTypeWarning, "Unreachable", "Verify", "%s", condition.Message)
+	}
+	verified := metav1.Now()
+	if err := r.updateVerification(ctx, &anp, &condition, &verified); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// setUnverified records that anp could not be verified and checks it again later.
+func (r *VerificationReconciler) setUnverified(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy, reason, message string,
+) (ctrl.Result, error) {
+	existing := meta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)
+	if existing != nil && existing.Status == metav1.ConditionUnknown && existing.Reason == reason &&
+		existing.Message == message && existing.ObservedGeneration == anp.Generation {
+		return ctrl.Result{RequeueAfter: verificationRetryInterval}, nil
+	}
+	condition := metav1.Condition{
+		Type:               conditionTypeVerified,
+		Status:             metav1.ConditionUnknown,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: anp.Generation,
+		LastTransitionTime: metav1.Now(),
+	}
+	if err := r.updateVerification(ctx, anp, &condition, anp.Status.LastVerifiedTime); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: verificationRetryInterval}, nil
+}
+
+// clearVerification removes the verification status of a policy that is no longer verified.
+func (r *VerificationReconciler) clearVerification(ctx context.Context, anp *networkingv1alpha1.NetworkPolicy) error {
+	if anp.Status.LastVerifiedTime == nil && meta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified) == nil {
+		return nil
+	}
+	return r.updateVerification(ctx, anp, nil, nil)
+}
+
+// updateVerification sets the Verified condition, or removes it if condition is nil, and
+// the last verification time of anp. The policy is re-read on conflicts, since the
+// NetworkPolicy controller updates the rest of its status concurrently.
+func (r *VerificationReconciler) updateVerification(
+	ctx context.Context, anp *networkingv1alpha1.NetworkPolicy, condition *metav1.Condition, verified *metav1.Time,
+) error {
+	key := client.ObjectKeyFromObject(anp)
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := r.Get(ctx, key, anp); err != nil {
+				return err
+			}
+		}
+		first = false
+		if condition != nil {
+			setCondition(&anp.Status.Conditions, *condition)
+		} else {
+			meta.RemoveStatusCondition(&anp.Status.Conditions, conditionTypeVerified)
+		}
+		anp.Status.LastVerifiedTime = verified
+		return r.Status().Update(ctx, anp)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// verificationDue returns how long until anp is to be verified again, or zero if it is due:
+// when it has not been probed, could not be probed for lack of targets, its spec changed
+// since, or interval has passed.
+func verificationDue(anp *networkingv1alpha1.NetworkPolicy, interval time.Duration, now time.Time) time.Duration {
+	condition := meta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)
+	if anp.Status.LastVerifiedTime == nil || condition == nil || condition.ObservedGeneration != anp.Generation ||
+		(condition.Status == metav1.ConditionUnknown && condition.Reason != "ProbeFailed") {
+		return 0
+	}
+	return max(anp.Status.LastVerifiedTime.Add(interval).Sub(now), 0)
+}
+
+// verificationTargets returns the destinations to probe for anp, sorted: each resolved
+// hostname on the numeric TCP ports of its rule, and each resolved target of a TCP SRV
+// peer on its SRV port. Port ranges are probed on their first port.
+func verificationTargets(anp *networkingv1alpha1.NetworkPolicy) []probe.Target {
+	var targets []probe.Target
+	for _, rule := range anp.Status.Rules {
+		if int(rule.Index) >= len(anp.Spec.Egress) {
+			continue
+		}
+		ports := tcpPorts(anp.Spec.Egress[rule.Index].Ports)
+		for _, hs := range rule.Hostnames {
+			if hs.SRV {
+				if !isTCPService(hs.Hostname) {
+					continue
+				}
+				for _, t := range hs.Targets {
+					if len(t.Addresses) > 0 {
+						targets = append(targets, probe.Target{Host: t.Target, Port: t.Port})
+					}
+				}
+				continue
+			}
+			if len(hs.Addresses) == 0 {
+				continue
+			}
+			for _, port := range ports {
+				targets = append(targets, probe.Target{Host: hs.Hostname, Port: port})
+			}
+		}
+	}
+	slices.SortFunc(targets, func(a, b probe.Target) int {
+		return cmp.Or(cmp.Compare(a.Host, b.Host), cmp.Compare(a.Port, b.Port))
+	})
+	return slices.Compact(targets)
+}
+
+// tcpPorts returns the numeric TCP ports of ports. Named ports cannot be probed.
+func tcpPorts(ports []networkingv1alpha1.NetworkPolicyPort) []int32 {
+	var tcp []int32
+	for _, p := range ports {
+		if p.Protocol != nil && *p.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if p.Port != nil && p.Port.Type == intstr.Int {
+			tcp = append(tcp, p.Port.IntVal)
+		}
+	}
+	return tcp
+}
+
+// isTCPService reports whether the SRV name has the _tcp protocol label.
+func isTCPService(name string) bool {
+	labels := strings.Split(name, ".")
+	return len(labels) > 1 && strings.EqualFold(labels[1], "_tcp")
+}
+
+func (r *VerificationReconciler) event(obj runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, nil, eventtype, reason, action, note, args...)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager. Policies are verified when
+// their spec changes and then periodically; status updates do not trigger a verification.
+func (r *VerificationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	maxConcurrentProbes := r.MaxConcurrentProbes
+	if maxConcurrentProbes <= 0 {
+		maxConcurrentProbes = DefaultMaxConcurrentProbes
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("verification").
+		For(&networkingv1alpha1.NetworkPolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrentProbes}).
+		Complete(r)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/probe"
+)
+
+// fakeProber reports the targets in unreachable as unreachable, or fails with err.
+type fakeProber struct {
+	unreachable map[probe.Target]bool
+	err         error
+	sources     []probe.Source
+	targets     [][]probe.Target
+}
+
+func (p *fakeProber) Probe(_ context.Context, source probe.Source, targets []probe.Target) ([]probe.Result, error) {
+	p.sources = append(p.sources, source)
+	p.targets = append(p.targets, targets)
+	if p.err != nil {
+		return nil, p.err
+	}
+	results := make([]probe.Result, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, probe.Result{Target: t, Reachable: !p.unreachable[t]})
+	}
+	return results, nil
+}
+
+var _ = Describe("VerificationReconciler", func() {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+
+	// newPolicy creates a verified policy whose hostnames are resolved as in its status.
+	newPolicy := func(name string) *networkingv1alpha1.NetworkPolicy {
+		anp := &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: networkingv1alpha1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "checkout"}},
+				Egress: []networkingv1alpha1.EgressRule{
+					{
+						Ports: []networkingv1alpha1.NetworkPolicyPort{
+							{Protocol: &tcp, Port: ptr.To(intstr.FromInt32(443))},
+							{Protocol: &udp, Port: ptr.To(intstr.FromInt32(443))},
+							{Port: ptr.To(intstr.FromString("https"))},
+						},
+						To: []networkingv1alpha1.EgressPeer{{Hostname: "api.example.com"}, {Hostname: "gone.example.com"}},
+					},
+					{To: []networkingv1alpha1.EgressPeer{{SRV: "_ldap._tcp.corp.example"}}},
+				},
+				PolicyTypes:  []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Verification: &networkingv1alpha1.VerificationSpec{},
+			},
+		}
+		Expect(k8sClient.Create(ctx, anp)).To(Succeed())
+		DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, anp))).To(Succeed()) })
+
+		anp.Status.Mode = networkingv1alpha1.PolicyModeEnforce
+		anp.Status.Rules = []networkingv1alpha1.EgressRuleStatus{
+			{Index: 0, Hostnames: []networkingv1alpha1.HostnameStatus{
+				{Hostname: "api.example.com", Addresses: []string{"192.0.2.1/32"}},
+				{Hostname: "gone.example.com", LastError: "no such host"},
+			}},
+			{Index: 1, Hostnames: []networkingv1alpha1.HostnameStatus{
+				{Hostname: "_ldap._tcp.corp.example", SRV: true, Targets: []networkingv1alpha1.SRVTargetStatus{
+					{Target: "dc1.corp.example", Port: 389, Addresses: []string{"192.0.2.10/32"}},
+				}},
+			}},
+		}
+		Expect(k8sClient.Status().Update(ctx, anp)).To(Succeed())
+		return anp
+	}
+
+	It("should record the reachability of each resolved destination", func() {
+		anp := newPolicy("verified")
+		prober := &fakeProber{unreachable: map[probe.Target]bool{{Host: "dc1.corp.example", Port: 389}: true}}
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &VerificationReconciler{Client: k8sClient, Scheme: scheme.Scheme, Prober: prober, Recorder: recorder}
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(anp)}
+
+		result, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(defaultVerificationInterval))
+		Expect(prober.targets).To(Equal([][]probe.Target{{
+			{Host: "api.example.com", Port: 443},
+			{Host: "dc1.corp.example", Port: 389},
+		}}))
+		Expect(prober.sources[0].Selector.MatchLabels).To(HaveKeyWithValue("app", "checkout"))
+		Expect(prober.sources[0].PodName).To(BeEmpty())
+
+		Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+		verified := apimeta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)
+		Expect(verified.Status).To(Equal(metav1.ConditionFalse))
+		Expect(verified.Reason).To(Equal("Unreachable"))
+		Expect(verified.Message).To(ContainSubstring("dc1.corp.example:389"))
+		Expect(anp.Status.LastVerifiedTime).NotTo(BeNil())
+		Expect(anp.Status.Rules).To(HaveLen(2))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Warning Unreachable")))
+
+		By("not probing again before the interval has passed")
+		result, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(prober.targets).To(HaveLen(1))
+
+		By("probing again when the spec changes")
+		anp.Spec.Verification.PodName = "checkout-0"
+		Expect(k8sClient.Update(ctx, anp)).To(Succeed())
+		prober.unreachable = nil
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prober.sources).To(HaveLen(2))
+		Expect(prober.sources[1].PodName).To(Equal("checkout-0"))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+		Expect(apimeta.IsStatusConditionTrue(anp.Status.Conditions, conditionTypeVerified)).To(BeTrue())
+
+		By("removing the verification status when verification is disabled")
+		anp.Spec.Verification = nil
+		Expect(k8sClient.Update(ctx, anp)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+		Expect(apimeta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)).To(BeNil())
+		Expect(anp.Status.LastVerifiedTime).To(BeNil())
+	})
+
+	It("should report probes that could not run", func() {
+		anp := newPolicy("probe-failed")
+		prober := &fakeProber{err: errors.New("pod checkout-0 is Pending, not Running")}
+		reconciler := &VerificationReconciler{Client: k8sClient, Scheme: scheme.Scheme, Prober: prober}
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(anp)}
+
+		result, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(defaultVerificationInterval))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+		verified := apimeta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)
+		Expect(verified.Status).To(Equal(metav1.ConditionUnknown))
+		Expect(verified.Reason).To(Equal("ProbeFailed"))
+		Expect(verified.Message).To(ContainSubstring("Pending"))
+	})
+
+	It("should not probe policies that are not enforced", func() {
+		anp := newPolicy("audited")
+		anp.Status.Mode = networkingv1alpha1.PolicyModeAudit
+		Expect(k8sClient.Status().Update(ctx, anp)).To(Succeed())
+		prober := &fakeProber{}
+		reconciler := &VerificationReconciler{Client: k8sClient, Scheme: scheme.Scheme, Prober: prober}
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(anp)}
+
+		result, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(verificationRetryInterval))
+		Expect(prober.sources).To(BeEmpty())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, anp)).To(Succeed())
+		verified := apimeta.FindStatusCondition(anp.Status.Conditions, conditionTypeVerified)
+		Expect(verified.Reason).To(Equal("NotEnforced"))
+		Expect(anp.Status.LastVerifiedTime).To(BeNil())
+	})
+})
@@ -0,0 +1,284 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+// maxEgressItems is the number of egress rules of a NetworkPolicy, and of peers per rule, allowed by the CRD.
+const maxEgressItems = 10
+
+// errNotGenerated is returned when a NetworkPolicy with the generated name exists but was
+// not generated for the workload.
+var errNotGenerated = errors.New("not generated for this workload")
+
+// WorkloadPolicyReconciler generates an augmented NetworkPolicy for each Deployment,
+// StatefulSet and standalone Pod annotated with networkingv1alpha1.EgressHostsAnnotation.
+// The generated policy is owned by the workload, selects its pods and is named after its
+// kind and name; the NetworkPolicyReconciler resolves it like any other policy.
+type WorkloadPolicyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Recorder emits events about the workloads. No events are emitted if it is nil.
+	Recorder events.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.ayoy.se,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// reconcileWorkload creates, updates or deletes the NetworkPolicy generated for the workload
+// in obj, which is fetched by req.
+func (r *WorkloadPolicyReconciler) reconcileWorkload(
+	ctx context.Context, req ctrl.Request, obj client.Object,
+) (ctrl.Result, error) {
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		// The generated policy is garbage collected with its owner.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	name := strings.ToLower(gvk.Kind) + "-" + obj.GetName()
+	logger := log.FromContext(ctx).WithValues("networkPolicy", name)
+
+	value, annotated := obj.GetAnnotations()[networkingv1alpha1.EgressHostsAnnotation]
+	if !annotated || !obj.GetDeletionTimestamp().IsZero() || isControlledPod(obj) {
+		return ctrl.Result{}, r.deleteGenerated(ctx, obj, name)
+	}
+
+	egress, err := ParseEgressHosts(value)
+	if err != nil {
+		r.event(obj, corev1.EventTypeWarning, "InvalidEgressHosts", "Generate",
+			"Invalid %s annotation: %v", networkingv1alpha1.EgressHostsAnnotation, err)
+		return ctrl.Result{}, nil
+	}
+	selector := workloadSelector(obj)
+	if selector == nil {
+		r.event(obj, corev1.EventTypeWarning, "NoPodSelector", "Generate",
+			"Cannot generate a NetworkPolicy for a workload without pod labels")
+		return ctrl.Result{}, nil
+	}
+
+	anp := &networkingv1alpha1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: obj.GetNamespace()}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, anp, func() error {
+		if !anp.CreationTimestamp.IsZero() && !metav1.IsControlledBy(anp, obj) {
+			return errNotGenerated
+		}
+		if anp.Labels == nil {
+			anp.Labels = make(map[string]string)
+		}
+		anp.Labels[networkingv1alpha1.GeneratedFromLabel] = gvk.Kind
+		anp.Spec.PodSelector = *selector
+		anp.Spec.Egress = egress
+		anp.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+		return controllerutil.SetControllerReference(obj, anp, r.Scheme)
+	})
+	if errors.Is(err, errNotGenerated) {
+		r.event(obj, corev1.EventTypeWarning, "PolicyConflict", "Generate",
+			"NetworkPolicy %s exists and was not generated for this workload", name)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to generate NetworkPolicy: %w", err)
+	}
+	if op != controllerutil.OperationResultNone {
+		logger.Info("generated NetworkPolicy for workload", "operation", op)
+	}
+	return ctrl.Result{}, nil
+}
+
+// deleteGenerated deletes the NetworkPolicy named name if it was generated for obj.
+func (r *WorkloadPolicyReconciler) deleteGenerated(ctx context.Context, obj client.Object, name string) error {
+	var anp networkingv1alpha1.NetworkPolicy
+	if err := r.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, &anp); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(&anp, obj) {
+		return nil
+	}
+	log.FromContext(ctx).Info("deleting generated NetworkPolicy", "networkPolicy", name)
+	if err := r.Delete(ctx, &anp); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete generated NetworkPolicy: %w", err)
+	}
+	return nil
+}
+
+func (r *WorkloadPolicyReconciler) event(obj runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, nil, eventtype, reason, action, note, args...)
+	}
+}
+
+// workloadSelector returns the selector of the workload's pods, or nil if it has none.
+func workloadSelector(obj client.Object) *metav1.LabelSelector {
+	var selector *metav1.LabelSelector
+	switch w := obj.(type) {
+	case *appsv1.Deployment:
+		selector = w.Spec.Selector
+	case *appsv1.StatefulSet:
+		selector = w.Spec.Selector
+	case *corev1.Pod:
+		if len(w.Labels) > 0 {
+			selector = &metav1.LabelSelector{MatchLabels: w.Labels}
+		}
+	}
+	// An empty selector would select every pod in the namespace.
+	if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+		return nil
+	}
+	return selector.DeepCopy()
+}
+
+// isControlledPod reports whether obj is a Pod managed by a controller. Such pods are
+// covered by the policy of their workload.
+func isControlledPod(obj client.Object) bool {
+	_, isPod := obj.(*corev1.Pod)
+	return isPod && metav1.GetControllerOf(obj) != nil
+}
+
+// ParseEgressHosts parses the value of networkingv1alpha1.EgressHostsAnnotation into egress
+// rules: one rule per distinct port, in order of first appearance, split into rules of at
+// most 10 peers.
+func ParseEgressHosts(value string) ([]networkingv1alpha1.EgressRule, error) {
+	var rules []networkingv1alpha1.EgressRule
+	ruleFor := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, portSpec, hasPort := strings.Cut(entry, ":")
+		host = strings.ToLower(host)
+		if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid host %q: %s", host, strings.Join(errs, "; "))
+		}
+		var ports []networkingv1alpha1.NetworkPolicyPort
+		key := ""
+		if hasPort {
+			port, err := parsePort(portSpec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry %q: %w", entry, err)
+			}
+			ports = append(ports, port)
+			key = fmt.Sprintf("%s/%s", port.Port, *port.Protocol)
+		}
+
+		if i, ok := ruleFor[key]; ok && len(rules[i].To) < maxEgressItems {
+			rules[i].To = append(rules[i].To, networkingv1alpha1.EgressPeer{Hostname: host})
+			continue
+		}
+		ruleFor[key] = len(rules)
+		rules = append(rules, networkingv1alpha1.EgressRule{
+			Ports: ports,
+			To:    []networkingv1alpha1.EgressPeer{{Hostname: host}},
+		})
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no hosts")
+	}
+	if len(rules) > maxEgressItems {
+		return nil, fmt.Errorf("%d egress rules needed, at most %d are allowed", len(rules), maxEgressItems)
+	}
+	return rules, nil
+}
+
+// parsePort parses "port" or "port/protocol". The protocol defaults to TCP.
+func parsePort(spec string) (networkingv1alpha1.NetworkPolicyPort, error) {
+	portStr, protoStr, hasProto := strings.Cut(spec, "/")
+	port, err := strconv.ParseInt(portStr, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return networkingv1alpha1.NetworkPolicyPort{}, fmt.Errorf("invalid port %q", portStr)
+	}
+	protocol := corev1.ProtocolTCP
+	if hasProto {
+		protocol = corev1.Protocol(strings.ToUpper(protoStr))
+		switch protocol {
+		case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		default:
+			return networkingv1alpha1.NetworkPolicyPort{}, fmt.Errorf("invalid protocol %q", protoStr)
+		}
+	}
+	p := intstr.FromInt32(int32(port))
+	return networkingv1alpha1.NetworkPolicyPort{Protocol: &protocol, Port: &p}, nil
+}
+
+// egressHostsChanged passes events of objects that have or had the annotation.
+func egressHostsChanged() predicate.Predicate {
+	annotated := func(obj client.Object) bool {
+		_, ok := obj.GetAnnotations()[networkingv1alpha1.EgressHostsAnnotation]
+		return ok
+	}
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return annotated(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return annotated(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return annotated(e.ObjectOld) || annotated(e.ObjectNew) },
+		GenericFunc: func(e event.GenericEvent) bool { return annotated(e.Object) },
+	}
+}
+
+// SetupWithManager sets up one controller per workload kind with the Manager. Only
+// workloads that have or had the annotation are reconciled, and changes to generated
+// policies are reverted.
+func (r *WorkloadPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	workloads := map[string]func() client.Object{
+		"deployment":  func() client.Object { return &appsv1.Deployment{} },
+		"statefulset": func() client.Object { return &appsv1.StatefulSet{} },
+		"pod":         func() client.Object { return &corev1.Pod{} },
+	}
+	for name, newObject := range workloads {
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("workload-"+name).
+			For(newObject(), builder.WithPredicates(egressHostsChanged())).
+			Owns(&networkingv1alpha1.NetworkPolicy{}).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return r.reconcileWorkload(ctx, req, newObject())
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to set up %s controller: %w", name, err)
+		}
+	}
+	return nil
+}
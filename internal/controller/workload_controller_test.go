@@ -0,0 +1,169 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+var _ = Describe("WorkloadPolicyReconciler", func() {
+	hosts := func(rule networkingv1alpha1.EgressRule) string {
+		var names []string
+		for _, to := range rule.To {
+			names = append(names, to.Hostname)
+		}
+		ports := "any"
+		if len(rule.Ports) > 0 {
+			ports = fmt.Sprintf("%s/%s", rule.Ports[0].Port, *rule.Ports[0].Protocol)
+		}
+		return ports + " " + strings.Join(names, ",")
+	}
+
+	DescribeTable("ParseEgressHosts",
+		func(value string, want ...string) {
+			rules, err := ParseEgressHosts(value)
+			Expect(err).NotTo(HaveOccurred())
+			var got []string
+			for _, rule := range rules {
+				got = append(got, hosts(rule))
+			}
+			Expect(got).To(Equal(want))
+		},
+		Entry("ports and protocols", "api.example.com:443,db.example.com:5432/TCP,dns.example.com:53/udp",
+			"443/TCP api.example.com", "5432/TCP db.example.com", "53/UDP dns.example.com"),
+		Entry("hosts sharing a port share a rule", " a.example.com:443, b.example.com:443/TCP ,c.example.com",
+			"443/TCP a.example.com,b.example.com", "any c.example.com"),
+		Entry("hosts are lowercased", "API.Example.com:443", "443/TCP api.example.com"),
+		Entry("rules are split at 10 peers",
+			"h0.example:1,h1.example:1,h2.example:1,h3.example:1,h4.example:1,h5.example:1,h6.example:1,h7.example:1,h8.example:1,h9.example:1,h10.example:1",
+			"1/TCP h0.example,h1.example,h2.example,h3.example,h4.example,h5.example,h6.example,h7.example,h8.example,h9.example",
+			"1/TCP h10.example"),
+	)
+
+	DescribeTable("ParseEgressHosts errors",
+		func(value, want string) {
+			_, err := ParseEgressHosts(value)
+			Expect(err).To(MatchError(ContainSubstring(want)))
+		},
+		Entry("empty", " , ", "no hosts"),
+		Entry("invalid host", "api_example.com:443", `invalid host "api_example.com"`),
+		Entry("invalid port", "api.example.com:https", `invalid port "https"`),
+		Entry("port out of range", "api.example.com:70000", `invalid port "70000"`),
+		Entry("invalid protocol", "api.example.com:443/ICMP", `invalid protocol "ICMP"`),
+	)
+
+	It("should generate a NetworkPolicy for an annotated Deployment", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "workload-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		labels := map[string]string{"app": "checkout"}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "checkout",
+				Namespace:   ns.Name,
+				Annotations: map[string]string{networkingv1alpha1.EgressHostsAnnotation: "api.example.com:443"},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "checkout"}}},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &WorkloadPolicyReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: recorder}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deployment.Name, Namespace: ns.Name}}
+		_, err := reconciler.reconcileWorkload(ctx, req, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+
+		key := types.NamespacedName{Name: "deployment-checkout", Namespace: ns.Name}
+		var generated networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, key, &generated)).To(Succeed())
+		Expect(generated.Labels).To(HaveKeyWithValue(networkingv1alpha1.GeneratedFromLabel, "Deployment"))
+		Expect(generated.Spec.PodSelector.MatchLabels).To(Equal(labels))
+		Expect(generated.Spec.Egress).To(HaveLen(1))
+		Expect(hosts(generated.Spec.Egress[0])).To(Equal("443/TCP api.example.com"))
+		Expect(metav1.GetControllerOf(&generated).Name).To(Equal("checkout"))
+
+		By("reporting an invalid annotation without touching the policy")
+		deployment.Annotations[networkingv1alpha1.EgressHostsAnnotation] = "api.example.com:https"
+		Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+		_, err = reconciler.reconcileWorkload(ctx, req, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Warning InvalidEgressHosts")))
+		Expect(k8sClient.Get(ctx, key, &generated)).To(Succeed())
+		Expect(hosts(generated.Spec.Egress[0])).To(Equal("443/TCP api.example.com"))
+
+		By("deleting the policy once the annotation is removed")
+		delete(deployment.Annotations, networkingv1alpha1.EgressHostsAnnotation)
+		Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+		_, err = reconciler.reconcileWorkload(ctx, req, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, &generated))).To(BeTrue())
+	})
+
+	It("should not take over a NetworkPolicy it did not generate", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "workload-ns-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		existing := &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-worker", Namespace: ns.Name},
+			Spec:       networkingv1alpha1.NetworkPolicySpec{PodSelector: metav1.LabelSelector{}},
+		}
+		Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "worker",
+				Namespace:   ns.Name,
+				Labels:      map[string]string{"app": "worker"},
+				Annotations: map[string]string{networkingv1alpha1.EgressHostsAnnotation: "queue.example.com:5671"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "worker", Image: "worker"}}},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &WorkloadPolicyReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: recorder}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: pod.Name, Namespace: ns.Name}}
+		_, err := reconciler.reconcileWorkload(ctx, req, &corev1.Pod{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Warning PolicyConflict")))
+
+		var unchanged networkingv1alpha1.NetworkPolicy
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "pod-worker", Namespace: ns.Name}, &unchanged)).To(Succeed())
+		Expect(unchanged.Spec.Egress).To(BeEmpty())
+		Expect(unchanged.OwnerReferences).To(BeEmpty())
+	})
+})
@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var dnssecValidationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "augmented_networkpolicy_dnssec_validations_total",
+	Help: "Total number of DNSSEC validations of resolved hostnames by result",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(dnssecValidationsTotal)
+}
+
+// DNSSECResult is the outcome of validating an answer with DNSSEC.
+type DNSSECResult string
+
+const (
+	// DNSSECSecure means the validating resolver authenticated every response of the answer
+	// (it set the AD bit).
+	DNSSECSecure DNSSECResult = "Secure"
+	// DNSSECInsecure means the validating resolver answered without authenticating part of
+	// the answer, because it is in a zone that is provably unsigned or not covered by the
+	// resolver's trust anchors.
+	DNSSECInsecure DNSSECResult = "Insecure"
+	// DNSSECBogus means the validating resolver failed the answer (SERVFAIL) but returned it
+	// with checking disabled, so its signatures did not validate.
+	DNSSECBogus DNSSECResult = "Bogus"
+)
+
+type dnssecKey struct{}
+
+// WithDNSSEC returns a context that asks resolvers that support it (such as
+// ValidatingResolver) to validate answers and report the outcome in Answer.DNSSEC.
+func WithDNSSEC(ctx context.Context, validate bool) context.Context {
+	return context.WithValue(ctx, dnssecKey{}, validate)
+}
+
+// DNSSECFromContext reports whether validation was requested with WithDNSSEC.
+func DNSSECFromContext(ctx context.Context) bool {
+	validate, _ := ctx.Value(dnssecKey{}).(bool)
+	return validate
+}
+
+// ValidatingResolver is a WireResolver that reports whether a trusted validating recursive
+// resolver authenticated answers with DNSSEC, when the context asks for it (see WithDNSSEC).
+// It does not validate signatures itself: it trusts the AD bit of the resolver's responses,
+// which is why the resolver must be reached over a transport that cannot be spoofed, either
+// on a loopback address or over DNS over TLS. Validation never fails a resolution; the
+// outcome is reported in Answer.DNSSEC and callers decide whether to use the addresses.
+type ValidatingResolver struct {
+	wire WireResolver
+}
+
+// NewValidatingResolver returns a ValidatingResolver that queries the validating resolvers
+// at servers within limits, which may be nil. If tlsConfig is nil, every server must be a
+// loopback address; otherwise queries are sent over DNS over TLS with tlsConfig.
+func NewValidatingResolver(servers []string, tlsConfig *tls.Config, limits *Limiter) (*ValidatingResolver, error) {
+	if tlsConfig == nil {
+		for _, server := range servers {
+			addr, err := netip.ParseAddrPort(server)
+			if err != nil || !addr.Addr().IsLoopback() {
+				return nil, fmt.Errorf("DNS server %s is not a loopback address; "+
+					"the validating resolver requires DNS over TLS to reach it", server)
+			}
+		}
+	}
+	return &ValidatingResolver{wire: WireResolver{Servers: servers, TLS: tlsConfig, Limits: limits, dnssecOK: true}}, nil
+}
+
+// Resolve resolves hostname like WireResolver and, if requested, reports whether the
+// validating resolver authenticated the answer. If it is not requested, the resolver is
+// asked not to check signatures, so that answers are returned whatever their DNSSEC state.
+func (r *ValidatingResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	validate := DNSSECFromContext(ctx)
+	cidrs, chain, msgs, err := r.resolve(ctx, hostname, !validate)
+	result, reason := DNSSECResult(""), ""
+	if validate && err != nil && ClassifyError(err) == ErrorClassSERVFAIL {
+		// A validating resolver answers SERVFAIL to answers that fail validation, and
+		// returns them when checking is disabled.
+		if cidrs, chain, _, err = r.resolve(ctx, hostname, true); err == nil {
+			result = DNSSECBogus
+			reason = fmt.Sprintf("the resolver failed to validate %s and only answered with checking disabled", hostname)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname, err)
+	}
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname,
+			&net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true})
+	}
+
+	cidrs = dedupSorted(cidrs)
+	answer := &Answer{Addresses: cidrs, Resolver: "validating", CNAMEChain: chain}
+	if validate {
+		if result == "" {
+			result, reason = authenticated(msgs)
+		}
+		answer.DNSSEC, answer.DNSSECReason = result, reason
+		dnssecValidationsTotal.WithLabelValues(string(answer.DNSSEC)).Inc()
+	}
+	return answer, nil
+}
+
+// resolve looks up the A and AAAA records of hostname and returns the addresses, the
+// longest CNAME chain and the responses they were read from.
+func (r *ValidatingResolver) resolve(
+	ctx context.Context, hostname string, checkingDisabled bool,
+) ([]string, []string, []*dnsmessage.Message, error) {
+	var cidrs, chain []string
+	var msgs []*dnsmessage.Message
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		addrs, c, m, err := r.wire.lookup(ctx, hostname, qtype, checkingDisabled)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cidrs = append(cidrs, addrs...)
+		if len(c) > len(chain) {
+			chain = c
+		}
+		msgs = append(msgs, m...)
+	}
+	return cidrs, chain, msgs, nil
+}
+
+// authenticated returns DNSSECSecure if every response has the AD bit set, and otherwise
+// DNSSECInsecure with the first question that was not authenticated.
+func authenticated(msgs []*dnsmessage.Message) (DNSSECResult, string) {
+	if len(msgs) == 0 {
+		return DNSSECInsecure, "the resolver returned no responses to authenticate"
+	}
+	for _, msg := range msgs {
+		if !msg.AuthenticData {
+			q := msg.Questions[0]
+			return DNSSECInsecure, fmt.Sprintf("the resolver did not authenticate the %s records of %s",
+				q.Type.String()[len("Type"):], strings.TrimSuffix(q.Name.String(), "."))
+		}
+	}
+	return DNSSECSecure, ""
+}
+
+// LookupSRV looks up the SRV record set at name without validating it. Its targets are
+// resolved, and validated, separately.
+func (r *ValidatingResolver) LookupSRV(ctx context.Context, name string) ([]SRVTarget, error) {
+	return r.wire.LookupSRV(ctx, name)
+}
@@ -0,0 +1,120 @@
+package dns_test
+
+import (
+	"context"
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+func TestValidatingResolver(t *testing.T) {
+	serverTLS, clientTLS, err := dnstest.NewTLSConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := dnstest.NewServerWithOptions(dnstest.Options{
+		Secure: []string{"example"},
+		Bogus:  []string{"tampered.example"},
+		TLS:    serverTLS,
+	},
+		dnstest.A("secure.example", "192.0.2.1"),
+		dnstest.AAAA("secure.example", "2001:db8::1"),
+		dnstest.CNAME("alias.example", "www.corp.example"),
+		dnstest.A("www.corp.example", "192.0.2.2"),
+		dnstest.A("www.tampered.example", "192.0.2.3"),
+		dnstest.CNAME("unsigned-alias.example", "www.unsigned.test"),
+		dnstest.A("www.unsigned.test", "192.0.2.4"),
+		dnstest.A("outside.test", "192.0.2.5"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	loopback, err := dns.NewValidatingResolver([]string{server.Addr}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewValidatingResolver() error: %v", err)
+	}
+	overTLS, err := dns.NewValidatingResolver([]string{server.TLSAddr}, clientTLS, nil)
+	if err != nil {
+		t.Fatalf("NewValidatingResolver() error: %v", err)
+	}
+
+	tests := []struct {
+		hostname string
+		want     dns.DNSSECResult
+		addrs    []string
+	}{
+		{hostname: "secure.example", want: dns.DNSSECSecure, addrs: []string{"192.0.2.1/32", "2001:db8::1/128"}},
+		{hostname: "alias.example", want: dns.DNSSECSecure, addrs: []string{"192.0.2.2/32"}},
+		{hostname: "www.tampered.example", want: dns.DNSSECBogus, addrs: []string{"192.0.2.3/32"}},
+		{hostname: "unsigned-alias.example", want: dns.DNSSECInsecure, addrs: []string{"192.0.2.4/32"}},
+		{hostname: "outside.test", want: dns.DNSSECInsecure, addrs: []string{"192.0.2.5/32"}},
+	}
+	for name, r := range map[string]*dns.ValidatingResolver{"loopback": loopback, "tls": overTLS} {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.hostname, func(t *testing.T) {
+				answer, err := r.Resolve(dns.WithDNSSEC(context.Background(), true), tt.hostname)
+				if err != nil {
+					t.Fatalf("Resolve(%q) error: %v", tt.hostname, err)
+				}
+				if answer.DNSSEC != tt.want {
+					t.Errorf("Resolve(%q) DNSSEC = %s (%s), want %s",
+						tt.hostname, answer.DNSSEC, answer.DNSSECReason, tt.want)
+				}
+				if tt.want != dns.DNSSECSecure && answer.DNSSECReason == "" {
+					t.Errorf("Resolve(%q) has no DNSSEC reason", tt.hostname)
+				}
+				if !slices.Equal(answer.Addresses, tt.addrs) {
+					t.Errorf("Resolve(%q) = %v, want %v", tt.hostname, answer.Addresses, tt.addrs)
+				}
+			})
+		}
+
+		t.Run(name+"/not requested", func(t *testing.T) {
+			answer, err := r.Resolve(context.Background(), "www.tampered.example")
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			if answer.DNSSEC != "" {
+				t.Errorf("Resolve() DNSSEC = %s, want no validation", answer.DNSSEC)
+			}
+		})
+	}
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		r, err := dns.NewValidatingResolver([]string{server.TLSAddr}, &tls.Config{MinVersion: tls.VersionTLS12}, nil)
+		if err != nil {
+			t.Fatalf("NewValidatingResolver() error: %v", err)
+		}
+		if _, err := r.Resolve(dns.WithDNSSEC(context.Background(), true), "secure.example"); err == nil {
+			t.Error("Resolve() succeeded over TLS with an untrusted certificate")
+		}
+	})
+}
+
+func TestNewValidatingResolver(t *testing.T) {
+	tests := []struct {
+		servers []string
+		tls     bool
+		wantErr bool
+	}{
+		{servers: []string{"127.0.0.1:53", "[::1]:53"}},
+		{servers: []string{"127.0.0.1:53", "192.0.2.53:53"}, wantErr: true},
+		{servers: []string{"resolver.example:53"}, wantErr: true},
+		{servers: []string{"192.0.2.53:853"}, tls: true},
+	}
+	for _, tt := range tests {
+		var config *tls.Config
+		if tt.tls {
+			config = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		_, err := dns.NewValidatingResolver(tt.servers, config, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewValidatingResolver(%v, tls=%t) error = %v, wantErr %t", tt.servers, tt.tls, err, tt.wantErr)
+		}
+	}
+}
@@ -1,20 +1,37 @@
 package dnstest
 
-import "context"
+import (
+	"context"
 
-// MockResolver is a test double for the dns.Resolver interface.
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+)
+
+// MockResolver is a test double for the dns.Resolver and dns.SRVResolver interfaces.
 type MockResolver struct {
 	Results map[string][]string
+	SRV     map[string][]dns.SRVTarget
+	CNAMEs  map[string][]string
+	DNSSEC  map[string]dns.DNSSECResult
 	Err     error
 }
 
 // Resolve returns pre-configured results for the given hostname.
-func (m *MockResolver) Resolve(_ context.Context, hostname string) ([]string, error) {
+func (m *MockResolver) Resolve(_ context.Context, hostname string) (*dns.Answer, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
-	if result, ok := m.Results[hostname]; ok {
-		return result, nil
+	return &dns.Answer{
+		Addresses:  m.Results[hostname],
+		Resolver:   "mock",
+		CNAMEChain: m.CNAMEs[hostname],
+		DNSSEC:     m.DNSSEC[hostname],
+	}, nil
+}
+
+// LookupSRV returns pre-configured SRV targets for the given name.
+func (m *MockResolver) LookupSRV(_ context.Context, name string) ([]dns.SRVTarget, error) {
+	if m.Err != nil {
+		return nil, m.Err
 	}
-	return nil, nil
+	return m.SRV[name], nil
 }
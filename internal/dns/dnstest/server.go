@@ -0,0 +1,285 @@
+package dnstest
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Server is an in-process DNS server that answers recursive queries from a fixed set of
+// records over UDP and TCP. CNAMEs are followed within the record set, as a recursive
+// resolver would. Names without any record are answered with NXDOMAIN. With Options, it
+// reports DNSSEC validation like a validating resolver, without signing anything.
+type Server struct {
+	// Addr is the host:port the server listens on, for both UDP and TCP.
+	Addr string
+	// TLSAddr is the host:port the server serves DNS over TLS on, if Options.TLS is set.
+	TLSAddr string
+
+	opts    Options
+	records []dnsmessage.Resource
+	udp     net.PacketConn
+	tcp     net.Listener
+	tls     net.Listener
+	wg      sync.WaitGroup
+}
+
+// Options configures how a Server reports DNSSEC validation and which transports it serves.
+type Options struct {
+	// Secure lists the zones whose records are reported as authenticated: responses to
+	// queries that set the DO or AD bit have the AD bit set if every record answered, or the
+	// name queried if there are none, is in one of them.
+	Secure []string
+	// Bogus lists the zones whose records fail validation: queries involving them are
+	// answered with SERVFAIL unless they set the CD bit.
+	Bogus []string
+	// TLS, if set, also serves DNS over TLS with this configuration on TLSAddr.
+	TLS *tls.Config
+}
+
+// NewServer starts a server on a random local port answering from records.
+func NewServer(records ...dnsmessage.Resource) (*Server, error) {
+	return NewServerWithOptions(Options{}, records...)
+}
+
+// NewServerWithOptions starts a server configured by opts on a random local port answering
+// from records.
+func NewServerWithOptions(opts Options, records ...dnsmessage.Resource) (*Server, error) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		_ = udp.Close()
+		return nil, err
+	}
+
+	s := &Server{Addr: udp.LocalAddr().String(), opts: opts, records: records, udp: udp, tcp: tcp}
+	if opts.TLS != nil {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			_ = udp.Close()
+			_ = tcp.Close()
+			return nil, err
+		}
+		s.tls = tls.NewListener(l, opts.TLS)
+		s.TLSAddr = l.Addr().String()
+		s.wg.Add(1)
+		go s.serveStream(s.tls)
+	}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveStream(s.tcp)
+	return s, nil
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	_ = s.udp.Close()
+	_ = s.tcp.Close()
+	if s.tls != nil {
+		_ = s.tls.Close()
+	}
+	s.wg.Wait()
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n], true); resp != nil {
+			_, _ = s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+// serveStream serves length-prefixed queries accepted on l, over TCP or TLS.
+func (s *Server) serveStream(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			query := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, query); err != nil {
+				return
+			}
+			if resp := s.answer(query, false); resp != nil {
+				_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}
+		}()
+	}
+}
+
+// answer builds the packed response to a packed query. UDP responses larger than
+// 512 bytes are truncated so that clients retry over TCP.
+func (s *Server) answer(query []byte, udp bool) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(query); err != nil || len(req.Questions) != 1 {
+		return nil
+	}
+	q := req.Questions[0]
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID: req.ID, Response: true, RecursionDesired: req.RecursionDesired, RecursionAvailable: true,
+		},
+		Questions: req.Questions,
+	}
+
+	name := q.Name.String()
+	names := []string{name}
+	if !s.exists(name) {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	for range 16 {
+		cname := s.lookup(name, dnsmessage.TypeCNAME)
+		if len(cname) == 0 || q.Type == dnsmessage.TypeCNAME {
+			break
+		}
+		resp.Answers = append(resp.Answers, cname[0])
+		name = cname[0].Body.(*dnsmessage.CNAMEResource).CNAME.String()
+		names = append(names, name)
+	}
+	resp.Answers = append(resp.Answers, s.lookup(name, q.Type)...)
+
+	if !req.CheckingDisabled && inZones(names, s.opts.Bogus) {
+		resp.RCode = dnsmessage.RCodeServerFailure
+		resp.Answers = nil
+	} else if (req.AuthenticData || dnssecOK(req)) && !inZones(names, s.opts.Bogus) {
+		resp.AuthenticData = allInZones(names, s.opts.Secure)
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	if udp && len(packed) > 512 {
+		resp.Truncated = true
+		resp.Answers = nil
+		if packed, err = resp.Pack(); err != nil {
+			return nil
+		}
+	}
+	return packed
+}
+
+// dnssecOK reports whether req sets the DO bit.
+func dnssecOK(req dnsmessage.Message) bool {
+	for _, rr := range req.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT && rr.Header.DNSSECAllowed() {
+			return true
+		}
+	}
+	return false
+}
+
+// inZones reports whether any of names is in one of zones.
+func inZones(names, zones []string) bool {
+	for _, name := range names {
+		if allInZones([]string{name}, zones) {
+			return true
+		}
+	}
+	return false
+}
+
+// allInZones reports whether every one of names is in one of zones.
+func allInZones(names, zones []string) bool {
+	for _, name := range names {
+		in := false
+		for _, zone := range zones {
+			zone = strings.ToLower(fqdn(zone))
+			name = strings.ToLower(name)
+			in = in || name == zone || strings.HasSuffix(name, "."+zone)
+		}
+		if !in {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) exists(name string) bool {
+	for _, rr := range s.records {
+		if strings.EqualFold(rr.Header.Name.String(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) lookup(name string, qtype dnsmessage.Type) []dnsmessage.Resource {
+	var rrs []dnsmessage.Resource
+	for _, rr := range s.records {
+		if rr.Header.Type == qtype && strings.EqualFold(rr.Header.Name.String(), name) {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+// A returns an A record for name.
+func A(name, ip string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypeA),
+		Body:   &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()},
+	}
+}
+
+// AAAA returns an AAAA record for name.
+func AAAA(name, ip string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypeAAAA),
+		Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(ip).As16()},
+	}
+}
+
+// CNAME returns a CNAME record aliasing name to target.
+func CNAME(name, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypeCNAME),
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(fqdn(target))},
+	}
+}
+
+// SRV returns an SRV record at name pointing to target and port.
+func SRV(name, target string, port uint16) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypeSRV),
+		Body:   &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(fqdn(target)), Port: port},
+	}
+}
+
+func header(name string, rrtype dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(fqdn(name)),
+		Type:  rrtype,
+		Class: dnsmessage.ClassINET,
+		TTL:   60,
+	}
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// IPFamily is an IP address family.
+type IPFamily string
+
+const (
+	// IPv4 is the IPv4 address family.
+	IPv4 IPFamily = "IPv4"
+	// IPv6 is the IPv6 address family.
+	IPv6 IPFamily = "IPv6"
+)
+
+// AllIPFamilies lists every supported family.
+var AllIPFamilies = []IPFamily{IPv4, IPv6}
+
+// ParseIPFamilies parses family names, accepting "IPv4" and "IPv6" in any case.
+// It returns nil, meaning every family, if names is empty.
+func ParseIPFamilies(names []string) ([]IPFamily, error) {
+	var families []IPFamily
+	for _, name := range names {
+		var family IPFamily
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ipv4":
+			family = IPv4
+		case "ipv6":
+			family = IPv6
+		default:
+			return nil, fmt.Errorf("unknown IP family %q", name)
+		}
+		if !slices.Contains(families, family) {
+			families = append(families, family)
+		}
+	}
+	return families, nil
+}
+
+// FamilyOf returns the family of an address in CIDR notation, or "" if it cannot be parsed.
+func FamilyOf(cidr string) IPFamily {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return ""
+	}
+	if prefix.Addr().Is4() {
+		return IPv4
+	}
+	return IPv6
+}
+
+// FilterFamilies returns the CIDRs belonging to one of families, and the families of the
+// CIDRs that were dropped, in AllIPFamilies order. An empty families allows every family.
+func FilterFamilies(cidrs []string, families []IPFamily) ([]string, []IPFamily) {
+	if len(families) == 0 {
+		return cidrs, nil
+	}
+	kept := make([]string, 0, len(cidrs))
+	var dropped []IPFamily
+	for _, cidr := range cidrs {
+		family := FamilyOf(cidr)
+		if slices.Contains(families, family) {
+			kept = append(kept, cidr)
+		} else if !slices.Contains(dropped, family) {
+			dropped = append(dropped, family)
+		}
+	}
+	return kept, SortIPFamilies(dropped)
+}
+
+// SortIPFamilies sorts families in AllIPFamilies order and returns them.
+func SortIPFamilies(families []IPFamily) []IPFamily {
+	slices.SortFunc(families, func(a, b IPFamily) int {
+		return slices.Index(AllIPFamilies, a) - slices.Index(AllIPFamilies, b)
+	})
+	return families
+}
+
+type ipFamiliesKey struct{}
+
+// WithIPFamilies returns a context that restricts resolution to families.
+// Resolvers that honor it (such as FilteringResolver) drop addresses of other families
+// and report them in Answer.DroppedFamilies. An empty families allows every family.
+func WithIPFamilies(ctx context.Context, families []IPFamily) context.Context {
+	return context.WithValue(ctx, ipFamiliesKey{}, families)
+}
+
+// IPFamiliesFromContext returns the families set by WithIPFamilies, or nil for every family.
+func IPFamiliesFromContext(ctx context.Context) []IPFamily {
+	families, _ := ctx.Value(ipFamiliesKey{}).([]IPFamily)
+	return families
+}
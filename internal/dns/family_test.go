@@ -0,0 +1,49 @@
+package dns
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseIPFamilies(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []IPFamily
+		wantErr bool
+	}{
+		{name: "empty", input: nil, want: nil},
+		{name: "both", input: []string{"IPv4", "IPv6"}, want: []IPFamily{IPv4, IPv6}},
+		{name: "case insensitive and deduplicated", input: []string{"ipv6", "IPV6"}, want: []IPFamily{IPv6}},
+		{name: "unknown", input: []string{"IPv5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIPFamilies(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPFamilies(%v) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseIPFamilies(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterFamilies(t *testing.T) {
+	cidrs := []string{"2001:db8::1/128", "1.2.3.4/32", "::ffff:5.6.7.8/128"}
+
+	kept, dropped := FilterFamilies(cidrs, nil)
+	if !slices.Equal(kept, cidrs) || dropped != nil {
+		t.Errorf("FilterFamilies(nil) = %v, %v; want every address and nothing dropped", kept, dropped)
+	}
+
+	kept, dropped = FilterFamilies(cidrs, []IPFamily{IPv4})
+	if want := []string{"1.2.3.4/32"}; !slices.Equal(kept, want) {
+		t.Errorf("FilterFamilies(IPv4) kept = %v, want %v", kept, want)
+	}
+	if want := []IPFamily{IPv6}; !slices.Equal(dropped, want) {
+		t.Errorf("FilterFamilies(IPv4) dropped = %v, want %v", dropped, want)
+	}
+}
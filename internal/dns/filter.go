@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
 	"sort"
 	"sync"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
 )
 
 var (
@@ -22,10 +27,15 @@ var (
 		Name: "augmented_networkpolicy_dns_resolution_changes_total",
 		Help: "Total number of times DNS resolution results changed for a hostname",
 	}, []string{"hostname"})
+
+	trackedHostnames = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_tracked_hostnames",
+		Help: "Number of hostnames whose last answer is tracked for change detection",
+	})
 )
 
 func init() {
-	metrics.Registry.MustRegister(ipFilteredTotal, dnsResolutionChangesTotal)
+	metrics.Registry.MustRegister(ipFilteredTotal, dnsResolutionChangesTotal, trackedHostnames)
 }
 
 // IPFilter filters IP addresses against whitelist and blacklist CIDRs.
@@ -83,30 +93,50 @@ func (f *IPFilter) IsAllowed(cidr string) bool {
 }
 
 // FilteringResolver wraps a Resolver and filters results through an IPFilter.
-// It also tracks DNS resolution changes per hostname for rebinding detection.
+// It also drops addresses of families excluded by the context (see WithIPFamilies)
+// and tracks DNS resolution changes per hostname for rebinding detection.
 type FilteringResolver struct {
 	Inner  Resolver
 	Filter *IPFilter
 	Logger logr.Logger
 
+	// Quarantine, if set, freezes hostnames whose answers change suspiciously.
+	Quarantine *Quarantine
+
 	mu       sync.Mutex
 	lastSeen map[string][]string // hostname → previous filtered CIDRs
 }
 
 // Resolve resolves a hostname and filters results through the IPFilter.
-func (r *FilteringResolver) Resolve(ctx context.Context, hostname string) ([]string, error) {
-	cidrs, err := r.Inner.Resolve(ctx, hostname)
+// Addresses removed by the filter are appended to the answer's Filtered list.
+func (r *FilteringResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "dns.filter", trace.WithAttributes(attribute.String("dns.hostname", hostname)))
+	answer, err := r.resolve(ctx, hostname)
+	if answer != nil {
+		span.SetAttributes(
+			attribute.Int("dns.addresses", len(answer.Addresses)),
+			attribute.Int("dns.filtered", len(answer.Filtered)),
+		)
+	}
+	tracing.End(span, err)
+	return answer, err
+}
+
+func (r *FilteringResolver) resolve(ctx context.Context, hostname string) (*Answer, error) {
+	answer, err := r.Inner.Resolve(ctx, hostname)
 	if err != nil {
 		return nil, err
 	}
 
-	allowed := make([]string, 0, len(cidrs))
-	for _, cidr := range cidrs {
+	allowed := make([]string, 0, len(answer.Addresses))
+	filtered := answer.Filtered
+	for _, cidr := range answer.Addresses {
 		if r.Filter.IsAllowed(cidr) {
 			allowed = append(allowed, cidr)
 		} else {
 			r.Logger.Info("filtered resolved IP", "hostname", hostname, "cidr", cidr)
-			ipFilteredTotal.WithLabelValues(hostname).Inc()
+			ipFilteredTotal.WithLabelValues(hostnameLabels.Value(hostname)).Inc()
+			filtered = append(filtered, cidr)
 		}
 	}
 
@@ -122,12 +152,86 @@ func (r *FilteringResolver) Resolve(ctx context.Context, hostname string) ([]str
 			"previous", prev,
 			"current", allowed,
 		)
-		dnsResolutionChangesTotal.WithLabelValues(hostname).Inc()
+		dnsResolutionChangesTotal.WithLabelValues(hostnameLabels.Value(hostname)).Inc()
 	}
+	// lastSeen keeps following the upstream answer while a hostname is quarantined,
+	// so that an acknowledged hostname continues from its current answer.
 	r.lastSeen[hostname] = copyAndSort(allowed)
+	trackedHostnames.Set(float64(len(r.lastSeen)))
+	var quarantine string
+	if r.Quarantine != nil {
+		var started bool
+		allowed, quarantine, started = r.Quarantine.Observe(hostname, prev, r.lastSeen[hostname])
+		if started {
+			r.Logger.Info("hostname quarantined after suspicious DNS resolution change",
+				"hostname", hostname,
+				"reason", quarantine,
+				"previous", prev,
+			)
+		}
+		allowed = slices.Clone(allowed)
+	}
 	r.mu.Unlock()
+	// A gauge of the overflow label would report whichever hostname was set last.
+	if label := hostnameLabels.Value(hostname); label != OverflowLabel {
+		hostnameAddresses.WithLabelValues(label).Set(float64(len(allowed)))
+	}
+
+	// Families are dropped after change detection, which must not depend on which
+	// families a particular caller asked for.
+	families := IPFamiliesFromContext(ctx)
+	allowed, dropped := FilterFamilies(allowed, families)
+	filtered, droppedFiltered := FilterFamilies(filtered, families)
+	for _, family := range droppedFiltered {
+		if !slices.Contains(dropped, family) {
+			dropped = append(dropped, family)
+		}
+	}
+	SortIPFamilies(dropped)
 
-	return allowed, nil
+	out := *answer
+	out.Addresses = allowed
+	out.Filtered = filtered
+	out.DroppedFamilies = dropped
+	out.Quarantine = quarantine
+	return &out, nil
+}
+
+// Seed sets the previous answer of hostnames that have not been resolved yet, so that
+// changes are detected across restarts. Hostnames already tracked are left as they are.
+func (r *FilteringResolver) Seed(answers map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastSeen == nil {
+		r.lastSeen = make(map[string][]string)
+	}
+	for hostname, addresses := range answers {
+		if _, ok := r.lastSeen[hostname]; !ok && len(addresses) > 0 {
+			r.lastSeen[hostname] = copyAndSort(addresses)
+		}
+	}
+	trackedHostnames.Set(float64(len(r.lastSeen)))
+}
+
+// Retain stops tracking hostnames for which keep returns false, including their
+// quarantine and metric series, and returns the number of hostnames evicted.
+func (r *FilteringResolver) Retain(keep func(hostname string) bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evicted := 0
+	for hostname := range r.lastSeen {
+		if keep(hostname) {
+			continue
+		}
+		delete(r.lastSeen, hostname)
+		forgetHostname(hostname)
+		evicted++
+	}
+	if r.Quarantine != nil {
+		r.Quarantine.retain(keep)
+	}
+	trackedHostnames.Set(float64(len(r.lastSeen)))
+	return evicted
 }
 
 func copyAndSort(s []string) []string {
@@ -157,7 +261,7 @@ func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
 		if err != nil {
 			return nil, fmt.Errorf("parsing %q: %w", cidr, err)
 		}
-		nets = append(nets, n)
+		nets = append(nets, normalizeNet(n))
 	}
 	return nets, nil
 }
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/go-logr/logr"
@@ -139,14 +140,15 @@ func TestNewIPFilter_InvalidInput(t *testing.T) {
 
 type stubResolver struct {
 	results map[string][]string
+	chains  map[string][]string
 	err     error
 }
 
-func (s *stubResolver) Resolve(_ context.Context, hostname string) ([]string, error) {
+func (s *stubResolver) Resolve(_ context.Context, hostname string) (*Answer, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
-	return s.results[hostname], nil
+	return &Answer{Addresses: s.results[hostname], Resolver: "stub", CNAMEChain: s.chains[hostname]}, nil
 }
 
 func TestFilteringResolver(t *testing.T) {
@@ -154,6 +156,7 @@ func TestFilteringResolver(t *testing.T) {
 		results: map[string][]string{
 			"example.com": {"1.2.3.4/32", "127.0.0.1/32", "10.0.0.1/32"},
 		},
+		chains: map[string][]string{"example.com": {"example-cdn.net"}},
 	}
 
 	f, err := NewIPFilter(nil, []string{"127.0.0.0/8"})
@@ -167,10 +170,11 @@ func TestFilteringResolver(t *testing.T) {
 		Logger: logr.Discard(),
 	}
 
-	cidrs, err := r.Resolve(context.Background(), "example.com")
+	answer, err := r.Resolve(context.Background(), "example.com")
 	if err != nil {
 		t.Fatalf("Resolve() error: %v", err)
 	}
+	cidrs := answer.Addresses
 
 	// 127.0.0.1/32 should be filtered out
 	expected := []string{"1.2.3.4/32", "10.0.0.1/32"}
@@ -182,6 +186,15 @@ func TestFilteringResolver(t *testing.T) {
 			t.Errorf("Resolve()[%d] = %q, want %q", i, cidr, expected[i])
 		}
 	}
+	if len(answer.Filtered) != 1 || answer.Filtered[0] != "127.0.0.1/32" {
+		t.Errorf("Resolve() filtered = %v, want [127.0.0.1/32]", answer.Filtered)
+	}
+	if answer.Resolver != "stub" {
+		t.Errorf("Resolve() resolver = %q, want %q", answer.Resolver, "stub")
+	}
+	if len(answer.CNAMEChain) != 1 || answer.CNAMEChain[0] != "example-cdn.net" {
+		t.Errorf("Resolve() CNAME chain = %v, want [example-cdn.net]", answer.CNAMEChain)
+	}
 }
 
 func TestFilteringResolver_WithWhitelist(t *testing.T) {
@@ -202,10 +215,11 @@ func TestFilteringResolver_WithWhitelist(t *testing.T) {
 		Logger: logr.Discard(),
 	}
 
-	cidrs, err := r.Resolve(context.Background(), "example.com")
+	answer, err := r.Resolve(context.Background(), "example.com")
 	if err != nil {
 		t.Fatalf("Resolve() error: %v", err)
 	}
+	cidrs := answer.Addresses
 
 	// Only 10.0.0.1/32 should pass (whitelisted, not blacklisted)
 	// 1.2.3.4 not in whitelist, 192.168.1.1 not in whitelist
@@ -275,3 +289,158 @@ func TestFilteringResolver_DNSChangeDetection(t *testing.T) {
 		t.Errorf("expected metric increment after DNS change, got %v → %v", after, afterChange)
 	}
 }
+
+func TestFilteringResolver_Seed(t *testing.T) {
+	inner := &stubResolver{results: map[string][]string{
+		"seeded.filter.test": {"5.6.7.8/32"},
+		"live.filter.test":   {"1.2.3.4/32"},
+	}}
+	r := &FilteringResolver{Inner: inner, Filter: &IPFilter{}, Logger: logr.Discard()}
+
+	if _, err := r.Resolve(context.Background(), "live.filter.test"); err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	// A seed does not override an answer seen since the start.
+	r.Seed(map[string][]string{
+		"seeded.filter.test": {"1.2.3.4/32"},
+		"live.filter.test":   {"9.9.9.9/32"},
+	})
+
+	seededBefore := getCounterValue(dnsResolutionChangesTotal.WithLabelValues("seeded.filter.test"))
+	liveBefore := getCounterValue(dnsResolutionChangesTotal.WithLabelValues("live.filter.test"))
+	for _, hostname := range []string{"seeded.filter.test", "live.filter.test"} {
+		if _, err := r.Resolve(context.Background(), hostname); err != nil {
+			t.Fatalf("Resolve() error: %v", err)
+		}
+	}
+	if got := getCounterValue(dnsResolutionChangesTotal.WithLabelValues("seeded.filter.test")); got != seededBefore+1 {
+		t.Errorf("changes of seeded hostname = %v, want %v", got, seededBefore+1)
+	}
+	if got := getCounterValue(dnsResolutionChangesTotal.WithLabelValues("live.filter.test")); got != liveBefore {
+		t.Errorf("changes of live hostname = %v, want %v", got, liveBefore)
+	}
+}
+
+func TestFilteringResolver_Retain(t *testing.T) {
+	inner := &stubResolver{results: map[string][]string{
+		"kept.filter.test":    {"1.2.3.4/32"},
+		"evicted.filter.test": {"10.0.0.1/32"},
+	}}
+	r := &FilteringResolver{
+		Inner:      inner,
+		Filter:     &IPFilter{},
+		Logger:     logr.Discard(),
+		Quarantine: NewQuarantine(QuarantineOptions{ScopeChanges: true}),
+	}
+	r.Seed(map[string][]string{"evicted.filter.test": {"93.184.216.34/32"}})
+	for _, hostname := range []string{"kept.filter.test", "evicted.filter.test"} {
+		if _, err := r.Resolve(context.Background(), hostname); err != nil {
+			t.Fatalf("Resolve() error: %v", err)
+		}
+	}
+
+	if got := r.Retain(func(hostname string) bool { return hostname == "kept.filter.test" }); got != 1 {
+		t.Errorf("Retain() = %d, want 1", got)
+	}
+	if _, ok := r.lastSeen["evicted.filter.test"]; ok {
+		t.Error("evicted hostname is still tracked")
+	}
+	if _, ok := r.lastSeen["kept.filter.test"]; !ok {
+		t.Error("kept hostname is no longer tracked")
+	}
+	// The quarantine is dropped with the hostname, so its next answer is accepted.
+	if r.Quarantine.Acknowledge("evicted.filter.test") {
+		t.Error("evicted hostname is still quarantined")
+	}
+}
+
+func TestFilteringResolver_RetainReleasesLabels(t *testing.T) {
+	SetMaxHostnameLabels(1)
+	defer SetMaxHostnameLabels(DefaultMaxHostnameLabels)
+
+	inner := &stubResolver{results: map[string][]string{
+		"first.labels.test":  {"192.0.2.1/32"},
+		"second.labels.test": {"192.0.2.2/32"},
+	}}
+	r := &FilteringResolver{Inner: inner, Filter: &IPFilter{}, Logger: logr.Discard()}
+	for _, hostname := range []string{"first.labels.test", "second.labels.test"} {
+		if _, err := r.Resolve(context.Background(), hostname); err != nil {
+			t.Fatalf("Resolve() error: %v", err)
+		}
+	}
+	if hostnameAddresses.DeleteLabelValues(OverflowLabel) {
+		t.Error("address gauge was set for the overflow label")
+	}
+
+	r.Retain(func(hostname string) bool { return hostname == "second.labels.test" })
+	if hostnameAddresses.DeleteLabelValues("first.labels.test") {
+		t.Error("address gauge of the evicted hostname was kept")
+	}
+	// The evicted hostname's label value is released for the next hostname.
+	if _, err := r.Resolve(context.Background(), "second.labels.test"); err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if !hostnameAddresses.DeleteLabelValues("second.labels.test") {
+		t.Error("address gauge of the remaining hostname was not set")
+	}
+}
+
+func TestFilteringResolver_IPFamilies(t *testing.T) {
+	inner := &stubResolver{
+		results: map[string][]string{
+			"example.com": {"1.2.3.4/32", "127.0.0.1/32", "2001:db8::1/128", "::1/128"},
+		},
+	}
+	f, err := NewIPFilter(nil, []string{"127.0.0.0/8", "::1/128"})
+	if err != nil {
+		t.Fatalf("NewIPFilter() error: %v", err)
+	}
+	r := &FilteringResolver{Inner: inner, Filter: f, Logger: logr.Discard()}
+
+	tests := []struct {
+		name         string
+		families     []IPFamily
+		wantAllowed  []string
+		wantFiltered []string
+		wantDropped  []IPFamily
+	}{
+		{
+			name:         "all families",
+			wantAllowed:  []string{"1.2.3.4/32", "2001:db8::1/128"},
+			wantFiltered: []string{"127.0.0.1/32", "::1/128"},
+		},
+		{
+			name:         "IPv4 only",
+			families:     []IPFamily{IPv4},
+			wantAllowed:  []string{"1.2.3.4/32"},
+			wantFiltered: []string{"127.0.0.1/32"},
+			wantDropped:  []IPFamily{IPv6},
+		},
+		{
+			name:         "IPv6 only",
+			families:     []IPFamily{IPv6},
+			wantAllowed:  []string{"2001:db8::1/128"},
+			wantFiltered: []string{"::1/128"},
+			wantDropped:  []IPFamily{IPv4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithIPFamilies(context.Background(), tt.families)
+			answer, err := r.Resolve(ctx, "example.com")
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			if !slices.Equal(answer.Addresses, tt.wantAllowed) {
+				t.Errorf("Resolve() addresses = %v, want %v", answer.Addresses, tt.wantAllowed)
+			}
+			if !slices.Equal(answer.Filtered, tt.wantFiltered) {
+				t.Errorf("Resolve() filtered = %v, want %v", answer.Filtered, tt.wantFiltered)
+			}
+			if !slices.Equal(answer.DroppedFamilies, tt.wantDropped) {
+				t.Errorf("Resolve() dropped families = %v, want %v", answer.DroppedFamilies, tt.wantDropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// HostsResolver resolves hostnames from a static table in hosts-file format.
+// It is intended for reproducible offline rendering, not for use in the controller.
+type HostsResolver struct {
+	hosts map[string][]string // lowercased hostname → sorted CIDRs
+}
+
+// NewHostsResolver parses hosts-file formatted entries ("IP hostname [aliases...]")
+// from r. Blank lines and text after '#' are ignored.
+func NewHostsResolver(r io.Reader) (*HostsResolver, error) {
+	hosts := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected an address followed by at least one hostname", lineNo)
+		}
+		cidr := toCIDR(fields[0])
+		if cidr == "" {
+			return nil, fmt.Errorf("line %d: invalid IP address %q", lineNo, fields[0])
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(name)
+			hosts[name] = append(hosts[name], cidr)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading hosts: %w", err)
+	}
+
+	for name, cidrs := range hosts {
+		hosts[name] = dedupSorted(cidrs)
+	}
+	return &HostsResolver{hosts: hosts}, nil
+}
+
+// Resolve returns the CIDRs listed for hostname, or an error if it has no entry.
+func (r *HostsResolver) Resolve(_ context.Context, hostname string) (*Answer, error) {
+	cidrs, ok := r.hosts[strings.ToLower(hostname)]
+	if !ok {
+		return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname,
+			&net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true})
+	}
+	result := make([]string, len(cidrs))
+	copy(result, cidrs)
+	return &Answer{Addresses: result, Resolver: "hosts"}, nil
+}
+
+func dedupSorted(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
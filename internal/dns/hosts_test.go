@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHostsResolver(t *testing.T) {
+	hosts := `
+# static fixture
+93.184.216.34   example.com www.example.com
+2001:db8::1     example.com
+93.184.216.34   Example.com   # duplicate, different case
+10.0.0.1        internal.example.com
+`
+	r, err := NewHostsResolver(strings.NewReader(hosts))
+	if err != nil {
+		t.Fatalf("NewHostsResolver() error: %v", err)
+	}
+
+	tests := []struct {
+		hostname string
+		want     []string
+	}{
+		{hostname: "example.com", want: []string{"2001:db8::1/128", "93.184.216.34/32"}},
+		{hostname: "WWW.EXAMPLE.COM", want: []string{"93.184.216.34/32"}},
+		{hostname: "internal.example.com", want: []string{"10.0.0.1/32"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			answer, err := r.Resolve(context.Background(), tt.hostname)
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			got := answer.Addresses
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Resolve(%q) = %v, want %v", tt.hostname, got, tt.want)
+			}
+		})
+	}
+
+	_, err = r.Resolve(context.Background(), "missing.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Resolve(missing) error = %v, want not-found DNSError", err)
+	}
+}
+
+func TestNewHostsResolver_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts string
+	}{
+		{name: "missing hostname", hosts: "1.2.3.4\n"},
+		{name: "invalid address", hosts: "not-an-ip example.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHostsResolver(strings.NewReader(tt.hosts)); err == nil {
+				t.Fatal("expected error for invalid hosts input")
+			}
+		})
+	}
+}
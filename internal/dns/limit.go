@@ -0,0 +1,241 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
+)
+
+var (
+	dnsQueriesQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_dns_queries_queued",
+		Help: "Number of DNS queries waiting for a concurrency slot or the rate limit",
+	})
+
+	dnsQueriesThrottledTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "augmented_networkpolicy_dns_queries_throttled_total",
+		Help: "Total number of DNS queries delayed by the rate limit",
+	})
+
+	dnsQueryTimeoutsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "augmented_networkpolicy_dns_query_timeouts_total",
+		Help: "Total number of DNS query attempts that exceeded the per-attempt timeout",
+	})
+
+	dnsQueryRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "augmented_networkpolicy_dns_query_retries_total",
+		Help: "Total number of DNS queries retried after a failed attempt",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(dnsQueriesQueued, dnsQueriesThrottledTotal, dnsQueryTimeoutsTotal, dnsQueryRetriesTotal)
+}
+
+// LimitOptions configures a Limiter. Zero values disable the respective limit.
+type LimitOptions struct {
+	// QPS is the maximum rate of queries, including retries.
+	QPS float64
+	// Burst is the number of queries that may start at once before QPS applies.
+	// It defaults to QPS rounded up.
+	Burst int
+	// MaxConcurrent is the maximum number of queries in flight.
+	MaxConcurrent int
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+	// Retries is the number of times a query is retried after a failure other than
+	// the name not existing.
+	Retries int
+	// Backoff is the base delay before a retry. It doubles with every retry and is jittered.
+	Backoff time.Duration
+}
+
+// Limiter enforces a global rate limit, bounded concurrency, per-attempt timeouts and
+// retries on DNS queries. WireResolver and ValidatingResolver apply it to every query they
+// send. Resolvers that do not expose their queries, such as NetResolver, are wrapped in a
+// LimitingResolver instead, which applies it to every lookup.
+type Limiter struct {
+	opts    LimitOptions
+	limiter *rate.Limiter
+	slots   chan struct{}
+}
+
+// NewLimiter returns a Limiter enforcing opts.
+func NewLimiter(opts LimitOptions) *Limiter {
+	l := &Limiter{opts: opts}
+	if opts.QPS > 0 {
+		burst := opts.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(opts.QPS))
+		}
+		l.limiter = rate.NewLimiter(rate.Limit(opts.QPS), burst)
+	}
+	if opts.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return l
+}
+
+// LimitingResolver wraps a Resolver, and the SRVResolver it may implement, with a Limiter
+// that treats each lookup as a single query. Each lookup through it takes one token and
+// one slot however many queries the inner Resolver sends, so it should only wrap resolvers
+// that send one, such as NetResolver.
+type LimitingResolver struct {
+	inner  Resolver
+	limits *Limiter
+}
+
+// NewLimitingResolver returns a LimitingResolver that sends lookups to inner.
+func NewLimitingResolver(inner Resolver, opts LimitOptions) *LimitingResolver {
+	return &LimitingResolver{inner: inner, limits: NewLimiter(opts)}
+}
+
+// Resolve resolves a hostname through the inner Resolver.
+func (r *LimitingResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "dns.limit", trace.WithAttributes(attribute.String("dns.hostname", hostname)))
+	answer, err := query(ctx, r.limits, func(ctx context.Context) (*Answer, error) {
+		return r.inner.Resolve(ctx, hostname)
+	})
+	tracing.End(span, err)
+	return answer, err
+}
+
+// LookupSRV looks up SRV records through the inner Resolver, which must implement SRVResolver.
+func (r *LimitingResolver) LookupSRV(ctx context.Context, name string) ([]SRVTarget, error) {
+	srv, ok := r.inner.(SRVResolver)
+	if !ok {
+		return nil, errors.New("SRV lookups are not supported by the configured resolver")
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "dns.limit", trace.WithAttributes(
+		attribute.String("dns.hostname", name),
+		attribute.String("dns.type", "SRV"),
+	))
+	targets, err := query(ctx, r.limits, func(ctx context.Context) ([]SRVTarget, error) {
+		return srv.LookupSRV(ctx, name)
+	})
+	tracing.End(span, err)
+	return targets, err
+}
+
+// query runs fn within the limits of l, retrying failed attempts. A nil l runs fn once.
+func query[T any](ctx context.Context, l *Limiter, fn func(context.Context) (T, error)) (T, error) {
+	if l == nil {
+		return fn(ctx)
+	}
+	var zero T
+	var lastErr error
+	for retry := 0; ; retry++ {
+		if retry > 0 {
+			dnsQueryRetriesTotal.Inc()
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+				attribute.Int("dns.retry", retry),
+				attribute.String("error", lastErr.Error()),
+			))
+			if sleep(ctx, l.backoff(retry)) != nil {
+				return zero, lastErr
+			}
+		}
+
+		release, err := l.acquire(ctx)
+		if err != nil {
+			if lastErr != nil {
+				return zero, lastErr
+			}
+			return zero, fmt.Errorf("failed to wait for DNS query limits: %w", err)
+		}
+		result, err := attempt(ctx, l.opts.Timeout, fn)
+		release()
+		if err == nil {
+			return result, nil
+		}
+		if retry >= l.opts.Retries || ctx.Err() != nil || !retryable(err) {
+			return zero, err
+		}
+		lastErr = err
+	}
+}
+
+// acquire waits for a concurrency slot and the rate limit, and returns a function
+// that releases the slot.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	dnsQueriesQueued.Inc()
+	defer dnsQueriesQueued.Dec()
+
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if l.limiter != nil && !l.limiter.Allow() {
+		dnsQueriesThrottledTotal.Inc()
+		trace.SpanFromContext(ctx).AddEvent("throttled")
+		if err := l.limiter.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// attempt runs fn once, bounded by the per-query timeout.
+func attempt[T any](ctx context.Context, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := fn(qctx)
+	if err != nil && ctx.Err() == nil && errors.Is(qctx.Err(), context.DeadlineExceeded) {
+		dnsQueryTimeoutsTotal.Inc()
+		return result, fmt.Errorf("DNS query timed out after %s: %w", timeout, err)
+	}
+	return result, err
+}
+
+// backoff returns the jittered delay before the given retry.
+func (l *Limiter) backoff(retry int) time.Duration {
+	if l.opts.Backoff <= 0 {
+		return 0
+	}
+	d := l.opts.Backoff << min(retry-1, 16)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable reports whether a failed query may succeed when retried.
+func retryable(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
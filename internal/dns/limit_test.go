@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// funcResolver resolves hostnames with a function.
+type funcResolver func(ctx context.Context, hostname string) (*Answer, error)
+
+func (f funcResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	return f(ctx, hostname)
+}
+
+func TestLimitingResolver_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "success", wantAttempts: 1},
+		{
+			name:         "transient failure is retried",
+			err:          &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			failures:     2,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries are exhausted",
+			err:          errors.New("connection refused"),
+			failures:     5,
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "missing name is not retried",
+			err:          &net.DNSError{Err: "no such host", IsNotFound: true},
+			failures:     5,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			inner := funcResolver(func(_ context.Context, _ string) (*Answer, error) {
+				if int(attempts.Add(1)) <= tt.failures {
+					return nil, tt.err
+				}
+				return &Answer{Addresses: []string{"192.0.2.1/32"}}, nil
+			})
+			r := NewLimitingResolver(inner, LimitOptions{Retries: 2, Backoff: time.Millisecond})
+
+			_, err := r.Resolve(context.Background(), "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, tt.err) {
+				t.Errorf("Resolve() error = %v, want %v", err, tt.err)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestLimitingResolver_Timeout(t *testing.T) {
+	var attempts atomic.Int32
+	inner := funcResolver(func(ctx context.Context, _ string) (*Answer, error) {
+		attempts.Add(1)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	r := NewLimitingResolver(inner, LimitOptions{Timeout: 10 * time.Millisecond, Retries: 1})
+
+	_, err := r.Resolve(context.Background(), "example.com")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Resolve() error = %v, want deadline exceeded", err)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestLimitingResolver_CanceledContext(t *testing.T) {
+	var attempts atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	inner := funcResolver(func(_ context.Context, _ string) (*Answer, error) {
+		attempts.Add(1)
+		cancel()
+		return nil, errors.New("connection refused")
+	})
+	r := NewLimitingResolver(inner, LimitOptions{Retries: 3})
+
+	if _, err := r.Resolve(ctx, "example.com"); err == nil {
+		t.Fatal("Resolve() error = nil, want error")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
+
+func TestLimitingResolver_MaxConcurrent(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	inner := funcResolver(func(_ context.Context, _ string) (*Answer, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &Answer{}, nil
+	})
+	r := NewLimitingResolver(inner, LimitOptions{MaxConcurrent: 3})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := r.Resolve(context.Background(), "example.com"); err != nil {
+				t.Errorf("Resolve() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", got)
+	}
+}
+
+func TestLimitingResolver_QPS(t *testing.T) {
+	inner := funcResolver(func(_ context.Context, _ string) (*Answer, error) {
+		return &Answer{}, nil
+	})
+	r := NewLimitingResolver(inner, LimitOptions{QPS: 20, Burst: 1})
+
+	start := time.Now()
+	for range 5 {
+		if _, err := r.Resolve(context.Background(), "example.com"); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	}
+	// The first query uses the burst; the remaining four wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 queries at 20 QPS took %s, want at least 150ms", elapsed)
+	}
+}
+
+func TestLimitingResolver_SRVUnsupported(t *testing.T) {
+	r := NewLimitingResolver(funcResolver(nil), LimitOptions{})
+	if _, err := r.LookupSRV(context.Background(), "_ldap._tcp.example.com"); err == nil {
+		t.Error("LookupSRV() error = nil, want error")
+	}
+}
@@ -0,0 +1,198 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/dns/dnsmessage"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
+)
+
+var (
+	dnsLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "augmented_networkpolicy_dns_lookup_duration_seconds",
+		Help:    "Duration of upstream DNS lookup attempts",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"hostname", "upstream"})
+
+	dnsLookupErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "augmented_networkpolicy_dns_lookup_errors_total",
+		Help: "Total number of failed upstream DNS lookup attempts by error class",
+	}, []string{"hostname", "upstream", "class"})
+
+	hostnameAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_hostname_addresses",
+		Help: "Number of addresses a hostname last resolved to after IP filtering",
+	}, []string{"hostname"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(dnsLookupDuration, dnsLookupErrorsTotal, hostnameAddresses)
+}
+
+// Error classes of failed lookups.
+const (
+	ErrorClassNXDOMAIN = "NXDOMAIN"
+	ErrorClassSERVFAIL = "SERVFAIL"
+	ErrorClassTimeout  = "timeout"
+	ErrorClassOther    = "other"
+)
+
+// ClassifyError returns the error class of a failed lookup. Only a SERVFAIL response code
+// is classified as SERVFAIL; other temporary errors, such as unreachable servers or other
+// response codes, are classified as other.
+func ClassifyError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return ErrorClassNXDOMAIN
+		case dnsErr.IsTimeout:
+			return ErrorClassTimeout
+		// The system resolver reports SERVFAIL, and only SERVFAIL, as a temporary
+		// "server misbehaving" error; WireResolver names the response code.
+		case dnsErr.Err == "server misbehaving" && dnsErr.IsTemporary,
+			dnsErr.Err == "server misbehaving: "+dnsmessage.RCodeServerFailure.String():
+			return ErrorClassSERVFAIL
+		}
+	}
+	return ErrorClassOther
+}
+
+// OverflowLabel replaces hostname label values beyond the cardinality limit.
+const OverflowLabel = "_other"
+
+// DefaultMaxHostnameLabels is the default limit on distinct hostname label values.
+const DefaultMaxHostnameLabels = 1000
+
+// LabelLimiter bounds the number of distinct values of a metric label. Values seen
+// after the limit is reached are reported as OverflowLabel.
+type LabelLimiter struct {
+	mu    sync.Mutex
+	max   int
+	known map[string]struct{}
+}
+
+// NewLabelLimiter returns a LabelLimiter that admits up to max distinct values.
+// A max of zero or less admits every value.
+func NewLabelLimiter(max int) *LabelLimiter {
+	return &LabelLimiter{max: max, known: make(map[string]struct{})}
+}
+
+// Value returns v if it is admitted, or OverflowLabel otherwise.
+func (l *LabelLimiter) Value(v string) string {
+	if l.max <= 0 {
+		return v
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.known[v]; ok {
+		return v
+	}
+	if len(l.known) >= l.max {
+		return OverflowLabel
+	}
+	l.known[v] = struct{}{}
+	return v
+}
+
+// Forget releases v so that another value can be admitted in its place, and reports
+// whether v had been admitted. Without a limit, every value counts as admitted.
+func (l *LabelLimiter) Forget(v string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.known[v]
+	delete(l.known, v)
+	return ok
+}
+
+// hostnameLabels guards the hostname label of every metric in this package.
+var hostnameLabels = NewLabelLimiter(DefaultMaxHostnameLabels)
+
+// forgetHostname deletes the series of every metric in this package labeled with hostname
+// and releases its label value, unless hostname is reported as OverflowLabel.
+func forgetHostname(hostname string) {
+	if !hostnameLabels.Forget(hostname) {
+		return
+	}
+	dnsLookupDuration.DeletePartialMatch(prometheus.Labels{"hostname": hostname})
+	dnsLookupErrorsTotal.DeletePartialMatch(prometheus.Labels{"hostname": hostname})
+	hostnameAddresses.DeleteLabelValues(hostname)
+	ipFilteredTotal.DeleteLabelValues(hostname)
+	dnsResolutionChangesTotal.DeleteLabelValues(hostname)
+	hostnameQuarantined.DeleteLabelValues(hostname)
+}
+
+// SetMaxHostnameLabels sets the limit on distinct hostname label values. It must be
+// called before any hostname is resolved.
+func SetMaxHostnameLabels(max int) {
+	hostnameLabels = NewLabelLimiter(max)
+}
+
+// InstrumentedResolver wraps a Resolver, and the SRVResolver it may implement, and
+// records the duration and errors of every lookup in metrics and a trace span.
+type InstrumentedResolver struct {
+	inner    Resolver
+	upstream string
+}
+
+// NewInstrumentedResolver returns an InstrumentedResolver that labels its metrics
+// with the upstream name.
+func NewInstrumentedResolver(inner Resolver, upstream string) *InstrumentedResolver {
+	return &InstrumentedResolver{inner: inner, upstream: upstream}
+}
+
+// Resolve resolves a hostname through the inner Resolver.
+func (r *InstrumentedResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	ctx, span := r.start(ctx, hostname, "A/AAAA")
+	start := time.Now()
+	answer, err := r.inner.Resolve(ctx, hostname)
+	r.observe(span, hostname, start, err)
+	return answer, err
+}
+
+// LookupSRV looks up SRV records through the inner Resolver, which must implement SRVResolver.
+func (r *InstrumentedResolver) LookupSRV(ctx context.Context, name string) ([]SRVTarget, error) {
+	srv, ok := r.inner.(SRVResolver)
+	if !ok {
+		return nil, errors.New("SRV lookups are not supported by the configured resolver")
+	}
+	ctx, span := r.start(ctx, name, "SRV")
+	start := time.Now()
+	targets, err := srv.LookupSRV(ctx, name)
+	r.observe(span, name, start, err)
+	return targets, err
+}
+
+func (r *InstrumentedResolver) start(ctx context.Context, name, qtype string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "dns.upstream", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("dns.hostname", name),
+		attribute.String("dns.type", qtype),
+		attribute.String("dns.upstream", r.upstream),
+	))
+}
+
+func (r *InstrumentedResolver) observe(span trace.Span, name string, start time.Time, err error) {
+	label := hostnameLabels.Value(name)
+	dnsLookupDuration.WithLabelValues(label, r.upstream).Observe(time.Since(start).Seconds())
+	if err != nil {
+		class := ClassifyError(err)
+		dnsLookupErrorsTotal.WithLabelValues(label, r.upstream, class).Inc()
+		span.SetAttributes(attribute.String("dns.error_class", class))
+	}
+	tracing.End(span, err)
+}
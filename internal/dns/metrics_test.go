@@ -0,0 +1,125 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "name not found",
+			err:  fmt.Errorf("failed to resolve: %w", &net.DNSError{Err: "no such host", IsNotFound: true}),
+			want: ErrorClassNXDOMAIN,
+		},
+		{
+			name: "server failure",
+			err:  &net.DNSError{Err: "server misbehaving: RCodeServerFailure", IsTemporary: true},
+			want: ErrorClassSERVFAIL,
+		},
+		{
+			name: "server failure from the system resolver",
+			err:  &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			want: ErrorClassSERVFAIL,
+		},
+		{
+			name: "refused",
+			err:  &net.DNSError{Err: "server misbehaving: RCodeRefused", IsTemporary: true},
+			want: ErrorClassOther,
+		},
+		{
+			name: "other temporary error",
+			err:  &net.DNSError{Err: "read udp 10.0.0.1:53: connection refused", IsTemporary: true},
+			want: ErrorClassOther,
+		},
+		{
+			name: "resolver timeout",
+			err:  &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			want: ErrorClassTimeout,
+		},
+		{
+			name: "context deadline",
+			err:  fmt.Errorf("DNS query timed out: %w", context.DeadlineExceeded),
+			want: ErrorClassTimeout,
+		},
+		{
+			name: "anything else",
+			err:  errors.New("connection refused"),
+			want: ErrorClassOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelLimiter(t *testing.T) {
+	l := NewLabelLimiter(2)
+	for _, tt := range []struct{ value, want string }{
+		{"a.example.com", "a.example.com"},
+		{"b.example.com", "b.example.com"},
+		{"c.example.com", OverflowLabel},
+		{"a.example.com", "a.example.com"},
+	} {
+		if got := l.Value(tt.value); got != tt.want {
+			t.Errorf("Value(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	if l.Forget("c.example.com") {
+		t.Error("Forget() of an overflowing value = true, want false")
+	}
+	if !l.Forget("a.example.com") {
+		t.Error("Forget() of an admitted value = false, want true")
+	}
+	if got := l.Value("c.example.com"); got != "c.example.com" {
+		t.Errorf("Value() after Forget() = %q, want c.example.com", got)
+	}
+
+	if got := NewLabelLimiter(0).Value("c.example.com"); got != "c.example.com" {
+		t.Errorf("unlimited Value() = %q, want c.example.com", got)
+	}
+}
+
+func TestInstrumentedResolver(t *testing.T) {
+	inner := funcResolver(func(_ context.Context, hostname string) (*Answer, error) {
+		if hostname == "missing.metrics.test" {
+			return nil, &net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true}
+		}
+		return &Answer{Addresses: []string{"192.0.2.1/32"}}, nil
+	})
+	r := NewInstrumentedResolver(inner, "test")
+
+	errorsBefore := testutil.ToFloat64(dnsLookupErrorsTotal.WithLabelValues("missing.metrics.test", "test", ErrorClassNXDOMAIN))
+	if _, err := r.Resolve(context.Background(), "found.metrics.test"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if _, err := r.Resolve(context.Background(), "missing.metrics.test"); err == nil {
+		t.Fatal("Resolve() error = nil, want error")
+	}
+
+	if got := testutil.CollectAndCount(dnsLookupDuration, "augmented_networkpolicy_dns_lookup_duration_seconds"); got < 2 {
+		t.Errorf("lookup duration series = %d, want at least 2", got)
+	}
+	errorsAfter := testutil.ToFloat64(dnsLookupErrorsTotal.WithLabelValues("missing.metrics.test", "test", ErrorClassNXDOMAIN))
+	if errorsAfter != errorsBefore+1 {
+		t.Errorf("NXDOMAIN errors = %v, want %v", errorsAfter, errorsBefore+1)
+	}
+	if got := testutil.ToFloat64(dnsLookupErrorsTotal.WithLabelValues("found.metrics.test", "test", ErrorClassNXDOMAIN)); got != 0 {
+		t.Errorf("errors for a successful lookup = %v, want 0", got)
+	}
+}
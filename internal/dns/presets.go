@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// PresetClusterCIDRs names the preset that expands to the cluster's Pod and Service CIDRs,
+// which are discovered at runtime rather than listed in Presets.
+const PresetClusterCIDRs = "cluster-cidrs"
+
+// Presets are named sets of CIDRs that can be used in place of CIDRs in IP filter lists.
+var Presets = map[string][]string{
+	// Cloud instance metadata endpoints (AWS, GCP, Azure, OpenStack; AWS IPv6; ECS task metadata).
+	"metadata":     {"169.254.169.254/32", "fd00:ec2::254/128", "169.254.170.2/32"},
+	"loopback":     {"127.0.0.0/8", "::1/128"},
+	"rfc1918":      {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+	"cgnat":        {"100.64.0.0/10"},
+	"unique-local": {"fc00::/7"},
+	"link-local":   {"169.254.0.0/16", "fe80::/10"},
+	"unspecified":  {"0.0.0.0/32", "::/128"},
+}
+
+// DefaultBlacklist is the blacklist used when none is configured explicitly.
+var DefaultBlacklist = []string{"metadata", "loopback", "link-local", "unspecified"}
+
+// PresetNames returns the names of all presets, sorted.
+func PresetNames() []string {
+	names := []string{PresetClusterCIDRs}
+	for name := range Presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ExpandPresets replaces preset names in entries with their CIDRs and returns the
+// deduplicated result. clusterCIDRs is called at most once, and only if the
+// cluster-cidrs preset is used.
+func ExpandPresets(entries []string, clusterCIDRs func() ([]string, error)) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(cidrs ...string) {
+		for _, cidr := range cidrs {
+			if !seen[cidr] {
+				seen[cidr] = true
+				out = append(out, cidr)
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			add(entry)
+		case entry == PresetClusterCIDRs:
+			if clusterCIDRs == nil {
+				return nil, fmt.Errorf("preset %q is not available here", entry)
+			}
+			cidrs, err := clusterCIDRs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to discover cluster CIDRs: %w", err)
+			}
+			add(cidrs...)
+			clusterCIDRs = func() ([]string, error) { return cidrs, nil }
+		default:
+			cidrs, ok := Presets[entry]
+			if !ok {
+				return nil, fmt.Errorf("unknown preset %q (known presets: %s)", entry, strings.Join(PresetNames(), ", "))
+			}
+			add(cidrs...)
+		}
+	}
+	return out, nil
+}
+
+// normalizeNet turns an IPv4-mapped IPv6 network (within ::ffff:0:0/96) into the
+// equivalent IPv4 network, so that it matches IPv4 addresses.
+func normalizeNet(n *net.IPNet) *net.IPNet {
+	ones, bits := n.Mask.Size()
+	ip4 := n.IP.To4()
+	if bits != 8*net.IPv6len || ip4 == nil || ones < 96 {
+		return n
+	}
+	return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+}
@@ -0,0 +1,116 @@
+package dns
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestExpandPresets(t *testing.T) {
+	cluster := func() ([]string, error) { return []string{"10.244.0.0/16", "10.96.0.0/12"}, nil }
+
+	tests := []struct {
+		name    string
+		entries []string
+		cluster func() ([]string, error)
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "CIDRs pass through",
+			entries: []string{"192.0.2.0/24", "2001:db8::/32"},
+			want:    []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		{
+			name:    "presets expand and combine with CIDRs",
+			entries: []string{"loopback", "192.0.2.0/24", "rfc1918"},
+			want:    []string{"127.0.0.0/8", "::1/128", "192.0.2.0/24", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+		},
+		{
+			name:    "duplicates are removed",
+			entries: []string{"link-local", "metadata"},
+			want:    []string{"169.254.0.0/16", "fe80::/10", "169.254.169.254/32", "fd00:ec2::254/128", "169.254.170.2/32"},
+		},
+		{
+			name:    "cluster CIDRs are discovered",
+			entries: []string{"cluster-cidrs", "cluster-cidrs"},
+			cluster: cluster,
+			want:    []string{"10.244.0.0/16", "10.96.0.0/12"},
+		},
+		{
+			name:    "cluster CIDRs unavailable",
+			entries: []string{"cluster-cidrs"},
+			wantErr: true,
+		},
+		{
+			name:    "cluster CIDR discovery fails",
+			entries: []string{"cluster-cidrs"},
+			cluster: func() ([]string, error) { return nil, errors.New("forbidden") },
+			wantErr: true,
+		},
+		{
+			name:    "unknown preset",
+			entries: []string{"rfc1819"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandPresets(tt.entries, tt.cluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandPresets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandPresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultBlacklist(t *testing.T) {
+	blacklist, err := ExpandPresets(DefaultBlacklist, nil)
+	if err != nil {
+		t.Fatalf("ExpandPresets(DefaultBlacklist) error = %v", err)
+	}
+	f, err := NewIPFilter(nil, blacklist)
+	if err != nil {
+		t.Fatalf("NewIPFilter() error = %v", err)
+	}
+
+	for cidr, want := range map[string]bool{
+		"169.254.169.254/32":         false,
+		"fd00:ec2::254/128":          false,
+		"127.0.0.1/32":               false,
+		"::1/128":                    false,
+		"::ffff:127.0.0.1/128":       false,
+		"::ffff:169.254.169.254/128": false,
+		"fe80::1/128":                false,
+		"0.0.0.0/32":                 false,
+		"::/128":                     false,
+		"93.184.216.34/32":           true,
+		"2606:2800:220:1::/128":      true,
+		"10.0.0.1/32":                true,
+	} {
+		if got := f.IsAllowed(cidr); got != want {
+			t.Errorf("IsAllowed(%q) = %v, want %v", cidr, got, want)
+		}
+	}
+}
+
+func TestIPFilter_IPv4MappedNetworks(t *testing.T) {
+	f, err := NewIPFilter(nil, []string{"::ffff:10.0.0.0/104"})
+	if err != nil {
+		t.Fatalf("NewIPFilter() error = %v", err)
+	}
+	for cidr, want := range map[string]bool{
+		"10.1.2.3/32":         false,
+		"::ffff:10.1.2.3/128": false,
+		"11.0.0.1/32":         true,
+		"2001:db8::1/128":     true,
+	} {
+		if got := f.IsAllowed(cidr); got != want {
+			t.Errorf("IsAllowed(%q) = %v, want %v", cidr, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package dns
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	hostnameQuarantined = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "augmented_networkpolicy_hostname_quarantined",
+		Help: "Whether a hostname is quarantined for a suspected DNS rebinding (1) or not (0)",
+	}, []string{"hostname"})
+
+	quarantinesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "augmented_networkpolicy_quarantines_total",
+		Help: "Total number of hostnames quarantined for a suspected DNS rebinding by reason",
+	}, []string{"reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(hostnameQuarantined, quarantinesTotal)
+}
+
+// Reasons a hostname is quarantined.
+const (
+	// QuarantineReasonScopeChange means the answer gained an address scope, e.g. a
+	// private address for a hostname that previously resolved to public addresses only.
+	QuarantineReasonScopeChange = "ScopeChange"
+	// QuarantineReasonFlapping means the answer changed too often within the window.
+	QuarantineReasonFlapping = "Flapping"
+)
+
+// Address scopes compared by scope change detection.
+const (
+	ScopePublic      = "public"
+	ScopePrivate     = "private"
+	ScopeLoopback    = "loopback"
+	ScopeLinkLocal   = "link-local"
+	ScopeUnspecified = "unspecified"
+)
+
+// QuarantineOptions configures when a hostname is quarantined.
+type QuarantineOptions struct {
+	// ScopeChanges quarantines a hostname whose answer gains an address scope its
+	// previous answer did not have.
+	ScopeChanges bool
+	// MaxChanges quarantines a hostname whose answer changes more than MaxChanges times
+	// within Window. Zero disables the limit.
+	MaxChanges int
+	// Window is the period over which changes are counted.
+	Window time.Duration
+}
+
+// Quarantine tracks hostnames whose answers changed suspiciously. A quarantined
+// hostname is frozen to the last answer before the suspicious change until it is
+// acknowledged.
+type Quarantine struct {
+	opts QuarantineOptions
+	now  func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*quarantineState
+}
+
+type quarantineState struct {
+	changes []time.Time
+	reason  string
+	frozen  []string
+}
+
+// NewQuarantine returns a Quarantine with the given options.
+func NewQuarantine(opts QuarantineOptions) *Quarantine {
+	return &Quarantine{opts: opts, now: time.Now, hosts: make(map[string]*quarantineState)}
+}
+
+// Observe records a change of hostname's answer from prev to current, both sorted.
+// It returns the addresses to use and, if the hostname is quarantined, the reason.
+// started reports whether this change put the hostname in quarantine.
+func (q *Quarantine) Observe(hostname string, prev, current []string) (addresses []string, reason string, started bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := q.hosts[hostname]
+	if s != nil && s.reason != "" {
+		return s.frozen, s.reason, false
+	}
+	// Nothing to freeze to before the first non-empty answer.
+	if len(prev) == 0 || stringSlicesEqual(prev, current) {
+		return current, "", false
+	}
+	if s == nil {
+		s = &quarantineState{}
+		q.hosts[hostname] = s
+	}
+
+	if q.opts.ScopeChanges && gainsScope(prev, current) {
+		reason = QuarantineReasonScopeChange
+	}
+	if q.opts.MaxChanges > 0 {
+		now := q.now()
+		changes := s.changes[:0]
+		for _, t := range s.changes {
+			if now.Sub(t) < q.opts.Window {
+				changes = append(changes, t)
+			}
+		}
+		s.changes = append(changes, now)
+		if reason == "" && len(s.changes) > q.opts.MaxChanges {
+			reason = QuarantineReasonFlapping
+		}
+	}
+	if reason == "" {
+		return current, "", false
+	}
+
+	s.reason = reason
+	s.frozen = prev
+	s.changes = nil
+	if label := hostnameLabels.Value(hostname); label != OverflowLabel {
+		hostnameQuarantined.WithLabelValues(label).Set(1)
+	}
+	quarantinesTotal.WithLabelValues(reason).Inc()
+	return prev, reason, true
+}
+
+// Acknowledge releases hostname from quarantine. Its next answer is accepted as is.
+// It returns false if hostname was not quarantined.
+func (q *Quarantine) Acknowledge(hostname string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.hosts[hostname]
+	if s == nil || s.reason == "" {
+		return false
+	}
+	delete(q.hosts, hostname)
+	if label := hostnameLabels.Value(hostname); label != OverflowLabel {
+		hostnameQuarantined.WithLabelValues(label).Set(0)
+	}
+	return true
+}
+
+// Restore quarantines hostname for reason with the given frozen addresses, as recorded
+// before a restart. A hostname that is already quarantined is left as is.
+func (q *Quarantine) Restore(hostname, reason string, frozen []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if s := q.hosts[hostname]; s != nil && s.reason != "" {
+		return
+	}
+	q.hosts[hostname] = &quarantineState{reason: reason, frozen: copyAndSort(frozen)}
+	if label := hostnameLabels.Value(hostname); label != OverflowLabel {
+		hostnameQuarantined.WithLabelValues(label).Set(1)
+	}
+}
+
+// Quarantined returns the quarantined hostnames, sorted.
+func (q *Quarantine) Quarantined() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var hostnames []string
+	for hostname, s := range q.hosts {
+		if s.reason != "" {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// retain forgets hostnames for which keep returns false.
+func (q *Quarantine) retain(keep func(hostname string) bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for hostname := range q.hosts {
+		if keep(hostname) {
+			continue
+		}
+		delete(q.hosts, hostname)
+		forgetHostname(hostname)
+	}
+}
+
+// gainsScope returns whether current contains an address of a scope that prev has none of.
+func gainsScope(prev, current []string) bool {
+	scopes := make(map[string]bool)
+	for _, cidr := range prev {
+		scopes[AddressScope(cidr)] = true
+	}
+	for _, cidr := range current {
+		if !scopes[AddressScope(cidr)] {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressScope returns the scope of an address in CIDR notation. Unparseable
+// addresses are reported as ScopeUnspecified.
+func AddressScope(cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return ScopeUnspecified
+	}
+	addr := prefix.Addr().Unmap()
+	switch {
+	case addr.IsUnspecified():
+		return ScopeUnspecified
+	case addr.IsLoopback():
+		return ScopeLoopback
+	case addr.IsLinkLocalUnicast():
+		return ScopeLinkLocal
+	case addr.IsPrivate() || cgnat.Contains(addr):
+		return ScopePrivate
+	}
+	return ScopePublic
+}
+
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
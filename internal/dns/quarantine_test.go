@@ -0,0 +1,227 @@
+package dns
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestAddressScope(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"93.184.216.34/32", ScopePublic},
+		{"2606:2800:220:1::/128", ScopePublic},
+		{"10.1.2.3/32", ScopePrivate},
+		{"192.168.1.1/32", ScopePrivate},
+		{"100.64.0.1/32", ScopePrivate},
+		{"fd00::1/128", ScopePrivate},
+		{"::ffff:10.0.0.1/128", ScopePrivate},
+		{"127.0.0.1/32", ScopeLoopback},
+		{"::1/128", ScopeLoopback},
+		{"169.254.169.254/32", ScopeLinkLocal},
+		{"fe80::1/128", ScopeLinkLocal},
+		{"0.0.0.0/32", ScopeUnspecified},
+		{"not-an-address", ScopeUnspecified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			if got := AddressScope(tt.cidr); got != tt.want {
+				t.Errorf("AddressScope(%q) = %q, want %q", tt.cidr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuarantine_Observe(t *testing.T) {
+	public := []string{"93.184.216.34/32"}
+	otherPublic := []string{"93.184.216.35/32"}
+	private := []string{"10.0.0.1/32"}
+	mixed := []string{"10.0.0.1/32", "93.184.216.34/32"}
+
+	type step struct {
+		prev, current []string
+		advance       time.Duration
+		want          []string
+		wantReason    string
+	}
+	tests := []struct {
+		name  string
+		opts  QuarantineOptions
+		steps []step
+	}{
+		{
+			name: "public to private is a scope change",
+			opts: QuarantineOptions{ScopeChanges: true},
+			steps: []step{
+				{prev: public, current: private, want: public, wantReason: QuarantineReasonScopeChange},
+				// Frozen until acknowledged, whatever the upstream answer.
+				{prev: private, current: public, want: public, wantReason: QuarantineReasonScopeChange},
+			},
+		},
+		{
+			name: "gaining a private address is a scope change",
+			opts: QuarantineOptions{ScopeChanges: true},
+			steps: []step{
+				{prev: public, current: mixed, want: public, wantReason: QuarantineReasonScopeChange},
+			},
+		},
+		{
+			name: "changes within a scope are accepted",
+			opts: QuarantineOptions{ScopeChanges: true},
+			steps: []step{
+				{prev: public, current: otherPublic, want: otherPublic},
+				{prev: mixed, current: private, want: private},
+			},
+		},
+		{
+			name: "first answer is accepted",
+			opts: QuarantineOptions{ScopeChanges: true},
+			steps: []step{
+				{prev: nil, current: private, want: private},
+			},
+		},
+		{
+			name: "scope changes are ignored unless enabled",
+			opts: QuarantineOptions{MaxChanges: 5, Window: time.Hour},
+			steps: []step{
+				{prev: public, current: private, want: private},
+			},
+		},
+		{
+			name: "too many changes within the window",
+			opts: QuarantineOptions{MaxChanges: 2, Window: time.Hour},
+			steps: []step{
+				{prev: public, current: otherPublic, want: otherPublic},
+				{prev: otherPublic, current: public, advance: time.Minute, want: public},
+				{prev: public, current: otherPublic, advance: time.Minute, want: public, wantReason: QuarantineReasonFlapping},
+			},
+		},
+		{
+			name: "changes outside the window are forgotten",
+			opts: QuarantineOptions{MaxChanges: 2, Window: time.Hour},
+			steps: []step{
+				{prev: public, current: otherPublic, want: otherPublic},
+				{prev: otherPublic, current: public, advance: time.Minute, want: public},
+				{prev: public, current: otherPublic, advance: time.Hour, want: otherPublic},
+			},
+		},
+		{
+			name: "unchanged answers are not counted",
+			opts: QuarantineOptions{MaxChanges: 1, Window: time.Hour},
+			steps: []step{
+				{prev: public, current: public, want: public},
+				{prev: public, current: public, want: public},
+				{prev: public, current: otherPublic, want: otherPublic},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			q := NewQuarantine(tt.opts)
+			q.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				got, reason, _ := q.Observe("host.quarantine.test", s.prev, s.current)
+				if !slices.Equal(got, s.want) || reason != s.wantReason {
+					t.Errorf("step %d: Observe() = %v, %q, want %v, %q", i, got, reason, s.want, s.wantReason)
+				}
+			}
+		})
+	}
+}
+
+func TestQuarantine_Acknowledge(t *testing.T) {
+	q := NewQuarantine(QuarantineOptions{ScopeChanges: true})
+	public := []string{"93.184.216.34/32"}
+	private := []string{"10.0.0.1/32"}
+
+	if q.Acknowledge("ack.quarantine.test") {
+		t.Error("Acknowledge() of a hostname that is not quarantined = true, want false")
+	}
+	if _, _, started := q.Observe("ack.quarantine.test", public, private); !started {
+		t.Fatal("Observe() did not start a quarantine")
+	}
+	if !q.Acknowledge("ack.quarantine.test") {
+		t.Fatal("Acknowledge() = false, want true")
+	}
+	// The answer that caused the quarantine is accepted once acknowledged.
+	got, reason, _ := q.Observe("ack.quarantine.test", private, private)
+	if !slices.Equal(got, private) || reason != "" {
+		t.Errorf("Observe() after Acknowledge() = %v, %q, want %v, not quarantined", got, reason, private)
+	}
+}
+
+func TestQuarantine_Restore(t *testing.T) {
+	q := NewQuarantine(QuarantineOptions{})
+	public := []string{"93.184.216.34/32"}
+	otherPublic := []string{"93.184.216.35/32"}
+
+	q.Restore("restored.quarantine.test", QuarantineReasonFlapping, public)
+	if got := q.Quarantined(); !slices.Equal(got, []string{"restored.quarantine.test"}) {
+		t.Errorf("Quarantined() = %v, want the restored hostname", got)
+	}
+	// The restored quarantine holds although the options would not quarantine the change.
+	got, reason, started := q.Observe("restored.quarantine.test", public, otherPublic)
+	if !slices.Equal(got, public) || reason != QuarantineReasonFlapping || started {
+		t.Errorf("Observe() = %v, %q, %v, want %v, %q, false", got, reason, started, public, QuarantineReasonFlapping)
+	}
+	// Restoring does not replace an existing quarantine.
+	q.Restore("restored.quarantine.test", QuarantineReasonScopeChange, otherPublic)
+	if got, reason, _ := q.Observe("restored.quarantine.test", public, otherPublic); !slices.Equal(got, public) ||
+		reason != QuarantineReasonFlapping {
+		t.Errorf("Observe() after a second Restore() = %v, %q, want %v, %q", got, reason, public, QuarantineReasonFlapping)
+	}
+	if !q.Acknowledge("restored.quarantine.test") {
+		t.Error("Acknowledge() of a restored hostname = false, want true")
+	}
+}
+
+func TestFilteringResolver_Quarantine(t *testing.T) {
+	answers := map[string][]string{"rebind.quarantine.test": {"93.184.216.34/32"}}
+	resolver := &FilteringResolver{
+		Inner: funcResolver(func(_ context.Context, hostname string) (*Answer, error) {
+			return &Answer{Addresses: answers[hostname]}, nil
+		}),
+		Filter:     &IPFilter{},
+		Logger:     logr.Discard(),
+		Quarantine: NewQuarantine(QuarantineOptions{ScopeChanges: true}),
+	}
+	resolve := func() *Answer {
+		t.Helper()
+		answer, err := resolver.Resolve(context.Background(), "rebind.quarantine.test")
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		return answer
+	}
+
+	if answer := resolve(); answer.Quarantine != "" {
+		t.Fatalf("first answer quarantined: %q", answer.Quarantine)
+	}
+
+	answers["rebind.quarantine.test"] = []string{"10.0.0.1/32"}
+	answer := resolve()
+	if answer.Quarantine != QuarantineReasonScopeChange {
+		t.Errorf("Quarantine = %q, want %q", answer.Quarantine, QuarantineReasonScopeChange)
+	}
+	if want := []string{"93.184.216.34/32"}; !slices.Equal(answer.Addresses, want) {
+		t.Errorf("quarantined Addresses = %v, want last-known-good %v", answer.Addresses, want)
+	}
+
+	resolver.Quarantine.Acknowledge("rebind.quarantine.test")
+	answer = resolve()
+	if answer.Quarantine != "" {
+		t.Errorf("Quarantine after acknowledge = %q, want none", answer.Quarantine)
+	}
+	if want := []string{"10.0.0.1/32"}; !slices.Equal(answer.Addresses, want) {
+		t.Errorf("Addresses after acknowledge = %v, want %v", answer.Addresses, want)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"sort"
+	"net/netip"
 	"strings"
 )
 
@@ -12,11 +12,62 @@ import (
 type Resolver interface {
 	// Resolve resolves a hostname to a list of IP addresses in CIDR notation
 	// (e.g., "1.2.3.4/32" for IPv4 or "::1/128" for IPv6).
-	Resolve(ctx context.Context, hostname string) ([]string, error)
+	Resolve(ctx context.Context, hostname string) (*Answer, error)
+}
+
+// Answer is the result of resolving a hostname.
+type Answer struct {
+	// Addresses are the resolved IP addresses in CIDR notation.
+	Addresses []string
+	// Filtered are resolved IP addresses in CIDR notation that were removed by a filter.
+	Filtered []string
+	// Resolver names the resolver that produced the answer (e.g. "system").
+	Resolver string
+	// CNAMEChain lists the names the hostname is an alias for, in the order they were
+	// followed, ending with the canonical name. It is empty if the hostname is canonical.
+	// Resolvers that cannot observe intermediate aliases report only the canonical name.
+	CNAMEChain []string
+	// CNAMEChainError is why the CNAME chain could not be determined, if it was requested
+	// (see WithCNAMEChain). CNAMEChain is then empty and must not be relied on.
+	CNAMEChainError string
+	// DroppedFamilies lists the families whose addresses were dropped because the
+	// resolution was restricted to other families (see WithIPFamilies).
+	DroppedFamilies []IPFamily
+	// DNSSEC is the outcome of DNSSEC validation, or empty if the answer was not validated.
+	DNSSEC DNSSECResult
+	// DNSSECReason explains why the answer is not DNSSECSecure.
+	DNSSECReason string
+	// Quarantine is the reason the hostname is quarantined, if it is. Addresses are then
+	// the last answer before the suspicious change rather than the current one.
+	Quarantine string
+}
+
+type cnameChainKey struct{}
+
+// WithCNAMEChain returns a context that asks resolvers that only learn the CNAME chain
+// with an extra query (such as NetResolver) to determine it. Resolvers that observe the
+// chain while resolving always report it.
+func WithCNAMEChain(ctx context.Context, chain bool) context.Context {
+	return context.WithValue(ctx, cnameChainKey{}, chain)
+}
+
+// CNAMEChainFromContext reports whether the CNAME chain was requested with WithCNAMEChain.
+func CNAMEChainFromContext(ctx context.Context) bool {
+	chain, _ := ctx.Value(cnameChainKey{}).(bool)
+	return chain
+}
+
+// hostLookuper is the part of net.Resolver used by NetResolver.
+type hostLookuper interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
 }
 
 // NetResolver uses net.DefaultResolver to resolve hostnames.
-type NetResolver struct{}
+type NetResolver struct {
+	// lookup replaces net.DefaultResolver in tests.
+	lookup hostLookuper
+}
 
 // NewNetResolver returns a new NetResolver.
 func NewNetResolver() *NetResolver {
@@ -24,8 +75,13 @@ func NewNetResolver() *NetResolver {
 }
 
 // Resolve resolves a hostname to a sorted list of IP addresses in CIDR notation.
-func (r *NetResolver) Resolve(ctx context.Context, hostname string) ([]string, error) {
-	addrs, err := net.DefaultResolver.LookupHost(ctx, hostname)
+// The canonical name is only looked up if the context requests the CNAME chain.
+func (r *NetResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	var lookup hostLookuper = net.DefaultResolver
+	if r.lookup != nil {
+		lookup = r.lookup
+	}
+	addrs, err := lookup.LookupHost(ctx, hostname)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname, err)
 	}
@@ -38,19 +94,35 @@ func (r *NetResolver) Resolve(ctx context.Context, hostname string) ([]string, e
 		}
 	}
 
-	sort.Strings(cidrs)
-	return cidrs, nil
+	cidrs = dedupSorted(cidrs)
+	answer := &Answer{Addresses: cidrs, Resolver: "system"}
+
+	if !CNAMEChainFromContext(ctx) {
+		return answer, nil
+	}
+	// LookupHost hides aliases; LookupCNAME reveals the canonical name at the end of the chain.
+	canonical, err := lookup.LookupCNAME(ctx, hostname)
+	if err != nil {
+		answer.CNAMEChainError = fmt.Sprintf("failed to look up the canonical name: %v", err)
+		return answer, nil
+	}
+	canonical = strings.TrimSuffix(canonical, ".")
+	if !strings.EqualFold(canonical, strings.TrimSuffix(hostname, ".")) {
+		answer.CNAMEChain = []string{strings.ToLower(canonical)}
+	}
+	return answer, nil
 }
 
 // toCIDR converts an IP address string to CIDR notation.
-// Returns /32 for IPv4 and /128 for IPv6.
+// Returns /32 for IPv4 and IPv4-mapped IPv6 addresses, and /128 for other IPv6 addresses.
 func toCIDR(addr string) string {
-	ip := net.ParseIP(addr)
-	if ip == nil {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
 		return ""
 	}
-	if strings.Contains(addr, ":") {
-		return addr + "/128"
+	ip = ip.Unmap().WithZone("")
+	if ip.Is4() {
+		return ip.String() + "/32"
 	}
-	return addr + "/32"
+	return ip.String() + "/128"
 }
@@ -2,6 +2,8 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
 )
 
@@ -14,6 +16,8 @@ func TestToCIDR(t *testing.T) {
 		{name: "IPv4", addr: "1.2.3.4", want: "1.2.3.4/32"},
 		{name: "IPv6", addr: "::1", want: "::1/128"},
 		{name: "IPv6 full", addr: "2001:db8::1", want: "2001:db8::1/128"},
+		{name: "IPv4-mapped IPv6", addr: "::ffff:10.0.0.1", want: "10.0.0.1/32"},
+		{name: "IPv6 with zone", addr: "fe80::1%eth0", want: "fe80::1/128"},
 		{name: "invalid", addr: "not-an-ip", want: ""},
 	}
 
@@ -32,10 +36,11 @@ func TestNetResolver_Resolve(t *testing.T) {
 	ctx := context.Background()
 
 	// Resolve localhost - should always work
-	cidrs, err := r.Resolve(ctx, "localhost")
+	answer, err := r.Resolve(ctx, "localhost")
 	if err != nil {
 		t.Fatalf("Resolve(localhost) error: %v", err)
 	}
+	cidrs := answer.Addresses
 	if len(cidrs) == 0 {
 		t.Fatal("Resolve(localhost) returned no results")
 	}
@@ -65,3 +70,76 @@ func TestNetResolver_ResolveError(t *testing.T) {
 		t.Fatal("expected error for non-existent hostname")
 	}
 }
+
+// fakeLookuper resolves every host to 192.0.2.1, with the given canonical name or error.
+type fakeLookuper struct {
+	canonical    string
+	cnameErr     error
+	cnameLookups int
+}
+
+func (f *fakeLookuper) LookupHost(context.Context, string) ([]string, error) {
+	return []string{"192.0.2.1"}, nil
+}
+
+func (f *fakeLookuper) LookupCNAME(context.Context, string) (string, error) {
+	f.cnameLookups++
+	return f.canonical, f.cnameErr
+}
+
+func TestNetResolver_CNAMEChain(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     bool
+		lookup      *fakeLookuper
+		wantChain   []string
+		wantErr     bool
+		wantLookups int
+	}{
+		{
+			name:   "not requested",
+			lookup: &fakeLookuper{canonical: "edge.vendor-cdn.net."},
+		},
+		{
+			name:        "alias",
+			request:     true,
+			lookup:      &fakeLookuper{canonical: "Edge.Vendor-CDN.net."},
+			wantChain:   []string{"edge.vendor-cdn.net"},
+			wantLookups: 1,
+		},
+		{
+			name:        "canonical",
+			request:     true,
+			lookup:      &fakeLookuper{canonical: "api.vendor.com."},
+			wantLookups: 1,
+		},
+		{
+			name:        "failed lookup",
+			request:     true,
+			lookup:      &fakeLookuper{cnameErr: errors.New("i/o timeout")},
+			wantErr:     true,
+			wantLookups: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &NetResolver{lookup: tt.lookup}
+			answer, err := r.Resolve(WithCNAMEChain(context.Background(), tt.request), "api.vendor.com")
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !slices.Equal(answer.Addresses, []string{"192.0.2.1/32"}) {
+				t.Errorf("Resolve() addresses = %v", answer.Addresses)
+			}
+			if !slices.Equal(answer.CNAMEChain, tt.wantChain) {
+				t.Errorf("Resolve() chain = %v, want %v", answer.CNAMEChain, tt.wantChain)
+			}
+			if (answer.CNAMEChainError != "") != tt.wantErr {
+				t.Errorf("Resolve() CNAMEChainError = %q, wantErr %v", answer.CNAMEChainError, tt.wantErr)
+			}
+			if tt.lookup.cnameLookups != tt.wantLookups {
+				t.Errorf("LookupCNAME called %d times, want %d", tt.lookup.cnameLookups, tt.wantLookups)
+			}
+		})
+	}
+}
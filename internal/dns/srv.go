@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// SRVTarget is a single target of an SRV record set.
+type SRVTarget struct {
+	// Target is the hostname of the target, without the trailing dot.
+	Target string
+	// Port is the port the service is published on.
+	Port uint16
+	// Priority and Weight are carried over from the SRV record.
+	Priority uint16
+	Weight   uint16
+}
+
+// SRVResolver looks up SRV records. The targets are not resolved to addresses;
+// callers resolve them through a Resolver so that filtering applies.
+type SRVResolver interface {
+	// LookupSRV returns the targets of the SRV record set at name
+	// (e.g. "_ldap._tcp.corp.example"), sorted by target and port.
+	LookupSRV(ctx context.Context, name string) ([]SRVTarget, error)
+}
+
+// LookupSRV looks up the SRV record set at name using net.DefaultResolver.
+func (r *NetResolver) LookupSRV(ctx context.Context, name string) ([]SRVTarget, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV records for %q: %w", name, err)
+	}
+
+	targets := make([]SRVTarget, 0, len(records))
+	for _, rec := range records {
+		target := strings.TrimSuffix(rec.Target, ".")
+		// A target of "." means the service is decidedly not available at this domain.
+		if target == "" {
+			continue
+		}
+		targets = append(targets, SRVTarget{
+			Target:   target,
+			Port:     rec.Port,
+			Priority: rec.Priority,
+			Weight:   rec.Weight,
+		})
+	}
+	SortSRVTargets(targets)
+	return targets, nil
+}
+
+// SortSRVTargets sorts targets by target name and port.
+func SortSRVTargets(targets []SRVTarget) {
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Target != targets[j].Target {
+			return targets[i].Target < targets[j].Target
+		}
+		return targets[i].Port < targets[j].Port
+	})
+}
+
+// SRVProtocol returns the transport protocol label of an SRV name in upper case,
+// e.g. "TCP" for "_ldap._tcp.corp.example". It returns "" if name has no protocol label.
+func SRVProtocol(name string) string {
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimPrefix(labels[1], "_"))
+}
@@ -0,0 +1,45 @@
+package dns
+
+import "testing"
+
+func TestSRVProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "_ldap._tcp.corp.example", want: "TCP"},
+		{name: "_sip._udp.example.com", want: "UDP"},
+		{name: "_diameter._sctp.example.com", want: "SCTP"},
+		{name: "ldap.tcp.example.com", want: ""},
+		{name: "_ldap._tcp", want: ""},
+		{name: "example.com", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SRVProtocol(tt.name); got != tt.want {
+				t.Errorf("SRVProtocol(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortSRVTargets(t *testing.T) {
+	targets := []SRVTarget{
+		{Target: "b.example.com", Port: 389},
+		{Target: "a.example.com", Port: 636},
+		{Target: "a.example.com", Port: 389},
+	}
+	SortSRVTargets(targets)
+
+	want := []SRVTarget{
+		{Target: "a.example.com", Port: 389},
+		{Target: "a.example.com", Port: 636},
+		{Target: "b.example.com", Port: 389},
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("SortSRVTargets()[%d] = %v, want %v", i, targets[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestResolverChain_Spans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	upstream := funcResolver(func(_ context.Context, hostname string) (*Answer, error) {
+		if hostname == "missing.example.com" {
+			return nil, &net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true}
+		}
+		return &Answer{Addresses: []string{"192.0.2.1/32", "127.0.0.1/32"}}, nil
+	})
+	filter, err := NewIPFilter(nil, []string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &FilteringResolver{
+		Inner:  NewLimitingResolver(NewInstrumentedResolver(upstream, "test"), LimitOptions{}),
+		Filter: filter,
+		Logger: logr.Discard(),
+	}
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "Reconcile")
+	if _, err := resolver.Resolve(ctx, "api.example.com"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if _, err := resolver.Resolve(ctx, "missing.example.com"); err == nil {
+		t.Fatal("Resolve() error = nil, want error")
+	}
+	root.End()
+
+	spans := exporter.GetSpans()
+	byID := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		byID[s.SpanContext.SpanID().String()] = s
+	}
+	// Each lookup yields a chain of spans from the upstream query up to the root.
+	var chains [][]string
+	for _, s := range spans {
+		if s.Name != "dns.upstream" {
+			continue
+		}
+		var chain []string
+		for cur, ok := s, true; ok; cur, ok = byID[cur.Parent.SpanID().String()] {
+			chain = append(chain, cur.Name)
+		}
+		chains = append(chains, chain)
+
+		hostname := attr(s, "dns.hostname")
+		switch hostname {
+		case "api.example.com":
+			if s.Status.Code == codes.Error {
+				t.Errorf("span for %s has error status", hostname)
+			}
+		case "missing.example.com":
+			if s.Status.Code != codes.Error {
+				t.Errorf("span for %s status = %v, want error", hostname, s.Status.Code)
+			}
+			if got := attr(s, "dns.error_class"); got != ErrorClassNXDOMAIN {
+				t.Errorf("dns.error_class = %q, want %q", got, ErrorClassNXDOMAIN)
+			}
+		default:
+			t.Errorf("unexpected dns.hostname %q", hostname)
+		}
+		if got := attr(s, "dns.upstream"); got != "test" {
+			t.Errorf("dns.upstream = %q, want test", got)
+		}
+	}
+
+	if len(chains) != 2 {
+		t.Fatalf("got %d dns.upstream spans, want 2", len(chains))
+	}
+	for _, chain := range chains {
+		want := []string{"dns.upstream", "dns.limit", "dns.filter", "Reconcile"}
+		if len(chain) != len(want) {
+			t.Errorf("span chain = %v, want %v", chain, want)
+			continue
+		}
+		for i := range want {
+			if chain[i] != want[i] {
+				t.Errorf("span chain = %v, want %v", chain, want)
+				break
+			}
+		}
+	}
+
+	for _, s := range spans {
+		if s.Name == "dns.filter" && attr(s, "dns.hostname") == "api.example.com" {
+			if got := attrInt(s, "dns.filtered"); got != 1 {
+				t.Errorf("dns.filtered = %d, want 1", got)
+			}
+		}
+	}
+}
+
+func attr(s tracetest.SpanStub, key string) string {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func attrInt(s tracetest.SpanStub, key string) int64 {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.AsInt64()
+		}
+	}
+	return -1
+}
@@ -0,0 +1,386 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCNAMEDepth bounds the number of aliases followed for a single hostname.
+const maxCNAMEDepth = 8
+
+// ednsUDPSize is the UDP payload size advertised when requesting DNSSEC validation.
+const ednsUDPSize = 1232
+
+// defaultQueryTimeout bounds a single query when WireResolver.Timeout is unset.
+const defaultQueryTimeout = 5 * time.Second
+
+// WireResolver queries DNS servers directly instead of going through the system resolver,
+// so that it can report every alias in a hostname's CNAME chain. Hostnames are treated
+// as fully qualified; search domains do not apply.
+type WireResolver struct {
+	// Servers are the DNS servers to query as host:port, tried in order until one answers.
+	Servers []string
+	// Timeout bounds each query to a single server. Defaults to 5s.
+	Timeout time.Duration
+	// TLS, if set, sends queries over DNS over TLS (RFC 7858) instead of UDP and TCP.
+	// If its ServerName is empty, the server's host is verified.
+	TLS *tls.Config
+	// Limits, if set, applies to every query sent, including retries over TCP and queries
+	// to further servers.
+	Limits *Limiter
+
+	// dnssecOK asks servers to validate answers with DNSSEC and report the outcome in the
+	// AD bit of responses.
+	dnssecOK bool
+}
+
+// NewWireResolver returns a WireResolver that queries servers.
+func NewWireResolver(servers []string) *WireResolver {
+	return &WireResolver{Servers: servers}
+}
+
+// NewTLSConfig returns the TLS configuration to query DNS over TLS servers with. The servers'
+// certificates are verified for serverName, or for the address queried if it is empty, and
+// against the CA certificates in the PEM file caFile, or the system roots if it is empty.
+func NewTLSConfig(serverName, caFile string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DNS over TLS CA file: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+	}
+	return config, nil
+}
+
+// ServersFromResolvConf returns the nameservers listed in a resolv.conf file as host:port.
+func ServersFromResolvConf(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		addr, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		servers = append(servers, netip.AddrPortFrom(addr.WithZone(""), 53).String())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers found in %s", path)
+	}
+	return servers, nil
+}
+
+// Resolve resolves the A and AAAA records of hostname, following CNAMEs, to a sorted list
+// of IP addresses in CIDR notation. The aliases followed are returned in Answer.CNAMEChain.
+func (r *WireResolver) Resolve(ctx context.Context, hostname string) (*Answer, error) {
+	var cidrs, chain []string
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		addrs, c, _, err := r.lookup(ctx, hostname, qtype, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname, err)
+		}
+		cidrs = append(cidrs, addrs...)
+		if len(c) > len(chain) {
+			chain = c
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("failed to resolve hostname %q: %w", hostname,
+			&net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true})
+	}
+
+	cidrs = dedupSorted(cidrs)
+	return &Answer{Addresses: cidrs, Resolver: "wire", CNAMEChain: chain}, nil
+}
+
+// LookupSRV looks up the SRV record set at name.
+func (r *WireResolver) LookupSRV(ctx context.Context, name string) ([]SRVTarget, error) {
+	msg, err := r.exchange(ctx, fqdn(name), dnsmessage.TypeSRV, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV records for %q: %w", name, err)
+	}
+	if err := rcodeErr(name, msg.RCode); err != nil {
+		return nil, fmt.Errorf("failed to look up SRV records for %q: %w", name, err)
+	}
+
+	var targets []SRVTarget
+	for _, rr := range msg.Answers {
+		srv, ok := rr.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		target := strings.ToLower(strings.TrimSuffix(srv.Target.String(), "."))
+		// A target of "." means the service is decidedly not available at this domain.
+		if target == "" {
+			continue
+		}
+		targets = append(targets, SRVTarget{Target: target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+	SortSRVTargets(targets)
+	return targets, nil
+}
+
+// lookup resolves the records of qtype at hostname, following CNAMEs both within a response
+// and, when a response ends at an alias without records, by querying the alias.
+// It returns the addresses, the aliases followed and the responses they were read from.
+// checkingDisabled is passed on to exchange.
+func (r *WireResolver) lookup(
+	ctx context.Context, hostname string, qtype dnsmessage.Type, checkingDisabled bool,
+) ([]string, []string, []*dnsmessage.Message, error) {
+	var chain []string
+	var msgs []*dnsmessage.Message
+	name := fqdn(hostname)
+	for range maxCNAMEDepth {
+		msg, err := r.exchange(ctx, name, qtype, checkingDisabled)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if msg.RCode == dnsmessage.RCodeNameError {
+			return nil, chain, msgs, nil
+		}
+		if err := rcodeErr(hostname, msg.RCode); err != nil {
+			return nil, nil, nil, err
+		}
+		msgs = append(msgs, msg)
+
+		current := name
+		for followed := true; followed; {
+			followed = false
+			for _, rr := range msg.Answers {
+				cname, ok := rr.Body.(*dnsmessage.CNAMEResource)
+				if !ok || !strings.EqualFold(rr.Header.Name.String(), current) {
+					continue
+				}
+				current = strings.ToLower(cname.CNAME.String())
+				chain = append(chain, strings.TrimSuffix(current, "."))
+				if len(chain) > maxCNAMEDepth {
+					return nil, nil, nil, fmt.Errorf("CNAME chain of %q is longer than %d", hostname, maxCNAMEDepth)
+				}
+				followed = true
+			}
+		}
+
+		var addrs []string
+		for _, rr := range msg.Answers {
+			if !strings.EqualFold(rr.Header.Name.String(), current) {
+				continue
+			}
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, toCIDR(netip.AddrFrom4(body.A).String()))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, toCIDR(netip.AddrFrom16(body.AAAA).String()))
+			}
+		}
+		if len(addrs) > 0 || current == name {
+			return addrs, chain, msgs, nil
+		}
+		name = current
+	}
+	return nil, nil, nil, fmt.Errorf("CNAME chain of %q is longer than %d", hostname, maxCNAMEDepth)
+}
+
+// exchange sends a recursive query for name and qtype to each server in turn and returns the
+// first response. Truncated UDP responses are retried over TCP. When requesting DNSSEC
+// validation, checkingDisabled asks the server to return answers that fail it.
+func (r *WireResolver) exchange(
+	ctx context.Context, name string, qtype dnsmessage.Type, checkingDisabled bool,
+) (*dnsmessage.Message, error) {
+	if len(r.Servers) == 0 {
+		return nil, errors.New("no DNS servers configured")
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	question := dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}
+
+	header := dnsmessage.Header{RecursionDesired: true}
+	if r.dnssecOK {
+		header.AuthenticData = true
+		header.CheckingDisabled = checkingDisabled
+	}
+	network := "udp"
+	if r.TLS != nil {
+		network = "tcp-tls"
+	}
+
+	send := func(server, network string) (*dnsmessage.Message, error) {
+		return query(ctx, r.Limits, func(ctx context.Context) (*dnsmessage.Message, error) {
+			return r.exchangeWith(ctx, server, network, header, question)
+		})
+	}
+	var lastErr error
+	for _, server := range r.Servers {
+		msg, err := send(server, network)
+		if err == nil && msg.Truncated && network == "udp" {
+			msg, err = send(server, "tcp")
+		}
+		if err == nil {
+			return msg, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (r *WireResolver) exchangeWith(
+	ctx context.Context, server, network string, header dnsmessage.Header, question dnsmessage.Question,
+) (*dnsmessage.Message, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = defaultQueryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := r.dial(ctx, server, network)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	id := uint16(rand.Uint32())
+	header.ID = id
+	query := dnsmessage.Message{
+		Header:    header,
+		Questions: []dnsmessage.Question{question},
+	}
+	if r.dnssecOK {
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, true); err != nil {
+			return nil, err
+		}
+		query.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []byte
+	if network != "udp" {
+		resp, err = exchangeTCP(conn, packed)
+	} else {
+		resp, err = exchangeUDP(conn, packed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying %s over %s: %w", server, network, err)
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("parsing response from %s: %w", server, err)
+	}
+	if msg.ID != id || !msg.Response || len(msg.Questions) != 1 ||
+		!strings.EqualFold(msg.Questions[0].Name.String(), question.Name.String()) ||
+		msg.Questions[0].Type != question.Type {
+		return nil, fmt.Errorf("mismatched response from %s", server)
+	}
+	return &msg, nil
+}
+
+// dial connects to server over network, which is "udp", "tcp", or "tcp-tls" for DNS over TLS.
+func (r *WireResolver) dial(ctx context.Context, server, network string) (net.Conn, error) {
+	if network != "tcp-tls" {
+		var d net.Dialer
+		return d.DialContext(ctx, network, server)
+	}
+	config := r.TLS
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			return nil, err
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	d := tls.Dialer{Config: config}
+	return d.DialContext(ctx, "tcp", server)
+}
+
+func exchangeUDP(conn net.Conn, query []byte) ([]byte, error) {
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func exchangeTCP(conn net.Conn, query []byte) ([]byte, error) {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// rcodeErr converts an unsuccessful response code into an error.
+func rcodeErr(name string, rcode dnsmessage.RCode) error {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return nil
+	case dnsmessage.RCodeNameError:
+		return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return &net.DNSError{Err: "server misbehaving: " + rcode.String(), Name: name, IsTemporary: true}
+	}
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
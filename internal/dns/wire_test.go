@@ -0,0 +1,191 @@
+package dns_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+func TestWireResolver_Resolve(t *testing.T) {
+	// Enough A records to exceed 512 bytes and force a TCP retry.
+	var many []dnsmessage.Resource
+	var manyWant []string
+	for i := 1; i <= 40; i++ {
+		ip := fmt.Sprintf("10.1.0.%d", i)
+		many = append(many, dnstest.A("many.example.com", ip))
+		manyWant = append(manyWant, ip+"/32")
+	}
+	records := append(many,
+		dnstest.A("direct.example.com", "192.0.2.1"),
+		dnstest.AAAA("direct.example.com", "2001:db8::1"),
+		dnstest.CNAME("api.vendor.com", "api.vendor-cdn.net"),
+		dnstest.CNAME("api.vendor-cdn.net", "edge.tracker.example"),
+		dnstest.A("edge.tracker.example", "198.51.100.7"),
+		dnstest.CNAME("dangling.example.com", "nowhere.example.com"),
+	)
+	server, err := dnstest.NewServer(records...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	r := dns.NewWireResolver([]string{server.Addr})
+
+	tests := []struct {
+		name      string
+		hostname  string
+		want      []string
+		wantChain []string
+		wantErr   bool
+	}{
+		{
+			name:     "A and AAAA",
+			hostname: "direct.example.com",
+			want:     []string{"192.0.2.1/32", "2001:db8::1/128"},
+		},
+		{
+			name:      "CNAME chain",
+			hostname:  "api.vendor.com",
+			want:      []string{"198.51.100.7/32"},
+			wantChain: []string{"api.vendor-cdn.net", "edge.tracker.example"},
+		},
+		{
+			name:     "truncated response retried over TCP",
+			hostname: "many.example.com",
+			want:     manyWant,
+		},
+		{name: "NXDOMAIN", hostname: "missing.example.com", wantErr: true},
+		{name: "dangling CNAME", hostname: "dangling.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := r.Resolve(context.Background(), tt.hostname)
+			if tt.wantErr {
+				var dnsErr *net.DNSError
+				if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+					t.Fatalf("Resolve(%q) error = %v, want not found", tt.hostname, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error: %v", tt.hostname, err)
+			}
+			if len(tt.want) > 1 {
+				// Addresses are sorted as strings.
+				wantSorted := append([]string(nil), tt.want...)
+				sort.Strings(wantSorted)
+				tt.want = wantSorted
+			}
+			if !reflect.DeepEqual(answer.Addresses, tt.want) {
+				t.Errorf("Resolve(%q) = %v, want %v", tt.hostname, answer.Addresses, tt.want)
+			}
+			if !reflect.DeepEqual(answer.CNAMEChain, tt.wantChain) {
+				t.Errorf("Resolve(%q) chain = %v, want %v", tt.hostname, answer.CNAMEChain, tt.wantChain)
+			}
+		})
+	}
+}
+
+func TestWireResolver_LookupSRV(t *testing.T) {
+	server, err := dnstest.NewServer(
+		dnstest.SRV("_ldap._tcp.corp.example", "ldap2.corp.example", 389),
+		dnstest.SRV("_ldap._tcp.corp.example", "ldap1.corp.example", 389),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	targets, err := dns.NewWireResolver([]string{server.Addr}).LookupSRV(context.Background(), "_ldap._tcp.corp.example")
+	if err != nil {
+		t.Fatalf("LookupSRV() error: %v", err)
+	}
+	want := []dns.SRVTarget{{Target: "ldap1.corp.example", Port: 389}, {Target: "ldap2.corp.example", Port: 389}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("LookupSRV() = %v, want %v", targets, want)
+	}
+}
+
+func TestServersFromResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	content := "search default.svc.cluster.local\nnameserver 10.96.0.10\nnameserver fd00::10\noptions ndots:5\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := dns.ServersFromResolvConf(path)
+	if err != nil {
+		t.Fatalf("ServersFromResolvConf() error: %v", err)
+	}
+	if want := []string{"10.96.0.10:53", "[fd00::10]:53"}; !reflect.DeepEqual(servers, want) {
+		t.Errorf("ServersFromResolvConf() = %v, want %v", servers, want)
+	}
+}
+
+func TestWireResolver_Limits(t *testing.T) {
+	t.Run("every query takes a token", func(t *testing.T) {
+		server, err := dnstest.NewServer(
+			dnstest.A("direct.example.com", "192.0.2.1"),
+			dnstest.AAAA("direct.example.com", "2001:db8::1"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		r := dns.NewWireResolver([]string{server.Addr})
+		r.Limits = dns.NewLimiter(dns.LimitOptions{QPS: 20, Burst: 1})
+
+		start := time.Now()
+		for range 2 {
+			if _, err := r.Resolve(context.Background(), "direct.example.com"); err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+		}
+		// Two lookups send an A and an AAAA query each: the first uses the burst and the
+		// remaining three wait 50ms each.
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("4 queries at 20 QPS took %s, want at least 100ms", elapsed)
+		}
+	})
+
+	t.Run("every query is retried", func(t *testing.T) {
+		// A server that never answers.
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		var received atomic.Int32
+		go func() {
+			buf := make([]byte, 512)
+			for {
+				if _, _, err := conn.ReadFrom(buf); err != nil {
+					return
+				}
+				received.Add(1)
+			}
+		}()
+
+		r := dns.NewWireResolver([]string{conn.LocalAddr().String()})
+		r.Limits = dns.NewLimiter(dns.LimitOptions{Timeout: 20 * time.Millisecond, Retries: 2})
+		if _, err := r.LookupSRV(context.Background(), "_ldap._tcp.corp.example"); err == nil {
+			t.Fatal("LookupSRV() error = nil, want timeout")
+		}
+		if got := received.Load(); got != 3 {
+			t.Errorf("server received %d queries, want 3", got)
+		}
+	})
+}
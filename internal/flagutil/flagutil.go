@@ -0,0 +1,23 @@
+// Package flagutil contains flag.Value implementations shared by the operator binaries.
+package flagutil
+
+import "strings"
+
+// StringSlice implements flag.Value for comma-separated string slices.
+// The flag may be repeated; values accumulate.
+type StringSlice []string
+
+func (s *StringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set splits val on commas and appends the non-empty, trimmed parts.
+func (s *StringSlice) Set(val string) error {
+	for _, v := range strings.Split(val, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+// Defaults of PodProber.
+const (
+	DefaultImage   = "busybox:1.36"
+	DefaultTimeout = 2 * time.Minute
+)
+
+// probeContainer is the name of the container of probe pods.
+const probeContainer = "probe"
+
+// probeReadinessGate is a readiness gate of probe pods that nothing sets.
+const probeReadinessGate corev1.PodConditionType = "networking.ayoy.se/probe"
+
+// PodProber runs probes in a short-lived pod it creates, or in an existing pod through exec.
+type PodProber struct {
+	Clientset  kubernetes.Interface
+	RESTConfig *rest.Config
+	// Scheme is used to set the Owner of a Source as the controller of probe pods.
+	Scheme *runtime.Scheme
+	// Image is the image of probe pods. It must provide sh and nc. Defaults to DefaultImage.
+	Image string
+	// Timeout bounds a probe, including starting a probe pod. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+var _ Prober = &PodProber{}
+
+// Probe connects to targets from source.
+func (p *PodProber) Probe(ctx context.Context, source Source, targets []Target) ([]Result, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output string
+	var err error
+	if source.PodName != "" {
+		output, err = p.exec(ctx, source, script(targets))
+	} else {
+		output, err = p.run(ctx, source, script(targets), timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseOutput(targets, output), nil
+}
+
+// exec runs command in the existing pod of source and returns its output.
+func (p *PodProber) exec(ctx context.Context, source Source, command string) (string, error) {
+	pod, err := p.Clientset.CoreV1().Pods(source.Namespace).Get(ctx, source.PodName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get pod %s: %w", source.PodName, err)
+	}
+	if pod.Annotations[networkingv1alpha1.ProbeExecAnnotation] != "enabled" {
+		return "", fmt.Errorf("pod %s does not opt in to probes with annotation %s: enabled",
+			pod.Name, networkingv1alpha1.ProbeExecAnnotation)
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", fmt.Errorf("pod %s is %s, not Running", pod.Name, pod.Status.Phase)
+	}
+	if ok, err := selectorMatches(source.Selector, pod.Labels); err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("pod %s is not selected by the policy", pod.Name)
+	}
+
+	req := p.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(pod.Namespace).Name(pod.Name).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: source.Container,
+			Command:   []string{"sh", "-c", command},
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(p.RESTConfig, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to exec in pod %s: %w", pod.Name, err)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return "", fmt.Errorf("failed to exec in pod %s: %w (%s)", pod.Name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.String(), nil
+}
+
+// run creates a probe pod running command, waits for it to complete and returns its log.
+// The pod is deleted afterwards.
+func (p *PodProber) run(ctx context.Context, source Source, command string, timeout time.Duration) (string, error) {
+	podLabels, err := LabelsForSelector(source.Selector)
+	if err != nil {
+		return "", err
+	}
+	if source.Owner != nil {
+		podLabels[networkingv1alpha1.ProbeLabel] = source.Owner.GetName()
+	}
+	pod, err := p.Clientset.CoreV1().Pods(source.Namespace).Create(ctx, p.probePod(source, podLabels, command, timeout), metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create probe pod: %w", err)
+	}
+	logger := log.FromContext(ctx).WithValues("pod", pod.Name)
+	logger.V(1).Info("created probe pod")
+	defer func() {
+		// Deleted even if ctx is done, so that probe pods do not outlive the probe.
+		err := p.Clientset.CoreV1().Pods(pod.Namespace).Delete(context.WithoutCancel(ctx), pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: ptr.To[int64](0),
+		})
+		if err != nil {
+			logger.Error(err, "failed to delete probe pod")
+		}
+	}()
+
+	var phase corev1.PodPhase
+	err = wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		current, err := p.Clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phase = current.Status.Phase
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("probe pod %s did not complete (phase %s): %w", pod.Name, phase, err)
+	}
+	if phase == corev1.PodFailed {
+		return "", fmt.Errorf("probe pod %s failed", pod.Name)
+	}
+
+	output, err := p.Clientset.CoreV1().Pods(pod.Namespace).
+		GetLogs(pod.Name, &corev1.PodLogOptions{Container: probeContainer}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get log of probe pod %s: %w", pod.Name, err)
+	}
+	return string(output), nil
+}
+
+// probePod returns a minimal, unprivileged pod running command once.
+func (p *PodProber) probePod(source Source, podLabels map[string]string, command string, timeout time.Duration) *corev1.Pod {
+	image := p.Image
+	if image == "" {
+		image = DefaultImage
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "anp-probe-",
+			Namespace:    source.Namespace,
+			Labels:       podLabels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:         ptr.To(int64(timeout.Seconds())),
+			AutomountServiceAccountToken:  ptr.To(false),
+			EnableServiceLinks:            ptr.To(false),
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   ptr.To(true),
+				RunAsUser:      ptr.To[int64](65534),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			// The gate is never satisfied, so that Services selecting the same pods never route to the probe pod.
+			ReadinessGates: []corev1.PodReadinessGate{{ConditionType: probeReadinessGate}},
+			Containers: []corev1.Container{{
+				Name:    probeContainer,
+				Image:   image,
+				Command: []string{"sh", "-c", command},
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: ptr.To(false),
+					ReadOnlyRootFilesystem:   ptr.To(true),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("10m"),
+						corev1.ResourceMemory: resource.MustParse("16Mi"),
+					},
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi")},
+				},
+			}},
+		},
+	}
+	if source.Owner != nil && p.Scheme != nil {
+		// The owner reference only makes pods left behind by a crash garbage-collectable.
+		_ = controllerutil.SetControllerReference(source.Owner, pod, p.Scheme)
+	}
+	return pod
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package probe verifies that pods can open TCP connections to egress destinations.
+//
+// A Prober runs the connections from a pod subject to the pod's NetworkPolicies.
+// PodProber does so with a short-lived probe pod or in an existing pod; tests use a fake.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Target is a TCP destination to connect to.
+type Target struct {
+	Host string
+	Port int32
+}
+
+func (t Target) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// Result is the outcome of connecting to a Target.
+type Result struct {
+	Target    Target
+	Reachable bool
+}
+
+// Source describes the pod to probe from.
+type Source struct {
+	// Namespace is the namespace of the pod.
+	Namespace string
+	// Selector must select the pod.
+	Selector *metav1.LabelSelector
+	// PodName names an existing pod to probe from, in Container if set. The pod must have
+	// networkingv1alpha1.ProbeExecAnnotation set to "enabled". If empty, a probe pod is
+	// created with the labels returned by LabelsForSelector.
+	PodName   string
+	Container string
+	// Owner, if set, becomes the controller of a created probe pod.
+	Owner client.Object
+}
+
+// Prober connects to targets from a pod.
+type Prober interface {
+	// Probe returns a Result per target, or an error if the probe could not be run.
+	Probe(ctx context.Context, source Source, targets []Target) ([]Result, error)
+}
+
+// LabelsForSelector returns labels that selector matches, for a probe pod.
+// Keys required to exist get the value "probe".
+func LabelsForSelector(selector *metav1.LabelSelector) (map[string]string, error) {
+	podLabels := maps.Clone(selector.MatchLabels)
+	if podLabels == nil {
+		podLabels = make(map[string]string)
+	}
+	for _, expr := range selector.MatchExpressions {
+		if _, ok := podLabels[expr.Key]; ok {
+			continue
+		}
+		switch expr.Operator {
+		case metav1.LabelSelectorOpIn:
+			if len(expr.Values) > 0 {
+				podLabels[expr.Key] = expr.Values[0]
+			}
+		case metav1.LabelSelectorOpExists:
+			podLabels[expr.Key] = "probe"
+		}
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod selector: %w", err)
+	}
+	if !s.Matches(labels.Set(podLabels)) {
+		return nil, fmt.Errorf("no labels found that match pod selector %q", s)
+	}
+	return podLabels, nil
+}
+
+// script returns a shell script connecting to each target with nc, which prints a line
+// "ok HOST PORT" or "fail HOST PORT" per target.
+func script(targets []Target) string {
+	var b strings.Builder
+	b.WriteString(`probe() { if nc -w 3 "$1" "$2" </dev/null >/dev/null 2>&1; then echo "ok $1 $2"; else echo "fail $1 $2"; fi; }` + "\n")
+	for _, t := range targets {
+		fmt.Fprintf(&b, "probe %s %d\n", shellQuote(t.Host), t.Port)
+	}
+	return b.String()
+}
+
+// parseOutput returns a Result per target from the output of script. Targets missing
+// from the output are unreachable.
+func parseOutput(targets []Target, output string) []Result {
+	reachable := make(map[Target]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "ok" {
+			continue
+		}
+		port, err := strconv.ParseInt(fields[2], 10, 32)
+		if err == nil {
+			reachable[Target{Host: fields[1], Port: int32(port)}] = true
+		}
+	}
+	results := make([]Result, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, Result{Target: t, Reachable: reachable[t]})
+	}
+	return results
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// selectorMatches reports whether selector selects podLabels.
+func selectorMatches(selector *metav1.LabelSelector, podLabels map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid pod selector: %w", err)
+	}
+	return s.Matches(labels.Set(podLabels)), nil
+}
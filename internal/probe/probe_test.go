@@ -0,0 +1,146 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+func TestLabelsForSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector metav1.LabelSelector
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name: "empty selector",
+			want: map[string]string{},
+		},
+		{
+			name:     "match labels",
+			selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "checkout"}},
+			want:     map[string]string{"app": "checkout"},
+		},
+		{
+			name: "expressions",
+			selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "api"}},
+				{Key: "team", Operator: metav1.LabelSelectorOpExists},
+				{Key: "canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+				{Key: "env", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"prod"}},
+			}},
+			want: map[string]string{"tier": "web", "team": "probe"},
+		},
+		{
+			name: "contradicting requirements",
+			selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "checkout"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"checkout"}},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LabelsForSelector(&tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LabelsForSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("LabelsForSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScript(t *testing.T) {
+	got := script([]Target{{Host: "api.example.com", Port: 443}, {Host: "it's", Port: 80}})
+	for _, want := range []string{"probe 'api.example.com' 443\n", `probe 'it'\''s' 80` + "\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("script() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	targets := []Target{
+		{Host: "api.example.com", Port: 443},
+		{Host: "db.example.com", Port: 5432},
+		{Host: "missing.example.com", Port: 443},
+	}
+	output := "ok api.example.com 443\nfail db.example.com 5432\nnc: bad address\n"
+	var got []bool
+	for _, r := range parseOutput(targets, output) {
+		got = append(got, r.Reachable)
+	}
+	if want := []bool{true, false, false}; !slices.Equal(got, want) {
+		t.Errorf("parseOutput() reachable = %v, want %v", got, want)
+	}
+}
+
+func TestPodProber_ExecRequiresOptIn(t *testing.T) {
+	pod := func(name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "shop", Labels: map[string]string{"app": "web"}, Annotations: annotations,
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	prober := &PodProber{Clientset: fake.NewClientset(
+		pod("private", nil),
+		pod("disabled", map[string]string{networkingv1alpha1.ProbeExecAnnotation: "false"}),
+		pod("opted-in", map[string]string{networkingv1alpha1.ProbeExecAnnotation: "enabled"}),
+	)}
+	targets := []Target{{Host: "93.184.216.34", Port: 443}}
+
+	tests := []struct {
+		podName string
+		wantErr string
+	}{
+		{"private", "does not opt in"},
+		{"disabled", "does not opt in"},
+		// Gets past the opt-in check to the selector.
+		{"opted-in", "not selected by the policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.podName, func(t *testing.T) {
+			source := Source{
+				Namespace: "shop",
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+				PodName:   tt.podName,
+			}
+			_, err := prober.Probe(context.Background(), source, targets)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Probe() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// Merge combines standard NetworkPolicy specs selecting the same pods into one spec that
+// allows the union of the traffic they allow, which is what the specs enforce together.
+// The pod selector is taken from the first spec.
+//
+// A spec isolates the pods for each of its policy types, including ones it has no rules
+// for, so the merged spec has every policy type of any spec. Rules are kept in order, and
+// rules equal to an earlier one are dropped.
+func Merge(specs []networkingv1.NetworkPolicySpec) networkingv1.NetworkPolicySpec {
+	var merged networkingv1.NetworkPolicySpec
+	if len(specs) == 0 {
+		return merged
+	}
+	merged.PodSelector = *specs[0].PodSelector.DeepCopy()
+
+	var ingress, egress bool
+	for _, spec := range specs {
+		for _, t := range EffectivePolicyTypes(spec) {
+			ingress = ingress || t == networkingv1.PolicyTypeIngress
+			egress = egress || t == networkingv1.PolicyTypeEgress
+		}
+		for _, rule := range spec.Ingress {
+			if !slices.ContainsFunc(merged.Ingress, func(r networkingv1.NetworkPolicyIngressRule) bool {
+				return equality.Semantic.DeepEqual(r, rule)
+			}) {
+				merged.Ingress = append(merged.Ingress, *rule.DeepCopy())
+			}
+		}
+		for _, rule := range spec.Egress {
+			if !slices.ContainsFunc(merged.Egress, func(r networkingv1.NetworkPolicyEgressRule) bool {
+				return equality.Semantic.DeepEqual(r, rule)
+			}) {
+				merged.Egress = append(merged.Egress, *rule.DeepCopy())
+			}
+		}
+	}
+	if ingress {
+		merged.PolicyTypes = append(merged.PolicyTypes, networkingv1.PolicyTypeIngress)
+	}
+	if egress {
+		merged.PolicyTypes = append(merged.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return merged
+}
+
+// EffectivePolicyTypes returns the policy types of spec, defaulted as the API server does
+// if none are set: Ingress, and Egress if the spec has egress rules.
+func EffectivePolicyTypes(spec networkingv1.NetworkPolicySpec) []networkingv1.PolicyType {
+	if len(spec.PolicyTypes) > 0 {
+		return spec.PolicyTypes
+	}
+	types := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(spec.Egress) > 0 {
+		types = append(types, networkingv1.PolicyTypeEgress)
+	}
+	return types
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"slices"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMerge(t *testing.T) {
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "checkout"}}
+	egressTo := func(cidr string) networkingv1.NetworkPolicyEgressRule {
+		return networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}},
+		}
+	}
+	egressOnly := []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+
+	tests := []struct {
+		name      string
+		specs     []networkingv1.NetworkPolicySpec
+		wantTypes []networkingv1.PolicyType
+		wantCIDRs []string
+	}{
+		{
+			name:  "empty",
+			specs: nil,
+		},
+		{
+			name: "egress rules are combined in order",
+			specs: []networkingv1.NetworkPolicySpec{
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.1/32")}, PolicyTypes: egressOnly},
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.2/32")}, PolicyTypes: egressOnly},
+			},
+			wantTypes: egressOnly,
+			wantCIDRs: []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name: "duplicate rules are dropped",
+			specs: []networkingv1.NetworkPolicySpec{
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.1/32")}, PolicyTypes: egressOnly},
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.1/32")}, PolicyTypes: egressOnly},
+			},
+			wantTypes: egressOnly,
+			wantCIDRs: []string{"192.0.2.1/32"},
+		},
+		{
+			name: "policy types without rules are kept",
+			specs: []networkingv1.NetworkPolicySpec{
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.1/32")}, PolicyTypes: egressOnly},
+				{PodSelector: selector, PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}},
+			},
+			wantTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			wantCIDRs: []string{"192.0.2.1/32"},
+		},
+		{
+			name: "unset policy types are defaulted",
+			specs: []networkingv1.NetworkPolicySpec{
+				{PodSelector: selector, Egress: []networkingv1.NetworkPolicyEgressRule{egressTo("192.0.2.1/32")}},
+			},
+			wantTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			wantCIDRs: []string{"192.0.2.1/32"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := Merge(tt.specs)
+			if !slices.Equal(merged.PolicyTypes, tt.wantTypes) {
+				t.Errorf("PolicyTypes = %v, want %v", merged.PolicyTypes, tt.wantTypes)
+			}
+			var cidrs []string
+			for _, rule := range merged.Egress {
+				for _, peer := range rule.To {
+					cidrs = append(cidrs, peer.IPBlock.CIDR)
+				}
+			}
+			if !slices.Equal(cidrs, tt.wantCIDRs) {
+				t.Errorf("egress CIDRs = %v, want %v", cidrs, tt.wantCIDRs)
+			}
+			if len(tt.specs) > 0 && merged.PodSelector.MatchLabels["app"] != "checkout" {
+				t.Errorf("PodSelector = %v, want the selector of the specs", merged.PodSelector)
+			}
+		})
+	}
+}
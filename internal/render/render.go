@@ -0,0 +1,763 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render translates augmented NetworkPolicy specs into standard
+// networking.k8s.io/v1 NetworkPolicies.
+//
+// Resolution and rendering are separate steps: Resolve performs the DNS lookups,
+// and Render is a pure, deterministic function of a spec and its resolutions.
+// The controller, the anp-render CLI and tests all share this package.
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/tracing"
+)
+
+// Resolution is the outcome of resolving a single hostname or SRV name.
+type Resolution struct {
+	// Answer holds the resolved (and filtered) addresses when Err is nil.
+	dns.Answer
+	// SRV holds the discovered targets when the resolution is for an SRV name.
+	// Each target is resolved separately and has its own entry in Resolutions.
+	SRV []dns.SRVTarget
+	// Err is set when the name could not be resolved.
+	Err error
+}
+
+// Resolutions maps hostnames and SRV names to their resolution outcome.
+type Resolutions map[string]Resolution
+
+// Addresses returns the resolved addresses of every successfully resolved hostname.
+func (r Resolutions) Addresses() map[string][]string {
+	addrs := make(map[string][]string, len(r))
+	for hostname, res := range r {
+		if res.Err == nil && res.SRV == nil {
+			addrs[hostname] = res.Addresses
+		}
+	}
+	return addrs
+}
+
+// FromStatus reconstructs the resolutions recorded in the per-hostname detail of status,
+// so a policy can be re-rendered without resolving its hostnames again.
+func FromStatus(status *networkingv1alpha1.NetworkPolicyStatus) Resolutions {
+	resolutions := make(Resolutions)
+	for _, rule := range status.Rules {
+		for _, h := range rule.Hostnames {
+			if h.LastError != "" {
+				resolutions[h.Hostname] = Resolution{Err: errors.New(h.LastError)}
+				continue
+			}
+			if !h.SRV {
+				resolutions[h.Hostname] = Resolution{Answer: dns.Answer{
+					Addresses:       h.Addresses,
+					Filtered:        h.FilteredAddresses,
+					Resolver:        h.Resolver,
+					CNAMEChain:      h.CNAMEChain,
+					DroppedFamilies: toIPFamilies(h.DroppedFamilies),
+					DNSSEC:          dns.DNSSECResult(h.DNSSEC),
+					Quarantine:      h.Quarantine,
+				}}
+				continue
+			}
+
+			targets := make([]dns.SRVTarget, 0, len(h.Targets))
+			for _, t := range h.Targets {
+				targets = append(targets, dns.SRVTarget{Target: t.Target, Port: uint16(t.Port)})
+				if t.LastError != "" {
+					resolutions[t.Target] = Resolution{Err: errors.New(t.LastError)}
+					continue
+				}
+				resolutions[t.Target] = Resolution{Answer: dns.Answer{
+					Addresses:  t.Addresses,
+					Filtered:   t.FilteredAddresses,
+					Resolver:   h.Resolver,
+					DNSSEC:     dns.DNSSECResult(t.DNSSEC),
+					Quarantine: t.Quarantine,
+				}}
+			}
+			resolutions[h.Hostname] = Resolution{Answer: dns.Answer{Resolver: h.Resolver}, SRV: targets}
+		}
+	}
+	return resolutions
+}
+
+func toIPFamilies(families []corev1.IPFamily) []dns.IPFamily {
+	var out []dns.IPFamily
+	for _, family := range families {
+		out = append(out, dns.IPFamily(family))
+	}
+	return out
+}
+
+// PeerName returns the DNS name an egress peer refers to: its hostname or its SRV name.
+func PeerName(peer networkingv1alpha1.EgressPeer) string {
+	if peer.SRV != "" {
+		return peer.SRV
+	}
+	return peer.Hostname
+}
+
+// Hostnames returns every hostname and SRV name referenced by the egress rules of spec,
+// deduplicated, in order of first appearance. Reference peers are skipped; see IsReference.
+func Hostnames(spec *networkingv1alpha1.NetworkPolicySpec) []string {
+	seen := make(map[string]bool)
+	var hostnames []string
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			if IsReference(to) {
+				continue
+			}
+			name := PeerName(to)
+			if !seen[name] {
+				seen[name] = true
+				hostnames = append(hostnames, name)
+			}
+		}
+	}
+	return hostnames
+}
+
+// IsReference reports whether peer takes its hostnames from another object, a hostname
+// set or a Service. Reference peers are not resolved and yield no addresses until they are
+// expanded with ExpandHostnameSets or ExpandServiceRefs.
+func IsReference(peer networkingv1alpha1.EgressPeer) bool {
+	return peer.HostnameSetRef != nil || peer.ServiceRef != nil
+}
+
+// HostnameSetRefs returns the hostname sets referenced by the egress rules of spec,
+// deduplicated, in order of first appearance. An empty kind is returned as HostnameSet.
+func HostnameSetRefs(spec *networkingv1alpha1.NetworkPolicySpec) []networkingv1alpha1.HostnameSetReference {
+	seen := make(map[networkingv1alpha1.HostnameSetReference]bool)
+	var refs []networkingv1alpha1.HostnameSetReference
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			if to.HostnameSetRef == nil {
+				continue
+			}
+			ref := normalizeSetRef(*to.HostnameSetRef)
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// ServiceRefs returns the names of the Services referenced by the egress rules of spec,
+// deduplicated, in order of first appearance.
+func ServiceRefs(spec *networkingv1alpha1.NetworkPolicySpec) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			if to.ServiceRef != nil && !seen[to.ServiceRef.Name] {
+				seen[to.ServiceRef.Name] = true
+				names = append(names, to.ServiceRef.Name)
+			}
+		}
+	}
+	return names
+}
+
+// ExpandHostnameSets returns spec with every peer referencing one of sets replaced by one
+// hostname peer per hostname in the set, each with the other settings of the referencing
+// peer. Peers referencing a set that is missing from sets or empty are kept and yield no
+// addresses, so that a rule whose sets are all missing is dropped rather than allowing
+// every destination.
+// spec is returned unmodified if it references no sets.
+func ExpandHostnameSets(
+	spec *networkingv1alpha1.NetworkPolicySpec, sets map[networkingv1alpha1.HostnameSetReference][]string,
+) *networkingv1alpha1.NetworkPolicySpec {
+	return expandPeers(spec, func(peer networkingv1alpha1.EgressPeer) []string {
+		if peer.HostnameSetRef == nil {
+			return nil
+		}
+		return sets[normalizeSetRef(*peer.HostnameSetRef)]
+	})
+}
+
+// ExpandServiceRefs returns spec with every peer referencing one of the Services in
+// externalNames replaced by a hostname peer for the Service's external name, with the other
+// settings of the referencing peer. Like with ExpandHostnameSets, peers referencing other
+// Services are kept and yield no addresses.
+// spec is returned unmodified if it references no Services.
+func ExpandServiceRefs(
+	spec *networkingv1alpha1.NetworkPolicySpec, externalNames map[string]string,
+) *networkingv1alpha1.NetworkPolicySpec {
+	return expandPeers(spec, func(peer networkingv1alpha1.EgressPeer) []string {
+		if peer.ServiceRef == nil || externalNames[peer.ServiceRef.Name] == "" {
+			return nil
+		}
+		return []string{externalNames[peer.ServiceRef.Name]}
+	})
+}
+
+// expandPeers replaces every peer for which hostnames returns names with one hostname
+// peer per name. spec is returned unmodified if no peer is replaced.
+func expandPeers(
+	spec *networkingv1alpha1.NetworkPolicySpec, hostnames func(networkingv1alpha1.EgressPeer) []string,
+) *networkingv1alpha1.NetworkPolicySpec {
+	out := spec
+	for i, rule := range spec.Egress {
+		var to []networkingv1alpha1.EgressPeer
+		replaced := false
+		for _, peer := range rule.To {
+			names := hostnames(peer)
+			if len(names) == 0 {
+				to = append(to, *peer.DeepCopy())
+				continue
+			}
+			replaced = true
+			for _, name := range names {
+				expanded := *peer.DeepCopy()
+				expanded.HostnameSetRef = nil
+				expanded.ServiceRef = nil
+				expanded.Hostname = name
+				to = append(to, expanded)
+			}
+		}
+		if !replaced {
+			continue
+		}
+		if out == spec {
+			out = spec.DeepCopy()
+		}
+		out.Egress[i].To = to
+	}
+	return out
+}
+
+func normalizeSetRef(ref networkingv1alpha1.HostnameSetReference) networkingv1alpha1.HostnameSetReference {
+	if ref.Kind == "" {
+		ref.Kind = networkingv1alpha1.HostnameSetKind
+	}
+	return ref
+}
+
+// Resolve resolves every hostname referenced by spec, once per hostname.
+// SRV names are looked up with srv and each of their targets is resolved with resolver;
+// if srv is nil, SRV peers fail to resolve.
+//
+// Each hostname is resolved for the union of the IP families of the peers referencing it
+// (see dns.WithIPFamilies); Render narrows the addresses down further per peer. Hostnames
+// referenced by a peer with DNSSEC enabled are validated (see dns.WithDNSSEC).
+// Reference peers are not resolved; see IsReference.
+func Resolve(
+	ctx context.Context, resolver dns.Resolver, srv dns.SRVResolver, spec *networkingv1alpha1.NetworkPolicySpec,
+) Resolutions {
+	families := make(map[string]map[dns.IPFamily]bool)
+	validate := make(map[string]bool)
+	chain := make(map[string]bool)
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			if IsReference(to) {
+				continue
+			}
+			addFamilies(families, PeerName(to), PeerIPFamilies(rule, to))
+			if to.DNSSEC != "" && to.DNSSEC != networkingv1alpha1.DNSSECModeOff {
+				validate[PeerName(to)] = true
+			}
+			if len(to.AllowedCNAMESuffixes) > 0 {
+				chain[PeerName(to)] = true
+			}
+		}
+	}
+
+	// SRV records are looked up first so that their targets resolve alongside the hostnames.
+	var hostnames, srvNames []string
+	seen := make(map[string]bool)
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			name := PeerName(to)
+			if IsReference(to) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if to.SRV == "" {
+				hostnames = append(hostnames, name)
+			} else {
+				srvNames = append(srvNames, name)
+			}
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "render.Resolve", trace.WithAttributes(
+		attribute.Int("render.hostnames", len(hostnames)),
+		attribute.Int("render.srv_records", len(srvNames)),
+	))
+	defer span.End()
+
+	resolutions := make(Resolutions, len(hostnames)+len(srvNames))
+	srvResults := parallel(srvNames, func(name string) Resolution {
+		if srv == nil {
+			return Resolution{Err: errors.New("SRV lookups are not supported by the configured resolver")}
+		}
+		targets, err := srv.LookupSRV(ctx, name)
+		if err != nil {
+			return Resolution{Err: err}
+		}
+		if targets == nil {
+			targets = []dns.SRVTarget{}
+		}
+		return Resolution{SRV: targets}
+	})
+	for i, name := range srvNames {
+		resolutions[name] = srvResults[i]
+		for _, target := range srvResults[i].SRV {
+			addFamilies(families, target.Target, familyList(families[name]))
+			validate[target.Target] = validate[target.Target] || validate[name]
+			if !seen[target.Target] {
+				seen[target.Target] = true
+				hostnames = append(hostnames, target.Target)
+			}
+		}
+	}
+
+	results := parallel(hostnames, func(hostname string) Resolution {
+		rctx := dns.WithDNSSEC(dns.WithIPFamilies(ctx, familyList(families[hostname])), validate[hostname])
+		rctx = dns.WithCNAMEChain(rctx, chain[hostname])
+		answer, err := resolver.Resolve(rctx, hostname)
+		if err != nil {
+			return Resolution{Err: err}
+		}
+		return Resolution{Answer: *answer}
+	})
+	for i, hostname := range hostnames {
+		resolutions[hostname] = results[i]
+	}
+	return resolutions
+}
+
+// maxParallelLookups bounds the lookups a single Resolve runs at once, so that callers
+// without a LimitingResolver, such as the anp-render CLI, do not send them all at once.
+const maxParallelLookups = 16
+
+// parallel calls fn for every name, at most maxParallelLookups at a time, and returns the
+// results in order.
+func parallel(names []string, fn func(string) Resolution) []Resolution {
+	results := make([]Resolution, len(names))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(len(names), maxParallelLookups) {
+		wg.Go(func() {
+			for i := range next {
+				results[i] = fn(names[i])
+			}
+		})
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// PeerIPFamilies returns the IP families a peer is restricted to: its own, or else its rule's.
+// It returns nil if the peer allows every family.
+func PeerIPFamilies(rule networkingv1alpha1.EgressRule, peer networkingv1alpha1.EgressPeer) []dns.IPFamily {
+	families := peer.IPFamilies
+	if len(families) == 0 {
+		families = rule.IPFamilies
+	}
+	if len(families) == 0 {
+		return nil
+	}
+	return dns.SortIPFamilies(toIPFamilies(families))
+}
+
+// PeerAnswer narrows a resolved answer down to the given IP families, adding the families
+// of the removed addresses to DroppedFamilies.
+func PeerAnswer(answer dns.Answer, families []dns.IPFamily) dns.Answer {
+	addresses, dropped := dns.FilterFamilies(answer.Addresses, families)
+	filtered, droppedFiltered := dns.FilterFamilies(answer.Filtered, families)
+	all := slices.Concat(answer.DroppedFamilies, dropped, droppedFiltered)
+	answer.Addresses = addresses
+	answer.Filtered = filtered
+	answer.DroppedFamilies = nil
+	for _, family := range dns.AllIPFamilies {
+		if slices.Contains(all, family) {
+			answer.DroppedFamilies = append(answer.DroppedFamilies, family)
+		}
+	}
+	return answer
+}
+
+// WithDefaultIPFamilies returns spec with families set on every egress rule that does not
+// restrict its IP families itself. spec is returned unmodified if families is empty.
+func WithDefaultIPFamilies(
+	spec *networkingv1alpha1.NetworkPolicySpec, families []dns.IPFamily,
+) *networkingv1alpha1.NetworkPolicySpec {
+	if len(families) == 0 {
+		return spec
+	}
+	out := spec.DeepCopy()
+	for i := range out.Egress {
+		if len(out.Egress[i].IPFamilies) > 0 {
+			continue
+		}
+		for _, family := range families {
+			out.Egress[i].IPFamilies = append(out.Egress[i].IPFamilies, corev1.IPFamily(family))
+		}
+	}
+	return out
+}
+
+// addFamilies adds families to the set wanted for name; nil families adds every family.
+func addFamilies(sets map[string]map[dns.IPFamily]bool, name string, families []dns.IPFamily) {
+	if families == nil {
+		families = dns.AllIPFamilies
+	}
+	if sets[name] == nil {
+		sets[name] = make(map[dns.IPFamily]bool)
+	}
+	for _, family := range families {
+		sets[name][family] = true
+	}
+}
+
+// familyList returns the families in set in order, or nil if set holds every family.
+func familyList(set map[dns.IPFamily]bool) []dns.IPFamily {
+	if len(set) == 0 || len(set) == len(dns.AllIPFamilies) {
+		return nil
+	}
+	var families []dns.IPFamily
+	for _, family := range dns.AllIPFamilies {
+		if set[family] {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// Report describes the outcome of rendering a spec.
+type Report struct {
+	// Errors holds one error per referenced hostname, SRV name or SRV target that
+	// failed to resolve, in order of first appearance in the spec.
+	Errors []error
+	// DroppedRules holds the indices of egress rules that were omitted because
+	// none of their peers yielded an address. Rendering such a rule without
+	// peers would allow egress to every destination.
+	DroppedRules []int
+	// AddressCount is the number of distinct addresses in the rendered policy.
+	AddressCount int
+}
+
+// Render translates spec into a standard NetworkPolicy using previously computed resolutions.
+// Hostnames missing from resolutions are treated as unresolved.
+//
+// Hostname peers of an egress rule render into one rule with the rule's ports. SRV peers
+// render into one additional rule per discovered protocol and port, ordered by port.
+// Each peer only contributes addresses of its IP families (see PeerIPFamilies).
+//
+// The output is deterministic: peers within a rule are deduplicated and sorted by CIDR,
+// and ports are deduplicated and sorted by protocol, port and end port.
+// The returned NetworkPolicy carries no metadata; callers set name, namespace and owners.
+func Render(spec *networkingv1alpha1.NetworkPolicySpec, resolutions Resolutions) (*networkingv1.NetworkPolicy, Report) {
+	var report Report
+	reported := make(map[string]bool)
+	reportErr := func(hostname string, err error) {
+		if !reported[hostname] {
+			reported[hostname] = true
+			report.Errors = append(report.Errors, err)
+		}
+	}
+	for _, name := range Hostnames(spec) {
+		res, ok := resolutions[name]
+		switch {
+		case !ok:
+			reportErr(name, fmt.Errorf("hostname %q was not resolved", name))
+		case res.Err != nil:
+			reportErr(name, fmt.Errorf("failed to resolve %q: %w", name, res.Err))
+		}
+		for _, target := range res.SRV {
+			if tres, ok := resolutions[target.Target]; !ok || tres.Err != nil {
+				reportErr(target.Target, fmt.Errorf("failed to resolve SRV target %q of %q: %w",
+					target.Target, name, targetErr(tres, ok)))
+			}
+		}
+	}
+	for _, rule := range spec.Egress {
+		for _, to := range rule.To {
+			if res, ok := resolutions[to.Hostname]; ok && res.Err == nil && to.SRV == "" {
+				if err := CheckPeer(to, res.Answer); err != nil {
+					reportErr(fmt.Sprintf("%s %v %s", to.Hostname, to.AllowedCNAMESuffixes, to.DNSSEC), err)
+				}
+			}
+			for _, target := range resolutions[to.SRV].SRV {
+				if tres, ok := resolutions[target.Target]; ok && tres.Err == nil {
+					if err := CheckDNSSEC(to, target.Target, tres.Answer); err != nil {
+						reportErr(fmt.Sprintf("%s %s", target.Target, to.DNSSEC), err)
+					}
+				}
+			}
+		}
+	}
+
+	addresses := make(map[string]bool)
+	var egressRules []networkingv1.NetworkPolicyEgressRule
+	for i, rule := range spec.Egress {
+		var hostnamePeers []networkingv1alpha1.EgressPeer
+		var srvPeers []networkingv1alpha1.EgressPeer
+		for _, to := range rule.To {
+			if to.SRV != "" {
+				srvPeers = append(srvPeers, to)
+			} else {
+				hostnamePeers = append(hostnamePeers, to)
+			}
+		}
+
+		var rendered []networkingv1.NetworkPolicyEgressRule
+		if peers := renderPeers(rule, hostnamePeers, resolutions); len(peers) > 0 || len(rule.To) == 0 {
+			rendered = append(rendered, networkingv1.NetworkPolicyEgressRule{
+				Ports: renderPorts(rule.Ports),
+				To:    peers,
+			})
+		}
+		rendered = append(rendered, renderSRVRules(rule, srvPeers, resolutions)...)
+
+		if len(rendered) == 0 {
+			report.DroppedRules = append(report.DroppedRules, i)
+			continue
+		}
+		for _, r := range rendered {
+			for _, peer := range r.To {
+				addresses[peer.IPBlock.CIDR] = true
+			}
+		}
+		egressRules = append(egressRules, rendered...)
+	}
+	report.AddressCount = len(addresses)
+
+	return &networkingv1.NetworkPolicy{
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *spec.PodSelector.DeepCopy(),
+			Egress:      egressRules,
+			PolicyTypes: append([]networkingv1.PolicyType(nil), spec.PolicyTypes...),
+		},
+	}, report
+}
+
+// CheckPeer returns an error if the resolved answer for a hostname peer may not be used
+// by the peer, because of its CNAME chain or its DNSSEC validation result.
+func CheckPeer(peer networkingv1alpha1.EgressPeer, answer dns.Answer) error {
+	if len(peer.AllowedCNAMESuffixes) > 0 && answer.CNAMEChainError != "" {
+		return fmt.Errorf("CNAME chain of %q is unknown, so allowedCNAMESuffixes cannot be checked: %s",
+			peer.Hostname, answer.CNAMEChainError)
+	}
+	if err := CheckCNAMEChain(peer, answer.CNAMEChain); err != nil {
+		return err
+	}
+	return CheckDNSSEC(peer, peer.Hostname, answer)
+}
+
+// CheckDNSSEC returns an error if the DNSSEC validation result of the answer for hostname
+// does not satisfy the peer's DNSSEC mode.
+func CheckDNSSEC(peer networkingv1alpha1.EgressPeer, hostname string, answer dns.Answer) error {
+	switch peer.DNSSEC {
+	case networkingv1alpha1.DNSSECModeRequire:
+		if answer.DNSSEC == "" {
+			return fmt.Errorf("DNSSEC is required for %q but the resolver does not validate", hostname)
+		}
+		if answer.DNSSEC != dns.DNSSECSecure {
+			return fmt.Errorf("DNSSEC is required for %q but the answer is %s: %s",
+				hostname, answer.DNSSEC, answer.DNSSECReason)
+		}
+	case networkingv1alpha1.DNSSECModePrefer:
+		if answer.DNSSEC == dns.DNSSECBogus {
+			return fmt.Errorf("DNSSEC validation failed for %q: %s", hostname, answer.DNSSECReason)
+		}
+	}
+	return nil
+}
+
+// CheckCNAMEChain returns an error if chain leaves the domains allowed by the
+// peer's AllowedCNAMESuffixes. Peers without allowed suffixes accept any chain.
+func CheckCNAMEChain(peer networkingv1alpha1.EgressPeer, chain []string) error {
+	if len(peer.AllowedCNAMESuffixes) == 0 {
+		return nil
+	}
+	for _, name := range chain {
+		if !hasAllowedSuffix(name, peer.AllowedCNAMESuffixes) {
+			return fmt.Errorf("CNAME chain of %q leaves the allowed domains at %q (chain: %s)",
+				peer.Hostname, name, strings.Join(chain, " -> "))
+		}
+	}
+	return nil
+}
+
+func hasAllowedSuffix(name string, suffixes []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.TrimSuffix(suffix, "."))
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func targetErr(res Resolution, ok bool) error {
+	if !ok {
+		return errors.New("not resolved")
+	}
+	return res.Err
+}
+
+func renderPeers(
+	rule networkingv1alpha1.EgressRule, to []networkingv1alpha1.EgressPeer, resolutions Resolutions,
+) []networkingv1.NetworkPolicyPeer {
+	var cidrs []string
+	for _, peer := range to {
+		res := resolutions[peer.Hostname]
+		if res.Err != nil || CheckPeer(peer, res.Answer) != nil {
+			continue
+		}
+		cidrs = append(cidrs, PeerAnswer(res.Answer, PeerIPFamilies(rule, peer)).Addresses...)
+	}
+	return ipBlockPeers(cidrs)
+}
+
+// renderSRVRules renders one rule per protocol and port discovered for the given SRV peers.
+func renderSRVRules(
+	rule networkingv1alpha1.EgressRule, srvPeers []networkingv1alpha1.EgressPeer, resolutions Resolutions,
+) []networkingv1.NetworkPolicyEgressRule {
+	byPort := make(map[string][]string)
+	portsByKey := make(map[string]networkingv1.NetworkPolicyPort)
+	for _, peer := range srvPeers {
+		res := resolutions[peer.SRV]
+		if res.Err != nil {
+			continue
+		}
+		protocol := corev1.Protocol(dns.SRVProtocol(peer.SRV))
+		families := PeerIPFamilies(rule, peer)
+		for _, target := range res.SRV {
+			tres := resolutions[target.Target]
+			if tres.Err != nil || CheckDNSSEC(peer, target.Target, tres.Answer) != nil {
+				continue
+			}
+			addresses := PeerAnswer(tres.Answer, families).Addresses
+			if len(addresses) == 0 {
+				continue
+			}
+			port := intstr.FromInt32(int32(target.Port))
+			np := networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+			key := portKey(np)
+			portsByKey[key] = np
+			byPort[key] = append(byPort[key], addresses...)
+		}
+	}
+
+	keys := make([]string, 0, len(byPort))
+	for key := range byPort {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rules := make([]networkingv1.NetworkPolicyEgressRule, 0, len(keys))
+	for _, key := range keys {
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{portsByKey[key]},
+			To:    ipBlockPeers(byPort[key]),
+		})
+	}
+	return rules
+}
+
+// ipBlockPeers returns one IPBlock peer per distinct CIDR, sorted.
+func ipBlockPeers(cidrs []string) []networkingv1.NetworkPolicyPeer {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, cidr := range cidrs {
+		if !seen[cidr] {
+			seen[cidr] = true
+			unique = append(unique, cidr)
+		}
+	}
+	sort.Strings(unique)
+
+	var peers []networkingv1.NetworkPolicyPeer
+	for _, cidr := range unique {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{
+				CIDR: cidr,
+			},
+		})
+	}
+	return peers
+}
+
+func renderPorts(in []networkingv1alpha1.NetworkPolicyPort) []networkingv1.NetworkPolicyPort {
+	seen := make(map[string]bool)
+	var ports []networkingv1.NetworkPolicyPort
+	for _, p := range in {
+		port := networkingv1.NetworkPolicyPort{
+			Protocol: p.Protocol,
+			Port:     p.Port,
+			EndPort:  p.EndPort,
+		}
+		key := portKey(port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ports = append(ports, *port.DeepCopy())
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		return portKey(ports[i]) < portKey(ports[j])
+	})
+	return ports
+}
+
+// portKey returns a sortable key identifying a port by protocol, port and end port.
+// Numeric ports sort before named ports and in numeric order.
+func portKey(p networkingv1.NetworkPolicyPort) string {
+	proto := ""
+	if p.Protocol != nil {
+		proto = string(*p.Protocol)
+	}
+	port := ""
+	if p.Port != nil {
+		if p.Port.Type == intstr.String {
+			port = "~" + p.Port.StrVal
+		} else {
+			port = fmt.Sprintf("%05d", p.Port.IntVal)
+		}
+	}
+	endPort := ""
+	if p.EndPort != nil {
+		endPort = fmt.Sprintf("%05d", *p.EndPort)
+	}
+	return proto + "/" + port + "/" + endPort
+}
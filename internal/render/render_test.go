@@ -0,0 +1,619 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/dns/dnstest"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// golden is the serialized form compared against testdata/*.golden.
+type golden struct {
+	Spec         networkingv1.NetworkPolicySpec `json:"spec"`
+	Errors       []string                       `json:"errors,omitempty"`
+	DroppedRules []int                          `json:"droppedRules,omitempty"`
+	AddressCount int                            `json:"addressCount"`
+}
+
+func TestRender_Golden(t *testing.T) {
+	hosts, err := os.Open(filepath.Join("testdata", "hosts"))
+	if err != nil {
+		t.Fatalf("opening hosts fixture: %v", err)
+	}
+	defer func() { _ = hosts.Close() }()
+	resolver, err := dns.NewHostsResolver(hosts)
+	if err != nil {
+		t.Fatalf("NewHostsResolver() error: %v", err)
+	}
+
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden test inputs found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var anp networkingv1alpha1.NetworkPolicy
+			if err := yaml.UnmarshalStrict(data, &anp); err != nil {
+				t.Fatalf("decoding %s: %v", input, err)
+			}
+
+			np, report := Render(&anp.Spec, Resolve(context.Background(), resolver, nil, &anp.Spec))
+
+			out := golden{
+				Spec:         np.Spec,
+				DroppedRules: report.DroppedRules,
+				AddressCount: report.AddressCount,
+			}
+			for _, err := range report.Errors {
+				out.Errors = append(out.Errors, err.Error())
+			}
+			got, err := yaml.Marshal(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Render() output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", input, got, want)
+			}
+		})
+	}
+}
+
+func TestRender_Deterministic(t *testing.T) {
+	spec := func(hostnames ...string) *networkingv1alpha1.NetworkPolicySpec {
+		var to []networkingv1alpha1.EgressPeer
+		for _, h := range hostnames {
+			to = append(to, networkingv1alpha1.EgressPeer{Hostname: h})
+		}
+		return &networkingv1alpha1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			Egress:      []networkingv1alpha1.EgressRule{{To: to}},
+		}
+	}
+	resolutions := Resolutions{
+		"a.example.com": {Answer: dns.Answer{Addresses: []string{"10.0.0.2/32", "10.0.0.1/32"}}},
+		"b.example.com": {Answer: dns.Answer{Addresses: []string{"10.0.0.3/32", "10.0.0.1/32"}}},
+	}
+
+	first, _ := Render(spec("a.example.com", "b.example.com"), resolutions)
+	second, _ := Render(spec("b.example.com", "a.example.com"), resolutions)
+	if !equality.Semantic.DeepEqual(first.Spec, second.Spec) {
+		t.Errorf("Render() depends on peer order:\n%v\n%v", first.Spec, second.Spec)
+	}
+
+	var cidrs []string
+	for _, peer := range first.Spec.Egress[0].To {
+		cidrs = append(cidrs, peer.IPBlock.CIDR)
+	}
+	if want := "10.0.0.1/32,10.0.0.2/32,10.0.0.3/32"; strings.Join(cidrs, ",") != want {
+		t.Errorf("Render() peers = %v, want %s", cidrs, want)
+	}
+}
+
+func TestRender_Unresolved(t *testing.T) {
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{
+			{To: []networkingv1alpha1.EgressPeer{{Hostname: "failed.example.com"}}},
+			{To: []networkingv1alpha1.EgressPeer{{Hostname: "missing.example.com"}}},
+		},
+	}
+	resolutions := Resolutions{
+		"failed.example.com": {Err: errors.New("SERVFAIL")},
+	}
+
+	np, report := Render(spec, resolutions)
+	if len(np.Spec.Egress) != 0 {
+		t.Errorf("Render() egress = %v, want none", np.Spec.Egress)
+	}
+	if len(report.Errors) != 2 {
+		t.Errorf("Report.Errors = %v, want 2 errors", report.Errors)
+	}
+	if len(report.DroppedRules) != 2 {
+		t.Errorf("Report.DroppedRules = %v, want [0 1]", report.DroppedRules)
+	}
+}
+
+func TestExpandHostnameSets(t *testing.T) {
+	vendors := networkingv1alpha1.HostnameSetReference{Name: "vendors"}
+	shared := networkingv1alpha1.HostnameSetReference{Kind: networkingv1alpha1.ClusterHostnameSetKind, Name: "shared"}
+	missing := networkingv1alpha1.HostnameSetReference{Name: "missing"}
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{
+			{To: []networkingv1alpha1.EgressPeer{
+				{Hostname: "api.example.com"},
+				{HostnameSetRef: &vendors, AllowedCNAMESuffixes: []string{"vendor.com"}},
+				{HostnameSetRef: &shared},
+			}},
+			{To: []networkingv1alpha1.EgressPeer{{HostnameSetRef: &missing}}},
+		},
+	}
+
+	wantRefs := []networkingv1alpha1.HostnameSetReference{
+		{Kind: networkingv1alpha1.HostnameSetKind, Name: "vendors"}, shared, {Kind: networkingv1alpha1.HostnameSetKind, Name: "missing"},
+	}
+	if refs := HostnameSetRefs(spec); !slices.Equal(refs, wantRefs) {
+		t.Errorf("HostnameSetRefs() = %v, want %v", refs, wantRefs)
+	}
+
+	expanded := ExpandHostnameSets(spec, map[networkingv1alpha1.HostnameSetReference][]string{
+		wantRefs[0]: {"a.vendor.com", "b.vendor.com"},
+		shared:      {"api.example.com"},
+	})
+	if got, want := Hostnames(expanded), []string{"api.example.com", "a.vendor.com", "b.vendor.com"}; !slices.Equal(got, want) {
+		t.Errorf("Hostnames(expanded) = %v, want %v", got, want)
+	}
+	if peer := expanded.Egress[0].To[1]; peer.Hostname != "a.vendor.com" || peer.HostnameSetRef != nil ||
+		!slices.Equal(peer.AllowedCNAMESuffixes, []string{"vendor.com"}) {
+		t.Errorf("expanded peer = %+v, want a.vendor.com with the set peer's CNAME suffixes", peer)
+	}
+	if spec.Egress[0].To[1].HostnameSetRef == nil {
+		t.Error("ExpandHostnameSets() modified its input")
+	}
+
+	// The rule referencing only a missing set must not render as allowing every destination.
+	resolutions := Resolutions{"api.example.com": {Answer: dns.Answer{Addresses: []string{"192.0.2.1/32"}}}}
+	np, report := Render(expanded, resolutions)
+	if len(np.Spec.Egress) != 1 || !slices.Equal(report.DroppedRules, []int{1}) {
+		t.Errorf("Render() egress = %v, dropped = %v; want the rule with the missing set dropped",
+			np.Spec.Egress, report.DroppedRules)
+	}
+
+	plain := &networkingv1alpha1.NetworkPolicySpec{Egress: []networkingv1alpha1.EgressRule{{}}}
+	if ExpandHostnameSets(plain, nil) != plain {
+		t.Error("ExpandHostnameSets() copied a spec without hostname sets")
+	}
+}
+
+func TestExpandServiceRefs(t *testing.T) {
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{{To: []networkingv1alpha1.EgressPeer{
+			{ServiceRef: &networkingv1alpha1.ServiceReference{Name: "billing-api"}, DNSSEC: networkingv1alpha1.DNSSECModeRequire},
+			{ServiceRef: &networkingv1alpha1.ServiceReference{Name: "in-cluster"}},
+			{ServiceRef: &networkingv1alpha1.ServiceReference{Name: "billing-api"}},
+		}}},
+	}
+	if got, want := ServiceRefs(spec), []string{"billing-api", "in-cluster"}; !slices.Equal(got, want) {
+		t.Errorf("ServiceRefs() = %v, want %v", got, want)
+	}
+
+	expanded := ExpandServiceRefs(spec, map[string]string{"billing-api": "api.billing.example"})
+	to := expanded.Egress[0].To
+	if to[0].Hostname != "api.billing.example" || to[0].ServiceRef != nil || to[0].DNSSEC != networkingv1alpha1.DNSSECModeRequire {
+		t.Errorf("expanded peer = %+v, want api.billing.example with the Service peer's DNSSEC mode", to[0])
+	}
+	if !IsReference(to[1]) || IsReference(to[2]) {
+		t.Errorf("expanded peers = %+v, want only the unknown Service kept as a reference", to)
+	}
+	if got, want := Hostnames(expanded), []string{"api.billing.example"}; !slices.Equal(got, want) {
+		t.Errorf("Hostnames(expanded) = %v, want %v", got, want)
+	}
+}
+
+func TestRender_SRV(t *testing.T) {
+	resolver := &dnstest.MockResolver{
+		Results: map[string][]string{
+			"ldap1.corp.example": {"10.0.0.1/32"},
+			"ldap2.corp.example": {"10.0.0.2/32"},
+		},
+		SRV: map[string][]dns.SRVTarget{
+			"_ldap._tcp.corp.example": {
+				{Target: "ldap2.corp.example", Port: 636},
+				{Target: "ldap1.corp.example", Port: 389},
+				{Target: "ldap2.corp.example", Port: 389},
+			},
+		},
+	}
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{
+			{To: []networkingv1alpha1.EgressPeer{{SRV: "_ldap._tcp.corp.example"}}},
+		},
+	}
+
+	np, report := Render(spec, Resolve(context.Background(), resolver, resolver, spec))
+	if len(report.Errors) != 0 {
+		t.Fatalf("Report.Errors = %v, want none", report.Errors)
+	}
+
+	var got []string
+	for _, rule := range np.Spec.Egress {
+		var cidrs []string
+		for _, peer := range rule.To {
+			cidrs = append(cidrs, peer.IPBlock.CIDR)
+		}
+		got = append(got, fmt.Sprintf("%s/%s=%s",
+			*rule.Ports[0].Protocol, rule.Ports[0].Port.String(), strings.Join(cidrs, ",")))
+	}
+	want := []string{"TCP/389=10.0.0.1/32,10.0.0.2/32", "TCP/636=10.0.0.2/32"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Render() rules = %v, want %v", got, want)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	names := make([]string, 5*maxParallelLookups)
+	for i := range names {
+		names[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+	var mu sync.Mutex
+	running, peak := 0, 0
+	results := parallel(names, func(name string) Resolution {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return Resolution{Answer: dns.Answer{Addresses: []string{name}}}
+	})
+
+	if peak > maxParallelLookups {
+		t.Errorf("parallel() ran %d lookups at once, want at most %d", peak, maxParallelLookups)
+	}
+	for i, name := range names {
+		if !slices.Equal(results[i].Addresses, []string{name}) {
+			t.Fatalf("parallel() result %d = %v, want %s", i, results[i].Addresses, name)
+		}
+	}
+}
+
+func TestResolve_SRVUnsupported(t *testing.T) {
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{
+			{To: []networkingv1alpha1.EgressPeer{{SRV: "_ldap._tcp.corp.example"}}},
+		},
+	}
+
+	np, report := Render(spec, Resolve(context.Background(), &dnstest.MockResolver{}, nil, spec))
+	if len(np.Spec.Egress) != 0 {
+		t.Errorf("Render() egress = %v, want none", np.Spec.Egress)
+	}
+	if len(report.Errors) != 1 || len(report.DroppedRules) != 1 {
+		t.Errorf("Report = %+v, want one error and one dropped rule", report)
+	}
+}
+
+func TestCheckCNAMEChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffixes []string
+		chain    []string
+		wantErr  bool
+	}{
+		{name: "no constraint", chain: []string{"edge.tracker.example"}},
+		{name: "canonical hostname", suffixes: []string{"vendor.com"}},
+		{name: "within suffix", suffixes: []string{"vendor.com"}, chain: []string{"eu.api.vendor.com"}},
+		{name: "equal to suffix", suffixes: []string{"vendor.com"}, chain: []string{"vendor.com"}},
+		{name: "case and trailing dot", suffixes: []string{"Vendor-CDN.net."}, chain: []string{"api.vendor-cdn.net"}},
+		{
+			name:     "every alias checked",
+			suffixes: []string{"vendor.com", "vendor-cdn.net"},
+			chain:    []string{"api.vendor-cdn.net", "edge.tracker.example"},
+			wantErr:  true,
+		},
+		{name: "label boundary", suffixes: []string{"vendor.com"}, chain: []string{"evilvendor.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := networkingv1alpha1.EgressPeer{Hostname: "api.vendor.com", AllowedCNAMESuffixes: tt.suffixes}
+			err := CheckCNAMEChain(peer, tt.chain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCNAMEChain(%v, %v) error = %v, wantErr %v", tt.suffixes, tt.chain, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender_CNAMEConstraint(t *testing.T) {
+	resolutions := Resolutions{
+		"api.vendor.com": {Answer: dns.Answer{
+			Addresses:  []string{"198.51.100.7/32"},
+			CNAMEChain: []string{"edge.tracker.example"},
+		}},
+	}
+	spec := func(suffixes ...string) *networkingv1alpha1.NetworkPolicySpec {
+		return &networkingv1alpha1.NetworkPolicySpec{
+			Egress: []networkingv1alpha1.EgressRule{{To: []networkingv1alpha1.EgressPeer{
+				{Hostname: "api.vendor.com", AllowedCNAMESuffixes: suffixes},
+			}}},
+		}
+	}
+
+	np, report := Render(spec("vendor.com"), resolutions)
+	if len(np.Spec.Egress) != 0 || len(report.Errors) != 1 || len(report.DroppedRules) != 1 {
+		t.Errorf("Render() with disallowed chain = %v, %+v; want rule dropped with one error", np.Spec.Egress, report)
+	}
+
+	np, report = Render(spec("vendor.com", "tracker.example"), resolutions)
+	if len(np.Spec.Egress) != 1 || len(report.Errors) != 0 {
+		t.Errorf("Render() with allowed chain = %v, %+v; want one rule and no errors", np.Spec.Egress, report)
+	}
+}
+
+func TestRender_UnknownCNAMEChain(t *testing.T) {
+	resolutions := Resolutions{
+		"api.vendor.com": {Answer: dns.Answer{
+			Addresses:       []string{"198.51.100.7/32"},
+			CNAMEChainError: "failed to look up the canonical name: i/o timeout",
+		}},
+	}
+	spec := func(suffixes ...string) *networkingv1alpha1.NetworkPolicySpec {
+		return &networkingv1alpha1.NetworkPolicySpec{
+			Egress: []networkingv1alpha1.EgressRule{{To: []networkingv1alpha1.EgressPeer{
+				{Hostname: "api.vendor.com", AllowedCNAMESuffixes: suffixes},
+			}}},
+		}
+	}
+
+	np, report := Render(spec("vendor.com"), resolutions)
+	if len(np.Spec.Egress) != 0 || len(report.Errors) != 1 || len(report.DroppedRules) != 1 {
+		t.Errorf("Render() with unknown chain = %v, %+v; want rule dropped with one error", np.Spec.Egress, report)
+	}
+
+	np, report = Render(spec(), resolutions)
+	if len(np.Spec.Egress) != 1 || len(report.Errors) != 0 {
+		t.Errorf("Render() without suffixes = %v, %+v; want one rule and no errors", np.Spec.Egress, report)
+	}
+}
+
+// chainRecorder records the hostnames resolved with the CNAME chain requested.
+type chainRecorder struct {
+	mu      sync.Mutex
+	chained []string
+}
+
+func (r *chainRecorder) Resolve(ctx context.Context, hostname string) (*dns.Answer, error) {
+	if dns.CNAMEChainFromContext(ctx) {
+		r.mu.Lock()
+		r.chained = append(r.chained, hostname)
+		r.mu.Unlock()
+	}
+	return &dns.Answer{Addresses: []string{"192.0.2.1/32"}}, nil
+}
+
+func TestResolve_CNAMEChainRequested(t *testing.T) {
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{
+			{To: []networkingv1alpha1.EgressPeer{{Hostname: "plain.example.com"}, {Hostname: "shared.example.com"}}},
+			{To: []networkingv1alpha1.EgressPeer{
+				{Hostname: "api.vendor.com", AllowedCNAMESuffixes: []string{"vendor.com"}},
+				{Hostname: "shared.example.com", AllowedCNAMESuffixes: []string{"example.com"}},
+			}},
+		},
+	}
+	recorder := &chainRecorder{}
+	Resolve(context.Background(), recorder, nil, spec)
+	slices.Sort(recorder.chained)
+	if want := []string{"api.vendor.com", "shared.example.com"}; !slices.Equal(recorder.chained, want) {
+		t.Errorf("CNAME chain requested for %v, want %v", recorder.chained, want)
+	}
+}
+
+func TestRender_IPFamilies(t *testing.T) {
+	resolver := &dnstest.MockResolver{
+		Results: map[string][]string{
+			"dual.example.com": {"192.0.2.1/32", "2001:db8::1/128"},
+		},
+	}
+	peer := networkingv1alpha1.EgressPeer{Hostname: "dual.example.com"}
+	v4 := []corev1.IPFamily{corev1.IPv4Protocol}
+	v6 := []corev1.IPFamily{corev1.IPv6Protocol}
+
+	tests := []struct {
+		name     string
+		rule     networkingv1alpha1.EgressRule
+		defaults []dns.IPFamily
+		want     string
+	}{
+		{
+			name: "dual-stack",
+			rule: networkingv1alpha1.EgressRule{To: []networkingv1alpha1.EgressPeer{peer}},
+			want: "192.0.2.1/32,2001:db8::1/128",
+		},
+		{
+			name: "rule restricted",
+			rule: networkingv1alpha1.EgressRule{IPFamilies: v4, To: []networkingv1alpha1.EgressPeer{peer}},
+			want: "192.0.2.1/32",
+		},
+		{
+			name: "peer overrides rule",
+			rule: networkingv1alpha1.EgressRule{IPFamilies: v4, To: []networkingv1alpha1.EgressPeer{
+				{Hostname: "dual.example.com", IPFamilies: v6},
+			}},
+			want: "2001:db8::1/128",
+		},
+		{
+			name:     "global default",
+			rule:     networkingv1alpha1.EgressRule{To: []networkingv1alpha1.EgressPeer{peer}},
+			defaults: []dns.IPFamily{dns.IPv6},
+			want:     "2001:db8::1/128",
+		},
+		{
+			name:     "rule overrides global default",
+			rule:     networkingv1alpha1.EgressRule{IPFamilies: v4, To: []networkingv1alpha1.EgressPeer{peer}},
+			defaults: []dns.IPFamily{dns.IPv6},
+			want:     "192.0.2.1/32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := WithDefaultIPFamilies(&networkingv1alpha1.NetworkPolicySpec{
+				Egress: []networkingv1alpha1.EgressRule{tt.rule},
+			}, tt.defaults)
+			np, _ := Render(spec, Resolve(context.Background(), resolver, nil, spec))
+
+			var cidrs []string
+			for _, rule := range np.Spec.Egress {
+				for _, p := range rule.To {
+					cidrs = append(cidrs, p.IPBlock.CIDR)
+				}
+			}
+			if got := strings.Join(cidrs, ","); got != tt.want {
+				t.Errorf("Render() peers = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerAnswer(t *testing.T) {
+	answer := dns.Answer{
+		Addresses:       []string{"192.0.2.1/32"},
+		Filtered:        []string{"::1/128"},
+		DroppedFamilies: []dns.IPFamily{dns.IPv6},
+	}
+
+	got := PeerAnswer(answer, []dns.IPFamily{dns.IPv6})
+	if len(got.Addresses) != 0 || len(got.Filtered) != 1 {
+		t.Errorf("PeerAnswer(IPv6) = %+v, want only the filtered IPv6 address", got)
+	}
+	if want := []dns.IPFamily{dns.IPv4, dns.IPv6}; !slices.Equal(got.DroppedFamilies, want) {
+		t.Errorf("PeerAnswer(IPv6) dropped = %v, want %v", got.DroppedFamilies, want)
+	}
+}
+
+func TestCheckDNSSEC(t *testing.T) {
+	tests := []struct {
+		mode    networkingv1alpha1.DNSSECMode
+		result  dns.DNSSECResult
+		wantErr bool
+	}{
+		{mode: "", result: dns.DNSSECBogus},
+		{mode: networkingv1alpha1.DNSSECModeOff, result: dns.DNSSECBogus},
+		{mode: networkingv1alpha1.DNSSECModePrefer, result: dns.DNSSECSecure},
+		{mode: networkingv1alpha1.DNSSECModePrefer, result: dns.DNSSECInsecure},
+		{mode: networkingv1alpha1.DNSSECModePrefer, result: ""},
+		{mode: networkingv1alpha1.DNSSECModePrefer, result: dns.DNSSECBogus, wantErr: true},
+		{mode: networkingv1alpha1.DNSSECModeRequire, result: dns.DNSSECSecure},
+		{mode: networkingv1alpha1.DNSSECModeRequire, result: dns.DNSSECInsecure, wantErr: true},
+		{mode: networkingv1alpha1.DNSSECModeRequire, result: dns.DNSSECBogus, wantErr: true},
+		{mode: networkingv1alpha1.DNSSECModeRequire, result: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.mode, tt.result), func(t *testing.T) {
+			peer := networkingv1alpha1.EgressPeer{Hostname: "example.com", DNSSEC: tt.mode}
+			err := CheckDNSSEC(peer, peer.Hostname, dns.Answer{DNSSEC: tt.result})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckDNSSEC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// validationRecorder records which hostnames were resolved with DNSSEC validation requested.
+type validationRecorder struct {
+	dnstest.MockResolver
+	mu        sync.Mutex
+	validated map[string]bool
+}
+
+func (r *validationRecorder) Resolve(ctx context.Context, hostname string) (*dns.Answer, error) {
+	r.mu.Lock()
+	r.validated[hostname] = dns.DNSSECFromContext(ctx)
+	r.mu.Unlock()
+	return r.MockResolver.Resolve(ctx, hostname)
+}
+
+func TestResolve_DNSSEC(t *testing.T) {
+	resolver := &validationRecorder{
+		MockResolver: dnstest.MockResolver{
+			Results: map[string][]string{
+				"signed.example.com":   {"192.0.2.1/32"},
+				"unsigned.example.com": {"192.0.2.2/32"},
+				"ldap.corp.example":    {"192.0.2.3/32"},
+			},
+			SRV: map[string][]dns.SRVTarget{
+				"_ldap._tcp.corp.example": {{Target: "ldap.corp.example", Port: 389}},
+			},
+			DNSSEC: map[string]dns.DNSSECResult{
+				"signed.example.com":   dns.DNSSECSecure,
+				"unsigned.example.com": dns.DNSSECInsecure,
+				"ldap.corp.example":    dns.DNSSECSecure,
+			},
+		},
+		validated: make(map[string]bool),
+	}
+	spec := &networkingv1alpha1.NetworkPolicySpec{
+		Egress: []networkingv1alpha1.EgressRule{{To: []networkingv1alpha1.EgressPeer{
+			{Hostname: "signed.example.com", DNSSEC: networkingv1alpha1.DNSSECModeRequire},
+			{Hostname: "unsigned.example.com", DNSSEC: networkingv1alpha1.DNSSECModeRequire},
+			{SRV: "_ldap._tcp.corp.example", DNSSEC: networkingv1alpha1.DNSSECModeRequire},
+		}}},
+	}
+
+	np, report := Render(spec, Resolve(context.Background(), resolver, resolver, spec))
+	for _, hostname := range []string{"signed.example.com", "unsigned.example.com", "ldap.corp.example"} {
+		if !resolver.validated[hostname] {
+			t.Errorf("%s was resolved without requesting DNSSEC validation", hostname)
+		}
+	}
+	if len(report.Errors) != 1 || !strings.Contains(report.Errors[0].Error(), "unsigned.example.com") {
+		t.Errorf("Report.Errors = %v, want one error for unsigned.example.com", report.Errors)
+	}
+	var cidrs []string
+	for _, rule := range np.Spec.Egress {
+		for _, p := range rule.To {
+			cidrs = append(cidrs, p.IPBlock.CIDR)
+		}
+	}
+	if got, want := strings.Join(cidrs, ","), "192.0.2.1/32,192.0.2.3/32"; got != want {
+		t.Errorf("Render() peers = %s, want %s", got, want)
+	}
+}
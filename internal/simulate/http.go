@@ -0,0 +1,165 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+// Authorizer decides whether the caller of a request may simulate connections in a namespace.
+type Authorizer interface {
+	// Authorize returns whether the caller of r may simulate connections in namespace. It
+	// returns ErrUnauthenticated if the caller could not be authenticated.
+	Authorize(r *http.Request, namespace string) (bool, error)
+}
+
+// ErrUnauthenticated is returned by an Authorizer if the caller could not be authenticated.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Handler serves simulations of GET requests with the query parameters namespace,
+// labels (the pod's labels as "key=value,..."), destination, port and protocol.
+// It responds with the Result as JSON, with status 400 if the request is invalid, and
+// with status 401 or 403 if authz does not allow the caller to simulate in the namespace.
+func Handler(c client.Reader, authz Authorizer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req, err := parseQuery(r)
+		if err == nil {
+			err = validate(&req)
+		}
+		if err == nil {
+			err = authorize(r, authz, req.Namespace)
+		}
+		var result *Result
+		if err == nil {
+			result, err = Simulate(r.Context(), c, req)
+		}
+		switch {
+		case errors.Is(err, ErrInvalidRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrUnauthenticated):
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case errors.Is(err, errForbidden):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err != nil:
+			log.FromContext(r.Context()).Error(err, "failed to simulate connection")
+			http.Error(w, "failed to simulate connection", http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(result)
+		}
+	})
+}
+
+var errForbidden = errors.New("forbidden")
+
+func authorize(r *http.Request, authz Authorizer, namespace string) error {
+	allowed, err := authz.Authorize(r, namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: not allowed to list NetworkPolicies in namespace %s", errForbidden, namespace)
+	}
+	return nil
+}
+
+// ReviewAuthorizer authenticates the bearer token of a request with a TokenReview and
+// allows the request if a SubjectAccessReview grants its user list on augmented
+// NetworkPolicies in the namespace, since a simulation reveals what they allow.
+type ReviewAuthorizer struct {
+	Client client.Client
+}
+
+// Authorize implements Authorizer.
+func (a *ReviewAuthorizer) Authorize(r *http.Request, namespace string) (bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return false, ErrUnauthenticated
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimSpace(token)}}
+	if err := a.Client.Create(r.Context(), review); err != nil {
+		return false, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return false, ErrUnauthenticated
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	access := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User:   user.Username,
+		UID:    user.UID,
+		Groups: user.Groups,
+		Extra:  extra,
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      "list",
+			Group:     networkingv1alpha1.GroupVersion.Group,
+			Resource:  "networkpolicies",
+		},
+	}}
+	if err := a.Client.Create(r.Context(), access); err != nil {
+		return false, fmt.Errorf("failed to review access: %w", err)
+	}
+	return access.Status.Allowed, nil
+}
+
+func parseQuery(r *http.Request) (Request, error) {
+	query := r.URL.Query()
+	req := Request{
+		Namespace:   query.Get("namespace"),
+		Destination: query.Get("destination"),
+		Protocol:    corev1.Protocol(query.Get("protocol")),
+	}
+	if s := query.Get("port"); s != "" {
+		port, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return req, fmt.Errorf("%w: invalid port %q", ErrInvalidRequest, s)
+		}
+		req.Port = int32(port)
+	}
+	if s := query.Get("labels"); s != "" {
+		podLabels, err := labels.ConvertSelectorToLabelsMap(s)
+		if err != nil {
+			return req, fmt.Errorf("%w: invalid labels: %v", ErrInvalidRequest, err)
+		}
+		req.PodLabels = podLabels
+	}
+	return req, nil
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulate answers whether the NetworkPolicies of a namespace allow a pod to
+// connect to a hostname or address on a port.
+//
+// It evaluates the standard NetworkPolicies in the namespace, which include those
+// rendered from augmented NetworkPolicies, the way a network plugin enforces them.
+// Hostnames are looked up in the addresses the operator last resolved for the augmented
+// NetworkPolicies of the namespace, not in DNS, so that the answer reflects what is
+// enforced. Augmented NetworkPolicies in Audit mode are not enforced and not evaluated.
+package simulate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+	"github.com/AyoyAB/augmented-networkpolicy-operator/internal/render"
+)
+
+// ErrInvalidRequest is wrapped by the errors Simulate returns for invalid requests.
+var ErrInvalidRequest = errors.New("invalid simulation request")
+
+// Request describes a connection from a pod.
+type Request struct {
+	// Namespace is the namespace of the pod.
+	Namespace string `json:"namespace"`
+	// PodLabels are the labels of the pod.
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+	// Destination is the hostname or IP address the pod connects to.
+	Destination string `json:"destination"`
+	// Port is the destination port.
+	Port int32 `json:"port"`
+	// Protocol is the protocol of the connection. It defaults to TCP.
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+}
+
+// Result is the outcome of a simulation.
+type Result struct {
+	// Allowed is true if the connection is allowed to every address of the destination.
+	Allowed bool `json:"allowed"`
+	// Reason explains the outcome.
+	Reason string `json:"reason"`
+	// Isolated is true if any NetworkPolicy restricts egress from the pod.
+	Isolated bool `json:"isolated"`
+	// Policies are the standard NetworkPolicies restricting egress from the pod.
+	Policies []string `json:"policies,omitempty"`
+	// Addresses holds the outcome for every address of the destination.
+	Addresses []AddressResult `json:"addresses,omitempty"`
+}
+
+// AddressResult is the outcome for one address of the destination.
+type AddressResult struct {
+	Address string `json:"address"`
+	Allowed bool   `json:"allowed"`
+	// Matches are the egress rules allowing the connection.
+	Matches []RuleMatch `json:"matches,omitempty"`
+}
+
+// RuleMatch identifies an egress rule that allows a connection.
+type RuleMatch struct {
+	// NetworkPolicy is the name of the standard NetworkPolicy.
+	NetworkPolicy string `json:"networkPolicy"`
+	// Rule is the index of the egress rule in the standard NetworkPolicy.
+	Rule int `json:"rule"`
+	// CIDR is the ipBlock the address is in, or empty if the rule allows every destination.
+	CIDR string `json:"cidr,omitempty"`
+	// Sources are the augmented NetworkPolicies the standard NetworkPolicy was rendered from.
+	Sources []string `json:"sources,omitempty"`
+	// Hostnames are the hostnames of the sources that resolved to CIDR.
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// Simulate evaluates req against the NetworkPolicies in its namespace read from c.
+// It returns an error wrapping ErrInvalidRequest if req is invalid.
+func Simulate(ctx context.Context, c client.Reader, req Request) (*Result, error) {
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	var natives networkingv1.NetworkPolicyList
+	if err := c.List(ctx, &natives, client.InNamespace(req.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list NetworkPolicies: %w", err)
+	}
+	var augmented networkingv1alpha1.NetworkPolicyList
+	if err := c.List(ctx, &augmented, client.InNamespace(req.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list augmented NetworkPolicies: %w", err)
+	}
+	resolved := make(map[string]map[string][]string, len(augmented.Items))
+	for _, anp := range augmented.Items {
+		resolved[anp.Name] = anp.Status.ResolvedAddresses
+	}
+
+	var selecting []networkingv1.NetworkPolicy
+	for _, np := range natives.Items {
+		if selectsPod(&np, req.PodLabels) {
+			selecting = append(selecting, np)
+		}
+	}
+	slices.SortFunc(selecting, func(a, b networkingv1.NetworkPolicy) int { return strings.Compare(a.Name, b.Name) })
+	result := &Result{Isolated: len(selecting) > 0}
+	for _, np := range selecting {
+		result.Policies = append(result.Policies, np.Name)
+	}
+
+	addresses, err := destinationAddresses(req.Destination, resolved)
+	if err != nil && result.Isolated {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	for _, addr := range addresses {
+		ar := AddressResult{Address: addr.String(), Allowed: !result.Isolated}
+		for _, np := range selecting {
+			ar.Matches = append(ar.Matches, matchRules(&np, req, addr, resolved)...)
+		}
+		ar.Allowed = ar.Allowed || len(ar.Matches) > 0
+		result.Addresses = append(result.Addresses, ar)
+	}
+
+	denied := 0
+	for _, ar := range result.Addresses {
+		if !ar.Allowed {
+			denied++
+		}
+	}
+	switch {
+	case !result.Isolated:
+		result.Allowed = true
+		result.Reason = "no NetworkPolicy restricts egress from the pod"
+	case denied == 0:
+		result.Allowed = true
+		result.Reason = fmt.Sprintf("allowed by %s", strings.Join(matchingPolicies(result.Addresses), ", "))
+	case denied < len(result.Addresses):
+		result.Reason = fmt.Sprintf("%d of %d addresses are not allowed by the NetworkPolicies selecting the pod",
+			denied, len(result.Addresses))
+	default:
+		result.Reason = fmt.Sprintf("not allowed by any of the %d NetworkPolicies selecting the pod", len(selecting))
+	}
+	return result, nil
+}
+
+func validate(req *Request) error {
+	if req.Namespace == "" {
+		return fmt.Errorf("%w: namespace is required", ErrInvalidRequest)
+	}
+	if req.Destination == "" {
+		return fmt.Errorf("%w: destination is required", ErrInvalidRequest)
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidRequest)
+	}
+	if req.Protocol == "" {
+		req.Protocol = corev1.ProtocolTCP
+	}
+	switch req.Protocol {
+	case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+	default:
+		return fmt.Errorf("%w: unsupported protocol %q", ErrInvalidRequest, req.Protocol)
+	}
+	return nil
+}
+
+// selectsPod reports whether np restricts egress from pods with podLabels.
+func selectsPod(np *networkingv1.NetworkPolicy, podLabels map[string]string) bool {
+	if !slices.Contains(render.EffectivePolicyTypes(np.Spec), networkingv1.PolicyTypeEgress) {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+	return err == nil && selector.Matches(labels.Set(podLabels))
+}
+
+// destinationAddresses returns the address destination is, or the addresses it was
+// resolved to by any of the augmented NetworkPolicies in resolved.
+func destinationAddresses(destination string, resolved map[string]map[string][]string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(destination); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	hostname := strings.ToLower(strings.TrimSuffix(destination, "."))
+	var addresses []netip.Addr
+	for _, hostnames := range resolved {
+		for _, cidr := range hostnames[hostname] {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err == nil && !slices.Contains(addresses, prefix.Addr()) {
+				addresses = append(addresses, prefix.Addr())
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("hostname %q has not been resolved for any NetworkPolicy in the namespace", hostname)
+	}
+	slices.SortFunc(addresses, func(a, b netip.Addr) int { return a.Compare(b) })
+	return addresses, nil
+}
+
+// matchRules returns the egress rules of np that allow req to addr.
+func matchRules(
+	np *networkingv1.NetworkPolicy, req Request, addr netip.Addr, resolved map[string]map[string][]string,
+) []RuleMatch {
+	var sources []string
+	for _, ref := range np.OwnerReferences {
+		if ref.Kind == "NetworkPolicy" && ref.APIVersion == networkingv1alpha1.GroupVersion.String() {
+			sources = append(sources, ref.Name)
+		}
+	}
+
+	var matches []RuleMatch
+	for i, rule := range np.Spec.Egress {
+		if !portAllowed(rule.Ports, req.Port, req.Protocol) {
+			continue
+		}
+		if len(rule.To) == 0 {
+			matches = append(matches, RuleMatch{NetworkPolicy: np.Name, Rule: i, Sources: sources})
+			continue
+		}
+		for _, peer := range rule.To {
+			if !peerAllows(peer, addr) {
+				continue
+			}
+			match := RuleMatch{NetworkPolicy: np.Name, Rule: i, CIDR: peer.IPBlock.CIDR, Sources: sources}
+			for _, source := range sources {
+				for hostname, cidrs := range resolved[source] {
+					if slices.Contains(cidrs, peer.IPBlock.CIDR) && !slices.Contains(match.Hostnames, hostname) {
+						match.Hostnames = append(match.Hostnames, hostname)
+					}
+				}
+			}
+			slices.Sort(match.Hostnames)
+			matches = append(matches, match)
+			break
+		}
+	}
+	return matches
+}
+
+// portAllowed reports whether ports allow port over protocol. Named ports refer to the
+// container ports of destination pods and are never matched.
+func portAllowed(ports []networkingv1.NetworkPolicyPort, port int32, protocol corev1.Protocol) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, p := range ports {
+		proto := corev1.ProtocolTCP
+		if p.Protocol != nil {
+			proto = *p.Protocol
+		}
+		switch {
+		case proto != protocol:
+		case p.Port == nil:
+			return true
+		case p.Port.Type == intstr.String:
+		case p.EndPort != nil:
+			if port >= p.Port.IntVal && port <= *p.EndPort {
+				return true
+			}
+		case p.Port.IntVal == port:
+			return true
+		}
+	}
+	return false
+}
+
+// peerAllows reports whether peer allows addr. Peers selecting pods or namespaces select
+// cluster workloads rather than addresses, and are never matched.
+func peerAllows(peer networkingv1.NetworkPolicyPeer, addr netip.Addr) bool {
+	if peer.IPBlock == nil {
+		return false
+	}
+	prefix, err := netip.ParsePrefix(peer.IPBlock.CIDR)
+	if err != nil || !prefix.Contains(addr) {
+		return false
+	}
+	for _, except := range peer.IPBlock.Except {
+		if p, err := netip.ParsePrefix(except); err == nil && p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchingPolicies returns the names of the standard NetworkPolicies in results' matches.
+func matchingPolicies(results []AddressResult) []string {
+	var names []string
+	for _, ar := range results {
+		for _, m := range ar.Matches {
+			if !slices.Contains(names, m.NetworkPolicy) {
+				names = append(names, m.NetworkPolicy)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
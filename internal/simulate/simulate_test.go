@@ -0,0 +1,355 @@
+/*
+Copyright 2024 ayoy.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	networkingv1alpha1 "github.com/AyoyAB/augmented-networkpolicy-operator/api/v1alpha1"
+)
+
+func newClient(t *testing.T) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := networkingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	augmented := func(name string, resolved map[string][]string) *networkingv1alpha1.NetworkPolicy {
+		return &networkingv1alpha1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+			Status:     networkingv1alpha1.NetworkPolicyStatus{ResolvedAddresses: resolved},
+		}
+	}
+	egressOnly := []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+	web := metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	ipBlocks := func(cidrs ...string) []networkingv1.NetworkPolicyPeer {
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, cidr := range cidrs {
+			peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+		}
+		return peers
+	}
+	tcp := func(port int32) []networkingv1.NetworkPolicyPort {
+		return []networkingv1.NetworkPolicyPort{{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt32(port))}}
+	}
+	rendered := func(name string, spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "shop",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: networkingv1alpha1.GroupVersion.String(),
+					Kind:       "NetworkPolicy",
+					Name:       name,
+				}},
+			},
+			Spec: spec,
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		augmented("api", map[string][]string{"api.example.com": {"192.0.2.10/32", "192.0.2.11/32"}}),
+		augmented("cdn", map[string][]string{"cdn.example.com": {"198.51.100.1/32", "198.51.100.2/32"}}),
+		rendered("api", networkingv1.NetworkPolicySpec{
+			PodSelector: web,
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{Ports: tcp(443), To: ipBlocks("192.0.2.10/32", "192.0.2.11/32")},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{
+						Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt32(8000)), EndPort: ptr.To[int32](8100),
+					}},
+					To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{
+						CIDR: "192.0.2.0/24", Except: []string{"192.0.2.11/32"},
+					}}},
+				},
+			},
+			PolicyTypes: egressOnly,
+		}),
+		rendered("cdn", networkingv1.NetworkPolicySpec{
+			PodSelector: web,
+			Egress:      []networkingv1.NetworkPolicyEgressRule{{Ports: tcp(443), To: ipBlocks("198.51.100.1/32")}},
+			PolicyTypes: egressOnly,
+		}),
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-dns", Namespace: "shop"},
+			Spec: networkingv1.NetworkPolicySpec{
+				Egress: []networkingv1.NetworkPolicyEgressRule{{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: ptr.To(corev1.ProtocolUDP), Port: ptr.To(intstr.FromInt32(53))}},
+				}},
+				PolicyTypes: egressOnly,
+			},
+		},
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "deny-ingress", Namespace: "open"},
+			Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+		},
+	).Build()
+}
+
+func TestSimulate(t *testing.T) {
+	c := newClient(t)
+	web := map[string]string{"app": "web"}
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantAllowed bool
+		wantReason  string
+		// wantMatches are the matches as "policy/rule cidr hostnames" per address.
+		wantMatches []string
+	}{
+		{
+			name:        "hostname allowed by its rendered policy",
+			req:         Request{Namespace: "shop", PodLabels: web, Destination: "API.example.com.", Port: 443},
+			wantAllowed: true,
+			wantReason:  "allowed by api",
+			wantMatches: []string{
+				"192.0.2.10: api/0 192.0.2.10/32 [api.example.com]",
+				"192.0.2.11: api/0 192.0.2.11/32 [api.example.com]",
+			},
+		},
+		{
+			name:       "port not allowed",
+			req:        Request{Namespace: "shop", PodLabels: web, Destination: "api.example.com", Port: 80},
+			wantReason: "not allowed by any of the 3 NetworkPolicies selecting the pod",
+			wantMatches: []string{
+				"192.0.2.10:",
+				"192.0.2.11:",
+			},
+		},
+		{
+			name:        "port range and except",
+			req:         Request{Namespace: "shop", PodLabels: web, Destination: "192.0.2.12", Port: 8080},
+			wantAllowed: true,
+			wantMatches: []string{"192.0.2.12: api/1 192.0.2.0/24 []"},
+		},
+		{
+			name:        "excepted address",
+			req:         Request{Namespace: "shop", PodLabels: web, Destination: "192.0.2.11", Port: 8080},
+			wantMatches: []string{"192.0.2.11:"},
+		},
+		{
+			name:        "rule without peers allows every destination",
+			req:         Request{Namespace: "shop", Destination: "10.96.0.10", Port: 53, Protocol: corev1.ProtocolUDP},
+			wantAllowed: true,
+			wantMatches: []string{"10.96.0.10: allow-dns/0  []"},
+		},
+		{
+			name:        "some addresses not allowed",
+			req:         Request{Namespace: "shop", PodLabels: web, Destination: "cdn.example.com", Port: 443},
+			wantReason:  "1 of 2 addresses are not allowed by the NetworkPolicies selecting the pod",
+			wantMatches: []string{"198.51.100.1: cdn/0 198.51.100.1/32 [cdn.example.com]", "198.51.100.2:"},
+		},
+		{
+			name:       "unresolved hostname",
+			req:        Request{Namespace: "shop", PodLabels: web, Destination: "unknown.example.com", Port: 443},
+			wantReason: `hostname "unknown.example.com" has not been resolved for any NetworkPolicy in the namespace`,
+		},
+		{
+			name:        "pod not isolated for egress",
+			req:         Request{Namespace: "open", Destination: "unknown.example.com", Port: 443},
+			wantAllowed: true,
+			wantReason:  "no NetworkPolicy restricts egress from the pod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Simulate(context.Background(), c, tt.req)
+			if err != nil {
+				t.Fatalf("Simulate() error = %v", err)
+			}
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v (%s)", result.Allowed, tt.wantAllowed, result.Reason)
+			}
+			if tt.wantReason != "" && result.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", result.Reason, tt.wantReason)
+			}
+			var matches []string
+			for _, ar := range result.Addresses {
+				s := ar.Address + ":"
+				for _, m := range ar.Matches {
+					s += fmt.Sprintf(" %s/%d %s [%s]", m.NetworkPolicy, m.Rule, m.CIDR, strings.Join(m.Hostnames, ","))
+				}
+				matches = append(matches, s)
+			}
+			if !slices.Equal(matches, tt.wantMatches) {
+				t.Errorf("matches = %q, want %q", matches, tt.wantMatches)
+			}
+		})
+	}
+}
+
+func TestSimulate_InvalidRequest(t *testing.T) {
+	c := newClient(t)
+	for _, req := range []Request{
+		{Destination: "api.example.com", Port: 443},
+		{Namespace: "shop", Port: 443},
+		{Namespace: "shop", Destination: "api.example.com"},
+		{Namespace: "shop", Destination: "api.example.com", Port: 443, Protocol: "ICMP"},
+	} {
+		if _, err := Simulate(context.Background(), c, req); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Simulate(%+v) error = %v, want ErrInvalidRequest", req, err)
+		}
+	}
+}
+
+// namespaceAuthorizer allows the callers presenting token to simulate in namespace.
+type namespaceAuthorizer struct {
+	token, namespace string
+}
+
+func (a namespaceAuthorizer) Authorize(r *http.Request, namespace string) (bool, error) {
+	if r.Header.Get("Authorization") != "Bearer "+a.token {
+		return false, ErrUnauthenticated
+	}
+	return namespace == a.namespace, nil
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(newClient(t), namespaceAuthorizer{token: "reader", namespace: "shop"})
+	get := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/simulate?namespace=shop&labels=app%3Dweb&destination=api.example.com&port=443", "reader")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var result Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || len(result.Addresses) != 2 {
+		t.Errorf("result = %+v, want allowed to both addresses", result)
+	}
+
+	for _, target := range []string{
+		"/simulate?namespace=shop&destination=api.example.com",
+		"/simulate?namespace=shop&destination=api.example.com&port=https",
+		"/simulate?namespace=shop&destination=api.example.com&port=443&labels=a%3Db%3Dc",
+	} {
+		if rec := get(target, "reader"); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", target, rec.Code)
+		}
+	}
+
+	if rec := get("/simulate?namespace=shop&destination=api.example.com&port=443", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET without a token status = %d, want 401", rec.Code)
+	}
+	rec = get("/simulate?namespace=payments&destination=api.example.com&port=443", "reader")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET in another namespace status = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/simulate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
+
+func TestReviewAuthorizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := authenticationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var reviewed *authorizationv1.SubjectAccessReviewSpec
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			switch review := obj.(type) {
+			case *authenticationv1.TokenReview:
+				review.Status.Authenticated = review.Spec.Token == "reader"
+				review.Status.User = authenticationv1.UserInfo{Username: "alice", Groups: []string{"tenants"}}
+			case *authorizationv1.SubjectAccessReview:
+				reviewed = review.Spec.DeepCopy()
+				review.Status.Allowed = review.Spec.User == "alice" && review.Spec.ResourceAttributes.Namespace == "shop"
+			}
+			return nil
+		},
+	}).Build()
+	authz := &ReviewAuthorizer{Client: c}
+
+	tests := []struct {
+		name          string
+		header        string
+		namespace     string
+		want          bool
+		wantUnauthErr bool
+	}{
+		{name: "allowed", header: "Bearer reader", namespace: "shop", want: true},
+		{name: "other namespace", header: "Bearer reader", namespace: "payments"},
+		{name: "invalid token", header: "Bearer guess", namespace: "shop", wantUnauthErr: true},
+		{name: "no token", namespace: "shop", wantUnauthErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/simulate", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			got, err := authz.Authorize(req, tt.namespace)
+			if tt.wantUnauthErr {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authorize() error = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Authorize() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if reviewed == nil || reviewed.ResourceAttributes.Verb != "list" ||
+		reviewed.ResourceAttributes.Group != networkingv1alpha1.GroupVersion.Group ||
+		reviewed.ResourceAttributes.Resource != "networkpolicies" || !slices.Equal(reviewed.Groups, []string{"tenants"}) {
+		t.Errorf("SubjectAccessReview = %+v, want list on networkpolicies for alice's groups", reviewed)
+	}
+}
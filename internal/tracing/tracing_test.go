@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_Disabled(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Error("Setup() without an endpoint replaced the global TracerProvider")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, ok := Tracer().Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Tracer().Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Status.Code != codes.Unset {
+		t.Errorf("ok span status = %v, want unset", spans[0].Status.Code)
+	}
+	if spans[1].Status.Code != codes.Error || spans[1].Status.Description != "boom" {
+		t.Errorf("failed span status = %v %q, want error boom", spans[1].Status.Code, spans[1].Status.Description)
+	}
+	if len(spans[1].Events) != 1 || spans[1].Events[0].Name != "exception" {
+		t.Errorf("failed span events = %v, want one exception", spans[1].Events)
+	}
+}